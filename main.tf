@@ -1,3 +1,26 @@
+data "aws_caller_identity" "current" {}
+
+data "aws_region" "current" {}
+
+locals {
+  # Events are only accepted from the module's own account and region unless configured otherwise
+  allowed_account_ids = length(var.allowed_account_ids) > 0 ? var.allowed_account_ids : [data.aws_caller_identity.current.account_id]
+  allowed_regions     = length(var.allowed_regions) > 0 ? var.allowed_regions : [data.aws_region.current.name]
+
+  # Unset template attributes are dropped so the function fills in its defaults
+  alarm_templates = length(var.alarm_templates) > 0 ? jsonencode([for t in var.alarm_templates : { for k, v in t : k => v if v != null }]) : ""
+
+  # Only the attributes that are set are passed on, the others are left as they are on the replica
+  instance_settings   = var.instance_settings == null ? "" : jsonencode({ for k, v in var.instance_settings : k => v if v != null })
+  monitoring_role_arn = try(var.instance_settings.monitoring_role_arn, null)
+
+  # Unset webhook attributes are dropped so the function fills in its defaults
+  webhooks = length(var.webhooks) > 0 ? jsonencode([for w in var.webhooks : { for k, v in w : k => v if v != null }]) : ""
+
+  # Domain events may go to a bus of another account, which is then named by its ARN
+  event_bus_arn = startswith(var.event_bus_name, "arn:") ? var.event_bus_name : "arn:aws:events:${data.aws_region.current.name}:${data.aws_caller_identity.current.account_id}:event-bus/${var.event_bus_name}"
+}
+
 resource "aws_iam_role" "lambda_exec_role" {
   name               = "ro_set_tags_${var.rds_cluster_identifier}"
   assume_role_policy = data.aws_iam_policy_document.lambda_assume_role_policy.json
@@ -31,6 +54,189 @@ data "aws_iam_policy_document" "lambda_permissions_policy" {
     ]
     resources = ["*"]
   }
+
+  dynamic "statement" {
+    for_each = var.enable_sqs_queue ? [1] : []
+    content {
+      actions = [
+        "sqs:ReceiveMessage",
+        "sqs:DeleteMessage",
+        "sqs:GetQueueAttributes",
+      ]
+      resources = [aws_sqs_queue.events[0].arn]
+    }
+  }
+
+  # Enabling enhanced monitoring passes the monitoring role to RDS
+  dynamic "statement" {
+    for_each = local.monitoring_role_arn != null ? [1] : []
+    content {
+      actions   = ["iam:PassRole"]
+      resources = [local.monitoring_role_arn]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = length(var.alarm_templates) > 0 ? [1] : []
+    content {
+      actions = [
+        "cloudwatch:PutMetricAlarm",
+        "cloudwatch:DescribeAlarms",
+        "cloudwatch:DeleteAlarms",
+      ]
+      resources = ["*"]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = var.tag_log_groups ? [1] : []
+    content {
+      actions   = ["logs:DescribeLogGroups"]
+      resources = ["*"]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = var.tag_log_groups ? [1] : []
+    content {
+      actions = [
+        "logs:ListTagsForResource",
+        "logs:TagResource",
+        "logs:PutRetentionPolicy",
+      ]
+      resources = ["arn:aws:logs:*:*:log-group:/aws/rds/instance/*"]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = var.tag_scalable_target ? [1] : []
+    content {
+      actions = [
+        "application-autoscaling:DescribeScalableTargets",
+        "application-autoscaling:ListTagsForResource",
+        "application-autoscaling:TagResource",
+      ]
+      resources = ["*"]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = var.event_bus_name != "" ? [1] : []
+    content {
+      actions   = ["events:PutEvents"]
+      resources = [local.event_bus_arn]
+    }
+  }
+
+  # The scaling cause reported in domain events is read from the scaling activities of the cluster
+  dynamic "statement" {
+    for_each = var.event_bus_name != "" ? [1] : []
+    content {
+      actions   = ["application-autoscaling:DescribeScalingActivities"]
+      resources = ["*"]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = var.audit_sink == "s3" ? [1] : []
+    content {
+      actions   = ["s3:PutObject"]
+      resources = ["arn:aws:s3:::${var.audit_bucket_name}/${var.audit_prefix}*"]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = var.audit_sink == "dynamodb" ? [1] : []
+    content {
+      actions   = ["dynamodb:PutItem"]
+      resources = [aws_dynamodb_table.audit[0].arn]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = var.enable_idempotency ? [1] : []
+    content {
+      actions = [
+        "dynamodb:PutItem",
+        "dynamodb:DeleteItem",
+      ]
+      resources = [aws_dynamodb_table.idempotency[0].arn]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = var.enable_replica_lifetimes ? [1] : []
+    content {
+      actions = [
+        "dynamodb:PutItem",
+        "dynamodb:DeleteItem",
+      ]
+      resources = [aws_dynamodb_table.replicas[0].arn]
+    }
+  }
+}
+
+# Processed EventBridge event IDs, used to skip duplicate deliveries
+resource "aws_dynamodb_table" "idempotency" {
+  count = var.enable_idempotency ? 1 : 0
+
+  name         = "ro_set_tags_${var.rds_cluster_identifier}_events"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "event_id"
+
+  attribute {
+    name = "event_id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  tags = var.tags
+}
+
+# Audit records are kept for compliance, so the table can be restored to any point in time
+resource "aws_dynamodb_table" "audit" {
+  count = var.audit_sink == "dynamodb" ? 1 : 0
+
+  name         = "ro_set_tags_${var.rds_cluster_identifier}_audit"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "resource_id"
+  range_key    = "recorded_at"
+
+  attribute {
+    name = "resource_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "recorded_at"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  tags = var.tags
+}
+
+# Creation times of autoscaled replicas, used to report their lifetime when they are deleted
+resource "aws_dynamodb_table" "replicas" {
+  count = var.enable_replica_lifetimes ? 1 : 0
+
+  name         = "ro_set_tags_${var.rds_cluster_identifier}_replicas"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "instance_id"
+
+  attribute {
+    name = "instance_id"
+    type = "S"
+  }
+
+  tags = var.tags
 }
 
 # Build the Go binary and create zip file
@@ -81,6 +287,7 @@ resource "aws_lambda_function" "lambda" {
   role             = aws_iam_role.lambda_exec_role.arn
   handler          = "HandleRequest"
   memory_size      = 128
+  timeout          = var.lambda_timeout
   source_code_hash = data.archive_file.lambda_zip.output_base64sha256
 
   runtime = "provided.al2"
@@ -91,8 +298,38 @@ resource "aws_lambda_function" "lambda" {
 
   environment {
     variables = {
-      TAGS                   = jsonencode(var.push_tags),
-      RDS_CLUSTER_IDENTIFIER = var.rds_cluster_identifier,
+      TAGS                      = jsonencode(var.push_tags),
+      RDS_CLUSTER_IDENTIFIER    = var.rds_cluster_identifier,
+      METRICS_NAMESPACE         = var.metrics_namespace,
+      VERIFY_TAGS_ATTEMPTS      = tostring(var.verify_tags_attempts),
+      VERIFY_TAGS_DELAY         = var.verify_tags_delay,
+      IDEMPOTENCY_TABLE         = var.enable_idempotency ? aws_dynamodb_table.idempotency[0].name : "",
+      IDEMPOTENCY_TTL           = var.idempotency_ttl,
+      MAX_EVENT_AGE             = var.max_event_age,
+      STALE_EVENT_MODE          = var.stale_event_mode,
+      ALLOWED_ACCOUNT_IDS       = join(",", local.allowed_account_ids),
+      ALLOWED_REGIONS           = join(",", local.allowed_regions),
+      INHERITED_TAG_KEYS        = join(",", var.inherited_tag_keys),
+      CATCH_UP_LOOKBACK         = var.catch_up_lookback,
+      CUSTOM_ENDPOINTS          = join(",", var.custom_endpoints),
+      CUSTOM_ENDPOINT_TAG       = var.custom_endpoint_tag,
+      INSTANCE_SETTINGS         = local.instance_settings,
+      INSTANCE_SETTINGS_DRY_RUN = tostring(var.instance_settings_dry_run),
+      ENFORCE_PROMOTION_TIER    = tostring(var.enforce_promotion_tier),
+      PROMOTION_TIER            = var.enforce_promotion_tier ? tostring(var.promotion_tier) : "",
+      ALARM_TEMPLATES           = local.alarm_templates,
+      REPLICA_TABLE             = var.enable_replica_lifetimes ? aws_dynamodb_table.replicas[0].name : "",
+      TAG_LOG_GROUPS            = tostring(var.tag_log_groups),
+      LOG_GROUP_RETENTION_DAYS  = tostring(var.log_group_retention_days),
+      TAG_SCALABLE_TARGET       = tostring(var.tag_scalable_target),
+      EVENT_BUS_NAME            = var.event_bus_name,
+      WEBHOOKS                  = local.webhooks,
+      WEBHOOK_TIMEOUT           = var.webhook_timeout,
+      WEBHOOK_RETRIES           = tostring(var.webhook_retries),
+      AUDIT_SINK                = var.audit_sink,
+      AUDIT_BUCKET              = var.audit_bucket_name,
+      AUDIT_PREFIX              = var.audit_prefix,
+      AUDIT_TABLE               = var.audit_sink == "dynamodb" ? aws_dynamodb_table.audit[0].name : "",
     }
   }
   lifecycle {
@@ -109,12 +346,15 @@ resource "aws_cloudwatch_event_rule" "read_replica_created" {
     "source" : ["aws.rds"],
     "detail-type" : ["RDS DB Instance Event"],
     "detail" : {
-      "EventID" : ["RDS-EVENT-0005"] # Event: "DB instance created"
+      # Events: "DB instance created", and "DB instance deleted" to clean up custom endpoints and alarms and record the lifetime
+      "EventID" : ["RDS-EVENT-0005", "RDS-EVENT-0003"]
     }
   })
 }
 
 resource "aws_lambda_permission" "allow_eventbridge" {
+  count = var.enable_sqs_queue ? 0 : 1
+
   statement_id  = "ro_set_tags_${var.rds_cluster_identifier}"
   action        = "lambda:InvokeFunction"
   function_name = aws_lambda_function.lambda.function_name
@@ -125,5 +365,289 @@ resource "aws_lambda_permission" "allow_eventbridge" {
 resource "aws_cloudwatch_event_target" "read_replica_target" {
   rule      = aws_cloudwatch_event_rule.read_replica_created.name
   target_id = "ro_set_tags_${var.rds_cluster_identifier}"
+  arn       = var.enable_sqs_queue ? aws_sqs_queue.events[0].arn : aws_lambda_function.lambda.arn
+}
+
+moved {
+  from = aws_lambda_permission.allow_eventbridge
+  to   = aws_lambda_permission.allow_eventbridge[0]
+}
+
+# Sweep the replicas after a failover or when the cluster is created again, for instance from a snapshot
+resource "aws_cloudwatch_event_rule" "cluster_event" {
+  name        = "ro_set_tags_cluster_${var.rds_cluster_identifier}"
+  description = "Trigger Lambda when ${var.rds_cluster_identifier} fails over or is created"
+  event_pattern = jsonencode({
+    "source" : ["aws.rds"],
+    "detail-type" : ["RDS DB Cluster Event"],
+    "detail" : {
+      # Events: "DB cluster failover completed" and "DB cluster created"
+      "EventID" : ["RDS-EVENT-0071", "RDS-EVENT-0170"],
+      "SourceIdentifier" : [var.rds_cluster_identifier]
+    }
+  })
+}
+
+resource "aws_lambda_permission" "allow_cluster_event" {
+  count = var.enable_sqs_queue ? 0 : 1
+
+  statement_id  = "ro_set_tags_cluster_${var.rds_cluster_identifier}"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.cluster_event.arn
+}
+
+resource "aws_cloudwatch_event_target" "cluster_event_target" {
+  rule      = aws_cloudwatch_event_rule.cluster_event.name
+  target_id = "ro_set_tags_cluster_${var.rds_cluster_identifier}"
+  arn       = var.enable_sqs_queue ? aws_sqs_queue.events[0].arn : aws_lambda_function.lambda.arn
+}
+
+# Tag replicas as soon as Application Auto Scaling calls CreateDBInstance, requires a CloudTrail trail
+resource "aws_cloudwatch_event_rule" "create_db_instance_call" {
+  count = var.enable_cloudtrail_tagging ? 1 : 0
+
+  name        = "ro_set_tags_call_${var.rds_cluster_identifier}"
+  description = "Trigger Lambda when application autoscaling creates an instance in ${var.rds_cluster_identifier}"
+  event_pattern = jsonencode({
+    "source" : ["aws.rds"],
+    "detail-type" : ["AWS API Call via CloudTrail"],
+    "detail" : {
+      "eventSource" : ["rds.amazonaws.com"],
+      "eventName" : ["CreateDBInstance"]
+    }
+  })
+}
+
+resource "aws_lambda_permission" "allow_create_db_instance_call" {
+  count = var.enable_cloudtrail_tagging && !var.enable_sqs_queue ? 1 : 0
+
+  statement_id  = "ro_set_tags_call_${var.rds_cluster_identifier}"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.create_db_instance_call[0].arn
+}
+
+resource "aws_cloudwatch_event_target" "create_db_instance_call_target" {
+  count = var.enable_cloudtrail_tagging ? 1 : 0
+
+  rule      = aws_cloudwatch_event_rule.create_db_instance_call[0].name
+  target_id = "ro_set_tags_call_${var.rds_cluster_identifier}"
+  arn       = var.enable_sqs_queue ? aws_sqs_queue.events[0].arn : aws_lambda_function.lambda.arn
+}
+
+# Put back managed tags that someone removed from or changed on an autoscaled replica, requires a CloudTrail trail
+resource "aws_cloudwatch_event_rule" "tag_change_call" {
+  count = var.restore_managed_tags ? 1 : 0
+
+  name        = "ro_set_tags_restore_${var.rds_cluster_identifier}"
+  description = "Trigger Lambda when tags of autoscaled replicas change in ${var.rds_cluster_identifier}"
+  event_pattern = jsonencode({
+    "source" : ["aws.rds"],
+    "detail-type" : ["AWS API Call via CloudTrail"],
+    "detail" : {
+      "eventSource" : ["rds.amazonaws.com"],
+      "eventName" : ["AddTagsToResource", "RemoveTagsFromResource"],
+      "requestParameters" : {
+        "resourceName" : [{ "prefix" : "arn:aws:rds:${data.aws_region.current.name}:${data.aws_caller_identity.current.account_id}:db:application-autoscaling-" }]
+      }
+    }
+  })
+}
+
+resource "aws_lambda_permission" "allow_tag_change_call" {
+  count = var.restore_managed_tags && !var.enable_sqs_queue ? 1 : 0
+
+  statement_id  = "ro_set_tags_restore_${var.rds_cluster_identifier}"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.tag_change_call[0].arn
+}
+
+resource "aws_cloudwatch_event_target" "tag_change_call_target" {
+  count = var.restore_managed_tags ? 1 : 0
+
+  rule      = aws_cloudwatch_event_rule.tag_change_call[0].name
+  target_id = "ro_set_tags_restore_${var.rds_cluster_identifier}"
+  arn       = var.enable_sqs_queue ? aws_sqs_queue.events[0].arn : aws_lambda_function.lambda.arn
+}
+
+# Push changes of inherited cluster tags to the existing replicas, requires a CloudTrail trail
+resource "aws_cloudwatch_event_rule" "cluster_tag_change_call" {
+  count = length(var.inherited_tag_keys) > 0 ? 1 : 0
+
+  name        = "ro_set_tags_inherit_${var.rds_cluster_identifier}"
+  description = "Trigger Lambda when tags of ${var.rds_cluster_identifier} change"
+  event_pattern = jsonencode({
+    "source" : ["aws.rds"],
+    "detail-type" : ["AWS API Call via CloudTrail"],
+    "detail" : {
+      "eventSource" : ["rds.amazonaws.com"],
+      "eventName" : ["AddTagsToResource", "RemoveTagsFromResource"],
+      "requestParameters" : {
+        "resourceName" : ["arn:aws:rds:${data.aws_region.current.name}:${data.aws_caller_identity.current.account_id}:cluster:${var.rds_cluster_identifier}"]
+      }
+    }
+  })
+}
+
+resource "aws_lambda_permission" "allow_cluster_tag_change_call" {
+  count = length(var.inherited_tag_keys) > 0 && !var.enable_sqs_queue ? 1 : 0
+
+  statement_id  = "ro_set_tags_inherit_${var.rds_cluster_identifier}"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.cluster_tag_change_call[0].arn
+}
+
+resource "aws_cloudwatch_event_target" "cluster_tag_change_call_target" {
+  count = length(var.inherited_tag_keys) > 0 ? 1 : 0
+
+  rule      = aws_cloudwatch_event_rule.cluster_tag_change_call[0].name
+  target_id = "ro_set_tags_inherit_${var.rds_cluster_identifier}"
+  arn       = var.enable_sqs_queue ? aws_sqs_queue.events[0].arn : aws_lambda_function.lambda.arn
+}
+
+# Buffer events in SQS, failed messages are retried and end up in the dead-letter queue
+resource "aws_sqs_queue" "events_dlq" {
+  count = var.enable_sqs_queue ? 1 : 0
+
+  name                      = "ro_set_tags_${var.rds_cluster_identifier}_dlq"
+  message_retention_seconds = 1209600
+  tags                      = var.tags
+}
+
+resource "aws_sqs_queue" "events" {
+  count = var.enable_sqs_queue ? 1 : 0
+
+  name                       = "ro_set_tags_${var.rds_cluster_identifier}"
+  visibility_timeout_seconds = var.lambda_timeout * 6
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.events_dlq[0].arn
+    maxReceiveCount     = var.sqs_max_receive_count
+  })
+  tags = var.tags
+}
+
+data "aws_iam_policy_document" "events_queue_policy" {
+  count = var.enable_sqs_queue ? 1 : 0
+
+  statement {
+    actions   = ["sqs:SendMessage"]
+    resources = [aws_sqs_queue.events[0].arn]
+    principals {
+      type        = "Service"
+      identifiers = ["events.amazonaws.com"]
+    }
+    condition {
+      test     = "ArnEquals"
+      variable = "aws:SourceArn"
+      values = concat(
+        [aws_cloudwatch_event_rule.read_replica_created.arn, aws_cloudwatch_event_rule.cluster_event.arn],
+        aws_cloudwatch_event_rule.create_db_instance_call[*].arn,
+        aws_cloudwatch_event_rule.tag_change_call[*].arn,
+        aws_cloudwatch_event_rule.cluster_tag_change_call[*].arn,
+      )
+    }
+  }
+}
+
+resource "aws_sqs_queue_policy" "events" {
+  count = var.enable_sqs_queue ? 1 : 0
+
+  queue_url = aws_sqs_queue.events[0].id
+  policy    = data.aws_iam_policy_document.events_queue_policy[0].json
+}
+
+resource "aws_lambda_event_source_mapping" "events" {
+  count = var.enable_sqs_queue ? 1 : 0
+
+  event_source_arn        = aws_sqs_queue.events[0].arn
+  function_name           = aws_lambda_function.lambda.arn
+  batch_size              = 10
+  function_response_types = ["ReportBatchItemFailures"]
+}
+
+# Periodically reconcile tags on all autoscaled replicas of the cluster
+resource "aws_cloudwatch_event_rule" "sweep_schedule" {
+  count = var.sweep_schedule_expression != "" ? 1 : 0
+
+  name                = "ro_set_tags_sweep_${var.rds_cluster_identifier}"
+  description         = "Reconcile tags on autoscaled replicas in ${var.rds_cluster_identifier}"
+  schedule_expression = var.sweep_schedule_expression
+}
+
+resource "aws_lambda_permission" "allow_sweep_schedule" {
+  count = var.sweep_schedule_expression != "" ? 1 : 0
+
+  statement_id  = "ro_set_tags_sweep_${var.rds_cluster_identifier}"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.sweep_schedule[0].arn
+}
+
+resource "aws_cloudwatch_event_target" "sweep_schedule_target" {
+  count = var.sweep_schedule_expression != "" ? 1 : 0
+
+  rule      = aws_cloudwatch_event_rule.sweep_schedule[0].name
+  target_id = "ro_set_tags_sweep_${var.rds_cluster_identifier}"
   arn       = aws_lambda_function.lambda.arn
 }
+
+# Periodically recover creation events missed while the lambda was broken or throttled
+resource "aws_cloudwatch_event_rule" "catch_up_schedule" {
+  count = var.catch_up_schedule_expression != "" ? 1 : 0
+
+  name                = "ro_set_tags_catch_up_${var.rds_cluster_identifier}"
+  description         = "Recover missed creation events of autoscaled replicas in ${var.rds_cluster_identifier}"
+  schedule_expression = var.catch_up_schedule_expression
+}
+
+resource "aws_lambda_permission" "allow_catch_up_schedule" {
+  count = var.catch_up_schedule_expression != "" ? 1 : 0
+
+  statement_id  = "ro_set_tags_catch_up_${var.rds_cluster_identifier}"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.catch_up_schedule[0].arn
+}
+
+resource "aws_cloudwatch_event_target" "catch_up_schedule_target" {
+  count = var.catch_up_schedule_expression != "" ? 1 : 0
+
+  rule      = aws_cloudwatch_event_rule.catch_up_schedule[0].name
+  target_id = "ro_set_tags_catch_up_${var.rds_cluster_identifier}"
+  arn       = aws_lambda_function.lambda.arn
+  input = jsonencode({
+    "source" : "rds-tag-setter",
+    "detail-type" : "Catch Up Request",
+    "detail" : {
+      "lookback" : var.catch_up_lookback
+    }
+  })
+}
+
+# RDS event subscriptions publishing to SNS instead of EventBridge
+resource "aws_sns_topic_subscription" "rds_events" {
+  for_each = toset(var.sns_topic_arns)
+
+  topic_arn = each.value
+  protocol  = "lambda"
+  endpoint  = aws_lambda_function.lambda.arn
+}
+
+resource "aws_lambda_permission" "allow_sns" {
+  for_each = toset(var.sns_topic_arns)
+
+  statement_id  = "ro_set_tags_sns_${md5(each.value)}"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.lambda.function_name
+  principal     = "sns.amazonaws.com"
+  source_arn    = each.value
+}
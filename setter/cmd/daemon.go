@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"counter/internal/admin"
+	"counter/internal/metrics"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/sirupsen/logrus"
+)
+
+// runDaemon polls RDS events and serves the admin API until SIGTERM or SIGINT, for environments
+// without EventBridge rules. onStart runs each time this replica becomes the leader, before it polls.
+func runDaemon(logger *logrus.Logger, sess client.ConfigProvider, handler *metrics.Handler, status *admin.Status,
+	onStart func(context.Context)) {
+	poller, err := metrics.NewPollerFromEnv(logger, handler, sess)
+	if err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
+
+	poller.OnLeading(onStart)
+
+	elector, err := metrics.NewElectorFromEnv(logger, sess)
+	if err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
+
+	addr := os.Getenv("ADMIN_ADDR")
+	if addr == "" {
+		addr = admin.DefaultAddr
+	}
+
+	ready := poller.Ready
+	if elector != nil {
+		ready = func() error {
+			if err := elector.Ready(); err != nil {
+				return err
+			}
+
+			return poller.Ready()
+		}
+	}
+
+	server := admin.NewServer(logger, handler, status, os.Getenv("ADMIN_TOKEN"), ready)
+
+	// Cancel polling on shutdown, the event in progress is finished first.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	var wg sync.WaitGroup
+
+	// With several replicas only the lease holder polls and sweeps, the others wait to take over.
+	if elector != nil {
+		elector.Campaign()
+		poller.OnlyWhenLeader(elector.IsLeader)
+		server.OnlyWhenLeader(elector.IsLeader)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			elector.Run(ctx)
+		}()
+	}
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		if err := server.ListenAndServe(ctx, addr); err != nil {
+			logger.Fatalf("Admin API failed: %v", err)
+		}
+	}()
+
+	if err := poller.Run(ctx); err != nil {
+		logger.Fatalf("Daemon failed: %v", err)
+	}
+
+	wg.Wait()
+	logger.Printf("Daemon stopped")
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"sync"
 
+	"counter/internal/admin"
 	"counter/internal/metrics"
+	"counter/internal/notify"
 	"counter/internal/version"
 
 	"github.com/aws/aws-lambda-go/lambda"
@@ -29,6 +34,7 @@ func printVersion() {
 func main() {
 	// Handle version flag for local version checking without Lambda invocation.
 	versionFlag := flag.Bool("version", false, "Print version information")
+	modeFlag := flag.String("mode", "lambda", "Run mode: lambda, or daemon to poll RDS events without EventBridge")
 	flag.Parse()
 
 	if *versionFlag {
@@ -36,6 +42,10 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *modeFlag != "lambda" && *modeFlag != "daemon" {
+		logrus.Fatalf("Unknown mode %q, expected lambda or daemon", *modeFlag)
+	}
+
 	// Log version information to CloudWatch for deployment tracking.
 	logrus.Infof("Starting RDS Tag Setter version=%s commit=%s built=%s",
 		version.Version, version.GitCommit, version.BuildTime)
@@ -47,13 +57,64 @@ func main() {
 	// Create AWS session using environment variables and IAM roles.
 	sess := session.Must(session.NewSession())
 
+	// Read optional features from the environment and fail fast on bad values.
+	opts, err := metrics.OptionsFromEnv(sess)
+	if err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Post results to the configured webhooks, such as Slack for failures.
+	notifier, err := notify.FromEnv(logger)
+	if err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
+
+	if notifier != nil {
+		opts = append(opts, metrics.WithObserver(notifier))
+	}
+
+	// The daemon reports the results of the handler on its admin API.
+	status := admin.NewStatus(50)
+	if *modeFlag == "daemon" {
+		opts = append(opts, metrics.WithObserver(status))
+	}
+
 	// Initialize handler with AWS clients and logger for Lambda business logic.
 	handler := metrics.NewHandler(
 		logger,
 		rds.New(sess),
 		sts.New(sess),
+		opts...,
 	)
 
+	// Recover creation events missed while the function was broken or throttled, and tag the scalable target,
+	// which no event reports changes of. In daemon mode only the leader does this, once it holds the lease.
+	onStart := func(ctx context.Context) {
+		if _, err := handler.CatchUpOnStart(ctx); err != nil {
+			logger.Printf("Error catching up on missed events: %v", err)
+		}
+
+		if _, err := handler.TagScalableTargetOnStart(ctx); err != nil {
+			logger.Printf("Error tagging the scalable target: %v", err)
+		}
+	}
+
+	if *modeFlag == "daemon" {
+		runDaemon(logger, sess, handler, status, onStart)
+		return
+	}
+
+	// Dispatch each payload by source and detail-type to the handler's routes.
+	router := metrics.NewRouter(logger)
+	handler.RegisterRoutes(router)
+
+	// The startup work runs with the first invocation, a timeout in the init phase, which is limited to
+	// 10 seconds, would fail the cold start.
+	var started sync.Once
+
 	// Start Lambda handler - blocks until Lambda environment stops the process.
-	lambda.Start(handler.HandleRequest)
+	lambda.Start(func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		started.Do(func() { onStart(ctx) })
+		return router.Handle(ctx, payload)
+	})
 }
@@ -0,0 +1,175 @@
+// Package admin serves the HTTP admin API of the daemon: health and readiness probes, a status report and
+// sweeps protected by a shared token.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"counter/internal/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultAddr only accepts connections from the local host.
+const DefaultAddr = "127.0.0.1:8080"
+
+// Server is the HTTP admin API of a long-running tag setter.
+type Server struct {
+	logger   logrus.FieldLogger
+	handler  *metrics.Handler
+	status   *Status
+	token    string
+	ready    func() error
+	isLeader func() bool
+}
+
+// NewServer creates a Server for handler. Mutating endpoints require token as bearer token and are
+// disabled when token is empty. ready reports why the process is not ready, nil means ready.
+func NewServer(logger logrus.FieldLogger, handler *metrics.Handler, status *Status, token string, ready func() error) *Server {
+	return &Server{
+		logger:  logger,
+		handler: handler,
+		status:  status,
+		token:   token,
+		ready:   ready,
+	}
+}
+
+// OnlyWhenLeader rejects sweeps while isLeader reports false and reports the role on /status,
+// for deployments running several replicas.
+func (s *Server) OnlyWhenLeader(isLeader func() bool) {
+	s.isLeader = isLeader
+}
+
+// Routes returns the HTTP handler serving the admin endpoints.
+func (s *Server) Routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.healthz)
+	mux.HandleFunc("GET /readyz", s.readyz)
+	mux.HandleFunc("GET /status", s.statusz)
+	mux.HandleFunc("POST /sweep", s.authorized(s.sweep))
+
+	return mux
+}
+
+// ListenAndServe serves the admin API on addr until ctx is cancelled.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           s.Routes(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			s.logger.Printf("Error shutting down admin API: %v", err)
+		}
+	}()
+
+	s.logger.Printf("Admin API listening on %s", addr)
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// healthz reports that the process is running.
+func (s *Server) healthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyz reports whether the process is ready to handle events.
+func (s *Server) readyz(w http.ResponseWriter, _ *http.Request) {
+	if err := s.ready(); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready", "reason": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// statusz reports the last events, the outcome counts and the last errors.
+func (s *Server) statusz(w http.ResponseWriter, _ *http.Request) {
+	snapshot := s.status.Snapshot()
+
+	if err := s.ready(); err != nil {
+		snapshot.NotReady = err.Error()
+	} else {
+		snapshot.Ready = true
+	}
+
+	switch {
+	case s.isLeader == nil:
+	case s.isLeader():
+		snapshot.Role = "leader"
+	default:
+		snapshot.Role = "follower"
+	}
+
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// sweep reconciles the cluster in the cluster query parameter, the configured one when it is empty.
+func (s *Server) sweep(w http.ResponseWriter, r *http.Request) {
+	if s.isLeader != nil && !s.isLeader() {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "not the leader, send the sweep to the leader"})
+		return
+	}
+
+	cluster := r.URL.Query().Get("cluster")
+
+	result, err := s.handler.Sweep(r.Context(), cluster)
+
+	switch {
+	case errors.Is(err, metrics.ErrUnknownCluster):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case err != nil && result == nil:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	case err != nil:
+		s.logger.Printf("Sweep of cluster %s requested through the admin API failed: %v", result.ClusterIdentifier, err)
+		writeJSON(w, http.StatusInternalServerError, result)
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// authorized only calls next when the request carries the shared token as bearer token.
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token == "" {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "mutating endpoints are disabled without a token"})
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			s.logger.WithField("security", true).Warnf("Rejected %s %s from %s: invalid token", r.Method, r.URL.Path, r.RemoteAddr)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// writeJSON writes body as JSON with the given status code.
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,279 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"counter/internal/metrics"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockRDS serves the members of the Planet Express cluster.
+type mockRDS struct {
+	metrics.RDSAPI
+	tagged []string
+	err    error
+}
+
+// DescribeDBInstances returns a single untagged autoscaled replica, or err when it is set.
+func (m *mockRDS) DescribeDBInstances(*rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &rds.DescribeDBInstancesOutput{
+		DBInstances: []*rds.DBInstance{
+			{
+				DBInstanceIdentifier: aws.String("application-autoscaling-fry"),
+				DBInstanceArn:        aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+			},
+		},
+	}, nil
+}
+
+// AddTagsToResource records the tagged resource.
+func (m *mockRDS) AddTagsToResource(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+	m.tagged = append(m.tagged, aws.StringValue(input.ResourceName))
+	return &rds.AddTagsToResourceOutput{}, nil
+}
+
+// newTestServer starts the admin API of a handler for the Planet Express cluster.
+// A nil isLeader disables leader election.
+func newTestServer(t *testing.T, token string, ready func() error, isLeader func() bool) (*httptest.Server, *mockRDS, *Status) {
+	t.Helper()
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	logrus.SetOutput(io.Discard)
+	t.Cleanup(func() {
+		logrus.SetOutput(os.Stdout)
+	})
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	rdsMock := &mockRDS{}
+	status := NewStatus(10)
+	handler := metrics.NewHandler(logger, rdsMock, nil, metrics.WithObserver(status))
+
+	api := NewServer(logger, handler, status, token, ready)
+	if isLeader != nil {
+		api.OnlyWhenLeader(isLeader)
+	}
+
+	server := httptest.NewServer(api.Routes())
+	t.Cleanup(server.Close)
+
+	return server, rdsMock, status
+}
+
+// TestServer_Probes checks the health and readiness endpoints.
+func TestServer_Probes(t *testing.T) {
+	var notReady error
+
+	server, _, _ := newTestServer(t, "", func() error { return notReady }, nil)
+
+	resp, err := http.Get(server.URL + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/readyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	notReady = errors.New("the Professor is napping")
+
+	resp, err = http.Get(server.URL + "/readyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+// TestServer_Sweep covers authorization of the sweep endpoint and the status it leaves behind.
+// Only crew members who know Hermes' password may reorganize the filing cabinets.
+func TestServer_Sweep(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		header     string
+		cluster    string
+		follower   bool
+		rdsErr     error
+		wantStatus int
+		wantTagged int
+	}{
+		{
+			name:       "valid token sweeps the configured cluster",
+			token:      "sweet-zombie-jesus",
+			header:     "Bearer sweet-zombie-jesus",
+			wantStatus: http.StatusOK,
+			wantTagged: 1,
+		},
+		{
+			name:       "named cluster",
+			token:      "sweet-zombie-jesus",
+			header:     "Bearer sweet-zombie-jesus",
+			cluster:    "planet-express",
+			wantStatus: http.StatusOK,
+			wantTagged: 1,
+		},
+		{
+			name:       "unknown cluster",
+			token:      "sweet-zombie-jesus",
+			header:     "Bearer sweet-zombie-jesus",
+			cluster:    "momcorp",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "wrong token",
+			token:      "sweet-zombie-jesus",
+			header:     "Bearer sweet-lion-of-zion",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing token",
+			token:      "sweet-zombie-jesus",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong scheme",
+			token:      "sweet-zombie-jesus",
+			header:     "Basic sweet-zombie-jesus",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "no token configured",
+			header:     "Bearer ",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "no token configured and none sent",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "sweep fails",
+			token:      "sweet-zombie-jesus",
+			header:     "Bearer sweet-zombie-jesus",
+			rdsErr:     errors.New("the dark matter engine stalled"),
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "follower leaves the sweep to the leader",
+			token:      "sweet-zombie-jesus",
+			header:     "Bearer sweet-zombie-jesus",
+			follower:   true,
+			wantStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, rdsMock, status := newTestServer(t, tt.token, func() error { return nil }, func() bool { return !tt.follower })
+			rdsMock.err = tt.rdsErr
+
+			req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/sweep?cluster=%s", server.URL, tt.cluster), nil)
+			require.NoError(t, err)
+
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Len(t, rdsMock.tagged, tt.wantTagged)
+			assert.Equal(t, tt.wantTagged, status.Snapshot().Counts[metrics.OutcomeTagged])
+		})
+	}
+}
+
+// TestServer_Status checks the status report and that sweeps cannot be started with GET.
+func TestServer_Status(t *testing.T) {
+	server, _, status := newTestServer(t, "sweet-zombie-jesus", func() error { return nil }, func() bool { return true })
+
+	status.Observe(context.Background(), &metrics.Result{DBInstanceIdentifier: "application-autoscaling-fry", Outcome: metrics.OutcomeTagged})
+	status.Observe(context.Background(), &metrics.Result{DBInstanceIdentifier: "application-autoscaling-leela", Outcome: metrics.OutcomeFailed, Error: "boom"})
+
+	resp, err := http.Get(server.URL + "/status")
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	var snapshot Snapshot
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&snapshot))
+
+	assert.True(t, snapshot.Ready)
+	assert.Equal(t, "leader", snapshot.Role)
+	assert.Equal(t, 1, snapshot.Counts[metrics.OutcomeTagged])
+	assert.Equal(t, 1, snapshot.Counts[metrics.OutcomeFailed])
+	require.Len(t, snapshot.LastEvents, 2)
+	assert.Equal(t, "application-autoscaling-leela", snapshot.LastEvents[0].Result.DBInstanceIdentifier)
+	require.Len(t, snapshot.LastErrors, 1)
+	assert.Equal(t, "boom", snapshot.LastErrors[0].Result.Error)
+
+	resp, err = http.Get(server.URL + "/sweep")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+// TestServer_StatusNotReady checks that a follower that is not ready says so on /status.
+func TestServer_StatusNotReady(t *testing.T) {
+	server, _, _ := newTestServer(t, "", func() error { return errors.New("Bender is still asleep") }, func() bool { return false })
+
+	resp, err := http.Get(server.URL + "/status")
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	var snapshot Snapshot
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&snapshot))
+
+	assert.False(t, snapshot.Ready)
+	assert.Equal(t, "Bender is still asleep", snapshot.NotReady)
+	assert.Equal(t, "follower", snapshot.Role)
+}
+
+// TestServer_ListenAndServe checks that the admin API stops when its context is cancelled and reports
+// addresses it cannot listen on.
+func TestServer_ListenAndServe(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	api := NewServer(logger, nil, NewStatus(10), "", func() error { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- api.ListenAndServe(ctx, "127.0.0.1:0")
+	}()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("admin API did not shut down")
+	}
+
+	assert.Error(t, api.ListenAndServe(context.Background(), "127.0.0.1:-1"))
+}
@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"counter/internal/metrics"
+)
+
+// Event is a result observed by Status with the time it was observed.
+type Event struct {
+	Time   time.Time       `json:"time"`
+	Result *metrics.Result `json:"result"`
+}
+
+// Snapshot is the state reported by the /status endpoint.
+type Snapshot struct {
+	StartedAt  time.Time               `json:"started_at"`
+	Ready      bool                    `json:"ready"`
+	NotReady   string                  `json:"not_ready,omitempty"`
+	Role       string                  `json:"role,omitempty"`
+	Counts     map[metrics.Outcome]int `json:"counts"`
+	LastEvents []Event                 `json:"last_events"`
+	LastErrors []Event                 `json:"last_errors"`
+}
+
+// Status keeps outcome counts and the most recent results and errors of the handler.
+// It is a metrics.Observer.
+type Status struct {
+	mu        sync.Mutex
+	size      int
+	startedAt time.Time
+	counts    map[metrics.Outcome]int
+	events    []Event
+	errors    []Event
+	now       func() time.Time
+}
+
+// NewStatus creates a Status remembering the last size results and the last size errors.
+func NewStatus(size int) *Status {
+	return &Status{
+		size:      size,
+		startedAt: time.Now(),
+		counts:    make(map[metrics.Outcome]int),
+		now:       time.Now,
+	}
+}
+
+// Observe counts the result and remembers it, failed results are also kept as errors.
+func (s *Status) Observe(_ context.Context, result *metrics.Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event := Event{Time: s.now(), Result: result}
+
+	s.counts[result.Outcome]++
+	s.events = appendLast(s.events, event, s.size)
+
+	if result.Error != "" {
+		s.errors = appendLast(s.errors, event, s.size)
+	}
+}
+
+// Snapshot returns a copy of the current state, newest events first.
+func (s *Status) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[metrics.Outcome]int, len(s.counts))
+	for outcome, n := range s.counts {
+		counts[outcome] = n
+	}
+
+	return Snapshot{
+		StartedAt:  s.startedAt,
+		Counts:     counts,
+		LastEvents: newestFirst(s.events),
+		LastErrors: newestFirst(s.errors),
+	}
+}
+
+// appendLast appends event and drops the oldest entries beyond size.
+func appendLast(list []Event, event Event, size int) []Event {
+	list = append(list, event)
+	if len(list) > size {
+		list = list[len(list)-size:]
+	}
+
+	return list
+}
+
+// newestFirst returns a reversed copy of list.
+func newestFirst(list []Event) []Event {
+	reversed := make([]Event, 0, len(list))
+	for i := len(list) - 1; i >= 0; i-- {
+		reversed = append(reversed, list[i])
+	}
+
+	return reversed
+}
@@ -0,0 +1,27 @@
+package admin
+
+import (
+	"context"
+	"testing"
+
+	"counter/internal/metrics"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStatus_Observe checks that only the most recent results and errors are kept.
+func TestStatus_Observe(t *testing.T) {
+	status := NewStatus(2)
+
+	for _, id := range []string{"fry", "leela", "bender"} {
+		status.Observe(context.Background(), &metrics.Result{DBInstanceIdentifier: id, Outcome: metrics.OutcomeFailed, Error: "kill all humans"})
+	}
+
+	snapshot := status.Snapshot()
+
+	assert.Equal(t, 3, snapshot.Counts[metrics.OutcomeFailed])
+	assert.Len(t, snapshot.LastEvents, 2)
+	assert.Len(t, snapshot.LastErrors, 2)
+	assert.Equal(t, "bender", snapshot.LastEvents[0].Result.DBInstanceIdentifier)
+	assert.Equal(t, "leela", snapshot.LastEvents[1].Result.DBInstanceIdentifier)
+}
@@ -0,0 +1,241 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// rdsMetricsNamespace is the namespace of the RDS instance metrics alarms watch by default.
+const rdsMetricsNamespace = "AWS/RDS"
+
+// defaultAlarmEvaluationPeriods is the number of periods alarms evaluate when the template sets none.
+const defaultAlarmEvaluationPeriods = 5
+
+// treatMissingDataValues are the values PutMetricAlarm accepts for TreatMissingData.
+var treatMissingDataValues = []string{"breaching", "notBreaching", "ignore", "missing"}
+
+// AlarmTemplate describes an alarm created for each autoscaled replica, on a metric with the replica's
+// DBInstanceIdentifier dimension.
+type AlarmTemplate struct {
+	Name               string   `json:"name"`
+	MetricName         string   `json:"metric_name"`
+	Namespace          string   `json:"namespace,omitempty"`
+	Statistic          string   `json:"statistic,omitempty"`
+	ComparisonOperator string   `json:"comparison_operator"`
+	Threshold          float64  `json:"threshold"`
+	Period             int64    `json:"period,omitempty"`
+	EvaluationPeriods  int64    `json:"evaluation_periods,omitempty"`
+	DatapointsToAlarm  int64    `json:"datapoints_to_alarm,omitempty"`
+	TreatMissingData   string   `json:"treat_missing_data,omitempty"`
+	AlarmActions       []string `json:"alarm_actions,omitempty"`
+	OKActions          []string `json:"ok_actions,omitempty"`
+}
+
+// ParseAlarmTemplates decodes and validates alarm templates given as a JSON array. Unset fields default to the
+// Average statistic of the AWS/RDS namespace over 5 periods of 60 seconds.
+func ParseAlarmTemplates(raw string) ([]AlarmTemplate, error) {
+	var templates []AlarmTemplate
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&templates); err != nil {
+		return nil, fmt.Errorf("failed to decode alarm templates: %w", err)
+	}
+
+	names := make(map[string]bool, len(templates))
+
+	for i := range templates {
+		template := &templates[i]
+
+		if err := template.validate(); err != nil {
+			return nil, err
+		}
+
+		if names[template.Name] {
+			return nil, fmt.Errorf("alarm template %s is defined twice", template.Name)
+		}
+
+		names[template.Name] = true
+
+		if template.Namespace == "" {
+			template.Namespace = rdsMetricsNamespace
+		}
+
+		if template.Statistic == "" {
+			template.Statistic = cloudwatch.StatisticAverage
+		}
+
+		if template.Period == 0 {
+			template.Period = 60
+		}
+
+		if template.EvaluationPeriods == 0 {
+			template.EvaluationPeriods = defaultAlarmEvaluationPeriods
+		}
+	}
+
+	return templates, nil
+}
+
+// validate rejects templates that PutMetricAlarm would refuse.
+func (t AlarmTemplate) validate() error {
+	switch {
+	case t.Name == "":
+		return errors.New("alarm template name is required")
+	case t.MetricName == "":
+		return fmt.Errorf("alarm template %s: metric_name is required", t.Name)
+	case !containsString(cloudwatch.ComparisonOperator_Values(), t.ComparisonOperator):
+		return fmt.Errorf("alarm template %s: comparison_operator must be one of %v, got %q",
+			t.Name, cloudwatch.ComparisonOperator_Values(), t.ComparisonOperator)
+	case t.Statistic != "" && !containsString(cloudwatch.Statistic_Values(), t.Statistic):
+		return fmt.Errorf("alarm template %s: statistic must be one of %v, got %q", t.Name, cloudwatch.Statistic_Values(), t.Statistic)
+	case t.Period < 0 || t.EvaluationPeriods < 0 || t.DatapointsToAlarm < 0:
+		return fmt.Errorf("alarm template %s: period, evaluation_periods and datapoints_to_alarm must not be negative", t.Name)
+	case t.TreatMissingData != "" && !containsString(treatMissingDataValues, t.TreatMissingData):
+		return fmt.Errorf("alarm template %s: treat_missing_data must be one of %v, got %q",
+			t.Name, treatMissingDataValues, t.TreatMissingData)
+	}
+
+	evaluationPeriods := t.EvaluationPeriods
+	if evaluationPeriods == 0 {
+		evaluationPeriods = defaultAlarmEvaluationPeriods
+	}
+
+	if t.DatapointsToAlarm > evaluationPeriods {
+		return fmt.Errorf("alarm template %s: datapoints_to_alarm %d exceeds evaluation_periods %d",
+			t.Name, t.DatapointsToAlarm, evaluationPeriods)
+	}
+
+	return nil
+}
+
+// alarmName returns the name of the alarm created from the template for the replica.
+func (t AlarmTemplate) alarmName(dbInstanceID string) string {
+	return alarmPrefix(dbInstanceID) + t.Name
+}
+
+// alarmPrefix is shared by the names of all alarms of the replica, it is used to find them again on deletion.
+func alarmPrefix(dbInstanceID string) string {
+	return dbInstanceID + "-"
+}
+
+// input returns the PutMetricAlarm request creating or updating the alarm of the replica.
+func (t AlarmTemplate) input(dbInstanceID string) *cloudwatch.PutMetricAlarmInput {
+	input := &cloudwatch.PutMetricAlarmInput{
+		AlarmName:          aws.String(t.alarmName(dbInstanceID)),
+		AlarmDescription:   aws.String(fmt.Sprintf("%s of autoscaled replica %s, removed with the replica", t.MetricName, dbInstanceID)),
+		MetricName:         aws.String(t.MetricName),
+		Namespace:          aws.String(t.Namespace),
+		Statistic:          aws.String(t.Statistic),
+		ComparisonOperator: aws.String(t.ComparisonOperator),
+		Threshold:          aws.Float64(t.Threshold),
+		Period:             aws.Int64(t.Period),
+		EvaluationPeriods:  aws.Int64(t.EvaluationPeriods),
+		AlarmActions:       aws.StringSlice(t.AlarmActions),
+		OKActions:          aws.StringSlice(t.OKActions),
+		Dimensions: []*cloudwatch.Dimension{
+			{
+				Name:  aws.String("DBInstanceIdentifier"),
+				Value: aws.String(dbInstanceID),
+			},
+		},
+	}
+
+	if t.DatapointsToAlarm > 0 {
+		input.DatapointsToAlarm = aws.Int64(t.DatapointsToAlarm)
+	}
+
+	if t.TreatMissingData != "" {
+		input.TreatMissingData = aws.String(t.TreatMissingData)
+	}
+
+	return input
+}
+
+// createAlarms creates or updates the alarms of the replica from the templates. PutMetricAlarm replaces
+// existing alarms, so replicas handled again end up with the current templates.
+func (h *Handler) createAlarms(dbInstanceID string, result *Result) error {
+	if h.cloudwatch == nil || len(h.alarmTemplates) == 0 {
+		return nil
+	}
+
+	for _, template := range h.alarmTemplates {
+		input := template.input(dbInstanceID)
+
+		if _, err := h.cloudwatch.PutMetricAlarm(input); err != nil {
+			h.logger.Printf("Error creating alarm %s: %v", aws.StringValue(input.AlarmName), err)
+			return fmt.Errorf("failed to create alarm %s: %w", aws.StringValue(input.AlarmName), err)
+		}
+
+		result.Alarms = append(result.Alarms, aws.StringValue(input.AlarmName))
+	}
+
+	h.logger.Printf("Created alarms for DB instance %s: %v", dbInstanceID, result.Alarms)
+
+	return nil
+}
+
+// deleteAlarms removes the alarms created for the replica, including those of templates removed since.
+// Only alarms carrying the replica's DBInstanceIdentifier dimension are deleted.
+func (h *Handler) deleteAlarms(dbInstanceID string, result *Result) error {
+	input := &cloudwatch.DescribeAlarmsInput{
+		AlarmNamePrefix: aws.String(alarmPrefix(dbInstanceID)),
+		AlarmTypes:      aws.StringSlice([]string{cloudwatch.AlarmTypeMetricAlarm}),
+	}
+
+	var names []string
+
+	for {
+		output, err := h.cloudwatch.DescribeAlarms(input)
+		if err != nil {
+			return fmt.Errorf("failed to describe alarms of DB instance %s: %w", dbInstanceID, err)
+		}
+
+		for _, alarm := range output.MetricAlarms {
+			if hasInstanceDimension(alarm.Dimensions, dbInstanceID) {
+				names = append(names, aws.StringValue(alarm.AlarmName))
+			}
+		}
+
+		if aws.StringValue(output.NextToken) == "" {
+			break
+		}
+
+		input.NextToken = output.NextToken
+	}
+
+	// DeleteAlarms accepts up to 100 names per call.
+	for start := 0; start < len(names); start += 100 {
+		batch := names[start:min(start+100, len(names))]
+
+		if _, err := h.cloudwatch.DeleteAlarms(&cloudwatch.DeleteAlarmsInput{AlarmNames: aws.StringSlice(batch)}); err != nil {
+			h.logger.Printf("Error deleting alarms of DB instance %s: %v", dbInstanceID, err)
+			return fmt.Errorf("failed to delete alarms of DB instance %s: %w", dbInstanceID, err)
+		}
+
+		result.Alarms = append(result.Alarms, batch...)
+	}
+
+	if len(names) > 0 {
+		h.logger.Printf("Deleted alarms of DB instance %s: %v", dbInstanceID, names)
+	}
+
+	return nil
+}
+
+// hasInstanceDimension reports whether the alarm watches a metric of the given instance.
+func hasInstanceDimension(dimensions []*cloudwatch.Dimension, dbInstanceID string) bool {
+	for _, dimension := range dimensions {
+		if aws.StringValue(dimension.Name) == "DBInstanceIdentifier" && aws.StringValue(dimension.Value) == dbInstanceID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,273 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAlarms keeps alarms in memory like CloudWatch, with one alarm per describe page.
+type fakeAlarms struct {
+	alarms map[string]*cloudwatch.PutMetricAlarmInput
+}
+
+// mock returns a CloudWatch mock serving the alarms.
+func (f *fakeAlarms) mock() *mockCloudWatch {
+	return &mockCloudWatch{
+		putMetricAlarmFunc: func(input *cloudwatch.PutMetricAlarmInput) (*cloudwatch.PutMetricAlarmOutput, error) {
+			f.alarms[aws.StringValue(input.AlarmName)] = input
+			return &cloudwatch.PutMetricAlarmOutput{}, nil
+		},
+		describeAlarmsFunc: func(input *cloudwatch.DescribeAlarmsInput) (*cloudwatch.DescribeAlarmsOutput, error) {
+			var names []string
+
+			for name := range f.alarms {
+				if strings.HasPrefix(name, aws.StringValue(input.AlarmNamePrefix)) {
+					names = append(names, name)
+				}
+			}
+
+			sort.Strings(names)
+
+			start := 0
+			if token := aws.StringValue(input.NextToken); token != "" {
+				start = sort.SearchStrings(names, token)
+			}
+
+			output := &cloudwatch.DescribeAlarmsOutput{}
+			if start < len(names) {
+				alarm := f.alarms[names[start]]
+				output.MetricAlarms = []*cloudwatch.MetricAlarm{{AlarmName: alarm.AlarmName, Dimensions: alarm.Dimensions}}
+			}
+
+			if start+1 < len(names) {
+				output.NextToken = aws.String(names[start+1])
+			}
+
+			return output, nil
+		},
+		deleteAlarmsFunc: func(input *cloudwatch.DeleteAlarmsInput) (*cloudwatch.DeleteAlarmsOutput, error) {
+			for _, name := range aws.StringValueSlice(input.AlarmNames) {
+				delete(f.alarms, name)
+			}
+
+			return &cloudwatch.DeleteAlarmsOutput{}, nil
+		},
+	}
+}
+
+// names returns the sorted names of the stored alarms.
+func (f *fakeAlarms) names() []string {
+	names := make([]string, 0, len(f.alarms))
+	for name := range f.alarms {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// TestParseAlarmTemplates checks decoding, defaults and validation of alarm templates.
+func TestParseAlarmTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []AlarmTemplate
+		wantErr bool
+	}{
+		{
+			name: "defaults are filled in",
+			raw: `[{"name": "cpu", "metric_name": "CPUUtilization", "comparison_operator": "GreaterThanThreshold",
+				"threshold": 80, "alarm_actions": ["arn:aws:sns:us-east-1:123456789012:planet-express"]}]`,
+			want: []AlarmTemplate{{
+				Name:               "cpu",
+				MetricName:         "CPUUtilization",
+				Namespace:          "AWS/RDS",
+				Statistic:          "Average",
+				ComparisonOperator: "GreaterThanThreshold",
+				Threshold:          80,
+				Period:             60,
+				EvaluationPeriods:  5,
+				AlarmActions:       []string{"arn:aws:sns:us-east-1:123456789012:planet-express"},
+			}},
+		},
+		{
+			name: "everything set",
+			raw: `[{"name": "memory", "metric_name": "FreeableMemory", "namespace": "AWS/RDS", "statistic": "Minimum",
+				"comparison_operator": "LessThanThreshold", "threshold": 1e9, "period": 300, "evaluation_periods": 3,
+				"datapoints_to_alarm": 2, "treat_missing_data": "notBreaching"}]`,
+			want: []AlarmTemplate{{
+				Name:               "memory",
+				MetricName:         "FreeableMemory",
+				Namespace:          "AWS/RDS",
+				Statistic:          "Minimum",
+				ComparisonOperator: "LessThanThreshold",
+				Threshold:          1e9,
+				Period:             300,
+				EvaluationPeriods:  3,
+				DatapointsToAlarm:  2,
+				TreatMissingData:   "notBreaching",
+			}},
+		},
+		{
+			name:    "unknown field",
+			raw:     `[{"name": "cpu", "metric_name": "CPUUtilization", "comparison_operator": "GreaterThanThreshold", "severity": "high"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "missing metric",
+			raw:     `[{"name": "cpu", "comparison_operator": "GreaterThanThreshold"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid comparison",
+			raw:     `[{"name": "cpu", "metric_name": "CPUUtilization", "comparison_operator": "MoreThan"}]`,
+			wantErr: true,
+		},
+		{
+			name: "invalid treat missing data",
+			raw: `[{"name": "cpu", "metric_name": "CPUUtilization", "comparison_operator": "GreaterThanThreshold",
+				"treat_missing_data": "blame-fry"}]`,
+			wantErr: true,
+		},
+		{
+			name: "more datapoints than evaluation periods",
+			raw: `[{"name": "cpu", "metric_name": "CPUUtilization", "comparison_operator": "GreaterThanThreshold",
+				"evaluation_periods": 3, "datapoints_to_alarm": 4}]`,
+			wantErr: true,
+		},
+		{
+			name: "more datapoints than default evaluation periods",
+			raw: `[{"name": "cpu", "metric_name": "CPUUtilization", "comparison_operator": "GreaterThanThreshold",
+				"datapoints_to_alarm": 6}]`,
+			wantErr: true,
+		},
+		{
+			name: "duplicate names",
+			raw: `[{"name": "cpu", "metric_name": "CPUUtilization", "comparison_operator": "GreaterThanThreshold"},
+				{"name": "cpu", "metric_name": "AuroraReplicaLag", "comparison_operator": "GreaterThanThreshold"}]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAlarmTemplates(tt.raw)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestHandler_Alarms covers creating alarms for new replicas and deleting them with the replica.
+// Fry gets his own smoke detector when he moves into Bender's closet, and it leaves with him.
+func TestHandler_Alarms(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	templates, err := ParseAlarmTemplates(`[
+		{"name": "cpu", "metric_name": "CPUUtilization", "comparison_operator": "GreaterThanThreshold", "threshold": 80},
+		{"name": "lag", "metric_name": "AuroraReplicaLag", "comparison_operator": "GreaterThanThreshold", "threshold": 1000,
+			"alarm_actions": ["arn:aws:sns:us-east-1:123456789012:planet-express"]}
+	]`)
+	require.NoError(t, err)
+
+	fake := &fakeAlarms{alarms: map[string]*cloudwatch.PutMetricAlarmInput{
+		// Alarms of another instance sharing the prefix are kept.
+		"application-autoscaling-fry-clone": {
+			AlarmName:  aws.String("application-autoscaling-fry-clone"),
+			Dimensions: []*cloudwatch.Dimension{{Name: aws.String("DBInstanceIdentifier"), Value: aws.String("application-autoscaling-fry-clone")}},
+		},
+	}}
+
+	rdsMock := &mockRDS{
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			return &rds.DescribeDBInstancesOutput{DBInstances: []*rds.DBInstance{{
+				DBClusterIdentifier: aws.String("planet-express"),
+				DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+			}}}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+	}
+
+	handler := NewHandler(logrus.New(), rdsMock, &mockSTS{}, WithAlarms(fake.mock(), templates...))
+
+	result, err := handler.HandleRequest(context.Background(), instanceEvent("RDS-EVENT-0005", "application-autoscaling-fry"))
+	require.NoError(t, err)
+	assert.Equal(t, OutcomeTagged, result.Outcome)
+	assert.Equal(t, []string{"application-autoscaling-fry-cpu", "application-autoscaling-fry-lag"}, result.Alarms)
+
+	lag := fake.alarms["application-autoscaling-fry-lag"]
+	require.NotNil(t, lag)
+	assert.Equal(t, "AuroraReplicaLag", aws.StringValue(lag.MetricName))
+	assert.Equal(t, "AWS/RDS", aws.StringValue(lag.Namespace))
+	assert.Equal(t, 1000.0, aws.Float64Value(lag.Threshold))
+	assert.Equal(t, []string{"arn:aws:sns:us-east-1:123456789012:planet-express"}, aws.StringValueSlice(lag.AlarmActions))
+	assert.True(t, hasInstanceDimension(lag.Dimensions, "application-autoscaling-fry"))
+
+	// An alarm of a template removed since the replica was created is deleted as well.
+	fake.alarms["application-autoscaling-fry-iops"] = &cloudwatch.PutMetricAlarmInput{
+		AlarmName:  aws.String("application-autoscaling-fry-iops"),
+		Dimensions: []*cloudwatch.Dimension{{Name: aws.String("DBInstanceIdentifier"), Value: aws.String("application-autoscaling-fry")}},
+	}
+
+	result, err = handler.HandleInstanceDeleted(context.Background(), instanceEvent("RDS-EVENT-0003", "application-autoscaling-fry"))
+	require.NoError(t, err)
+	assert.Equal(t, OutcomeRemoved, result.Outcome)
+	assert.Equal(t, []string{"application-autoscaling-fry-cpu", "application-autoscaling-fry-iops", "application-autoscaling-fry-lag"}, result.Alarms)
+	assert.Equal(t, []string{"application-autoscaling-fry-clone"}, fake.names())
+
+	result, err = handler.HandleInstanceDeleted(context.Background(), instanceEvent("RDS-EVENT-0003", "application-autoscaling-fry"))
+	require.NoError(t, err)
+	assert.Equal(t, OutcomeRemoved, result.Outcome)
+	assert.Empty(t, result.Alarms, "a repeated deletion event finds nothing left")
+}
+
+// TestHandler_CreateAlarmsError checks that a failed alarm fails the creation event.
+func TestHandler_CreateAlarmsError(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	rdsMock := &mockRDS{
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			return &rds.DescribeDBInstancesOutput{DBInstances: []*rds.DBInstance{{
+				DBClusterIdentifier: aws.String("planet-express"),
+				DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+			}}}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+	}
+	cloudwatchMock := &mockCloudWatch{
+		putMetricAlarmFunc: func(input *cloudwatch.PutMetricAlarmInput) (*cloudwatch.PutMetricAlarmOutput, error) {
+			return nil, errors.New("the smoke detector was eaten by Nibbler")
+		},
+	}
+
+	templates := []AlarmTemplate{{Name: "cpu", MetricName: "CPUUtilization", ComparisonOperator: "GreaterThanThreshold"}}
+	handler := NewHandler(logrus.New(), rdsMock, &mockSTS{}, WithAlarms(cloudwatchMock, templates...))
+
+	result, err := handler.HandleRequest(context.Background(), instanceEvent("RDS-EVENT-0005", "application-autoscaling-fry"))
+	assert.Error(t, err)
+	assert.Equal(t, OutcomeFailed, result.Outcome)
+}
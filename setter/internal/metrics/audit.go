@@ -0,0 +1,283 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"counter/internal/version"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// AuditRecord is the durable record of a decision taken for an instance, a cluster or an event.
+type AuditRecord struct {
+	RecordedAt           time.Time         `json:"recorded_at"`
+	EventID              string            `json:"event_id,omitempty"`
+	RDSEventID           string            `json:"rds_event_id,omitempty"`
+	DBInstanceIdentifier string            `json:"db_instance_identifier,omitempty"`
+	DBInstanceArn        string            `json:"db_instance_arn,omitempty"`
+	ClusterIdentifier    string            `json:"cluster_identifier,omitempty"`
+	Outcome              Outcome           `json:"outcome"`
+	Reason               string            `json:"reason,omitempty"`
+	Error                string            `json:"error,omitempty"`
+	TagsBefore           map[string]string `json:"tags_before,omitempty"`
+	TagsApplied          map[string]string `json:"tags_applied,omitempty"`
+	TagsAfter            map[string]string `json:"tags_after,omitempty"`
+	RequestID            string            `json:"request_id,omitempty"`
+	Version              string            `json:"version"`
+	GitCommit            string            `json:"git_commit"`
+}
+
+// AuditSink stores audit records. Write is called once per invocation with the records of all its results.
+type AuditSink interface {
+	Write(records []AuditRecord) error
+}
+
+// auditRecords returns the records of result and of the per replica results it holds.
+func (h *Handler) auditRecords(result *Result) []AuditRecord {
+	record := AuditRecord{
+		RecordedAt:           h.now().UTC(),
+		EventID:              result.EventID,
+		RDSEventID:           result.RDSEventID,
+		DBInstanceIdentifier: result.DBInstanceIdentifier,
+		DBInstanceArn:        result.DBInstanceArn,
+		ClusterIdentifier:    result.ClusterIdentifier,
+		Outcome:              result.Outcome,
+		Reason:               result.Reason,
+		Error:                result.Error,
+		TagsBefore:           result.TagsBefore,
+		TagsApplied:          result.TagsApplied,
+		TagsAfter:            result.TagsAfter,
+		RequestID:            h.requestID,
+		Version:              version.Version,
+		GitCommit:            version.GitCommit,
+	}
+
+	records := []AuditRecord{record}
+
+	for _, replica := range result.Replicas {
+		for _, replicaRecord := range h.auditRecords(replica) {
+			if replicaRecord.EventID == "" {
+				replicaRecord.EventID = result.EventID
+			}
+
+			records = append(records, replicaRecord)
+		}
+	}
+
+	return records
+}
+
+// audit writes the records of results to the audit sink. When that fails the records are logged instead, so they
+// are kept in the function logs.
+func (h *Handler) audit(results ...*Result) {
+	if h.auditSink == nil || len(results) == 0 {
+		return
+	}
+
+	var records []AuditRecord
+
+	for _, result := range results {
+		records = append(records, h.auditRecords(result)...)
+	}
+
+	if err := h.auditSink.Write(records); err != nil {
+		h.recorder.Inc(MetricAuditWriteFailed)
+		h.logger.Printf("Error writing %d audit records: %v", len(records), err)
+
+		for _, record := range records {
+			raw, _ := json.Marshal(record)
+			h.logger.WithField("audit", true).Print(string(raw))
+		}
+	}
+}
+
+// jsonLines encodes records as JSON Lines.
+func jsonLines(records []AuditRecord) ([]byte, error) {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return nil, fmt.Errorf("failed to encode audit record: %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WriterAuditSink writes audit records as JSON Lines to a writer, such as stdout where Lambda sends them to the
+// function logs.
+type WriterAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterAuditSink creates a WriterAuditSink writing to w.
+func NewWriterAuditSink(w io.Writer) *WriterAuditSink {
+	return &WriterAuditSink{w: w}
+}
+
+// Write writes one line per record.
+func (s *WriterAuditSink) Write(records []AuditRecord) error {
+	lines, err := jsonLines(records)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.w.Write(lines); err != nil {
+		return fmt.Errorf("failed to write audit records: %w", err)
+	}
+
+	return nil
+}
+
+// FileAuditSink appends audit records as JSON Lines to a local file, it is meant for tests and local runs.
+type FileAuditSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileAuditSink creates a FileAuditSink appending to the file at path, which is created when missing.
+func NewFileAuditSink(path string) *FileAuditSink {
+	return &FileAuditSink{path: path}
+}
+
+// Write appends one line per record.
+func (s *FileAuditSink) Write(records []AuditRecord) error {
+	lines, err := jsonLines(records)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %w", err)
+	}
+
+	_, err = file.Write(lines)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to write audit file: %w", err)
+	}
+
+	return nil
+}
+
+// S3API defines the S3 operations we use for audit records.
+type S3API interface {
+	PutObject(*s3.PutObjectInput) (*s3.PutObjectOutput, error)
+}
+
+// S3AuditSink writes the audit records of each invocation as a JSON Lines object to an S3 bucket, under
+// <prefix>YYYY/MM/DD/<time>-<request ID>.jsonl.
+type S3AuditSink struct {
+	client S3API
+	bucket string
+	prefix string
+}
+
+// NewS3AuditSink creates an S3AuditSink writing to bucket under prefix.
+func NewS3AuditSink(client S3API, bucket, prefix string) *S3AuditSink {
+	return &S3AuditSink{client: client, bucket: bucket, prefix: prefix}
+}
+
+// Write puts the records into a new object.
+func (s *S3AuditSink) Write(records []AuditRecord) error {
+	lines, err := jsonLines(records)
+	if err != nil {
+		return err
+	}
+
+	key := s.key(records[0])
+
+	_, err = s.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(lines),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put audit object %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// key names the object of an invocation after the time and request ID of its first record. Outside Lambda the
+// event ID or the instance stand in for the request ID.
+func (s *S3AuditSink) key(first AuditRecord) string {
+	id := firstNonEmpty(first.RequestID, first.EventID, first.DBInstanceIdentifier, first.ClusterIdentifier, "local")
+	at := first.RecordedAt.UTC()
+
+	return fmt.Sprintf("%s%s/%s-%s.jsonl", s.prefix, at.Format("2006/01/02"), at.Format("20060102T150405.000000000Z"),
+		strings.ReplaceAll(id, "/", "_"))
+}
+
+// DynamoDBAuditSink writes each audit record as an item of a DynamoDB table with the string hash key resource_id,
+// the instance, cluster or event the record is about, and the string range key recorded_at.
+type DynamoDBAuditSink struct {
+	client DynamoDBAPI
+	table  string
+}
+
+// NewDynamoDBAuditSink creates a DynamoDBAuditSink backed by the given table.
+func NewDynamoDBAuditSink(client DynamoDBAPI, table string) *DynamoDBAuditSink {
+	return &DynamoDBAuditSink{client: client, table: table}
+}
+
+// Write puts one item per record, holding the record as JSON next to its keys, the event ID and the outcome.
+func (s *DynamoDBAuditSink) Write(records []AuditRecord) error {
+	for _, record := range records {
+		raw, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit record: %w", err)
+		}
+
+		resourceID := firstNonEmpty(record.DBInstanceIdentifier, record.ClusterIdentifier, record.EventID, "unknown")
+
+		item := map[string]*dynamodb.AttributeValue{
+			"resource_id": {S: aws.String(resourceID)},
+			"recorded_at": {S: aws.String(record.RecordedAt.UTC().Format(time.RFC3339Nano))},
+			"outcome":     {S: aws.String(string(record.Outcome))},
+			"record":      {S: aws.String(string(raw))},
+		}
+		if record.EventID != "" {
+			item["event_id"] = &dynamodb.AttributeValue{S: aws.String(record.EventID)}
+		}
+
+		if _, err := s.client.PutItem(&dynamodb.PutItemInput{TableName: aws.String(s.table), Item: item}); err != nil {
+			return fmt.Errorf("failed to put audit record of %s: %w", resourceID, err)
+		}
+	}
+
+	return nil
+}
+
+// firstNonEmpty returns the first of values that is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,389 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"counter/internal/version"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAuditFile returns the records of a JSON Lines audit file.
+func readAuditFile(t *testing.T, path string) []AuditRecord {
+	t.Helper()
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+
+	defer file.Close()
+
+	var records []AuditRecord
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AuditRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+
+		records = append(records, record)
+	}
+
+	require.NoError(t, scanner.Err())
+
+	return records
+}
+
+// failingAuditSink rejects every write.
+type failingAuditSink struct{}
+
+// Write fails.
+func (failingAuditSink) Write([]AuditRecord) error {
+	return errors.New("Hermes lost the forms")
+}
+
+// TestHandler_Audit covers the audit record written for each processed event.
+// Hermes files form 27B/6 for every crew change, in triplicate, signed by the current version of himself.
+func TestHandler_Audit(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth","Purpose":"delivery-company"}`)
+
+	recordedAt := time.Date(3000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		instanceID string
+		current    map[string]string
+		want       AuditRecord
+	}{
+		{
+			name:       "tagged replica",
+			instanceID: "application-autoscaling-fry",
+			current:    map[string]string{"Owner": "bender", "Ship": "planet-express-ship"},
+			want: AuditRecord{
+				EventID:              "slurm-application-autoscaling-fry",
+				RDSEventID:           "RDS-EVENT-0005",
+				DBInstanceIdentifier: "application-autoscaling-fry",
+				DBInstanceArn:        "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry",
+				ClusterIdentifier:    "planet-express",
+				Outcome:              OutcomeTagged,
+				TagsBefore:           map[string]string{"Owner": "bender", "Ship": "planet-express-ship"},
+				TagsApplied:          map[string]string{"Owner": "professor-farnsworth", "Purpose": "delivery-company"},
+				TagsAfter:            map[string]string{"Owner": "professor-farnsworth", "Purpose": "delivery-company", "Ship": "planet-express-ship"},
+			},
+		},
+		{
+			name:       "skipped instance",
+			instanceID: "nibbler",
+			want: AuditRecord{
+				EventID:              "slurm-nibbler",
+				RDSEventID:           "RDS-EVENT-0005",
+				DBInstanceIdentifier: "nibbler",
+				Outcome:              OutcomeSkipped,
+				Reason:               "not an autoscaled replica",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardLogs(t)
+
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+			// The replica keeps its tags, so the tags after are read back rather than assumed.
+			current := make(map[string]string)
+			for k, v := range tt.current {
+				current[k] = v
+			}
+
+			mock := &mockRDS{
+				describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+					return &rds.DescribeDBInstancesOutput{DBInstances: []*rds.DBInstance{{
+						DBClusterIdentifier: aws.String("planet-express"),
+						DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:" + tt.instanceID),
+					}}}, nil
+				},
+				listTagsForResourceFunc: func(input *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+					return &rds.ListTagsForResourceOutput{TagList: rdsTags(current)}, nil
+				},
+				addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+					for k, v := range tagListToMap(input.Tags) {
+						current[k] = v
+					}
+
+					return &rds.AddTagsToResourceOutput{}, nil
+				},
+			}
+
+			handler := NewHandler(logrus.New(), mock, &mockSTS{}, WithAuditSink(NewFileAuditSink(path)))
+			handler.now = func() time.Time { return recordedAt }
+
+			ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "form-27b-6"})
+
+			_, err := handler.HandleRequest(ctx, instanceEvent("RDS-EVENT-0005", tt.instanceID))
+			require.NoError(t, err)
+
+			want := tt.want
+			want.RecordedAt = recordedAt
+			want.RequestID = "form-27b-6"
+			want.Version = version.Version
+			want.GitCommit = version.GitCommit
+
+			assert.Equal(t, []AuditRecord{want}, readAuditFile(t, path))
+		})
+	}
+}
+
+// TestHandler_Audit_PropagatedRemoval verifies the tags after of a propagation are read once the inherited key
+// is removed from the replica. Mom's cost center leaves Fry's badge when Planet Express drops it.
+func TestHandler_Audit_PropagatedRemoval(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	const (
+		clusterArn = "arn:aws:rds:us-east-1:123456789012:cluster:planet-express"
+		fryArn     = "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"
+	)
+
+	fry := map[string]string{"Owner": "professor-farnsworth", "CostCenter": "momcorp"}
+
+	mock := &mockRDS{
+		listTagsForResourceFunc: func(input *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+			if aws.StringValue(input.ResourceName) == clusterArn {
+				return &rds.ListTagsForResourceOutput{}, nil
+			}
+
+			return &rds.ListTagsForResourceOutput{TagList: rdsTags(fry)}, nil
+		},
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			return &rds.DescribeDBInstancesOutput{DBInstances: []*rds.DBInstance{{
+				DBInstanceIdentifier: aws.String("application-autoscaling-fry"),
+				DBInstanceArn:        aws.String(fryArn),
+				TagList:              rdsTags(fry),
+			}}}, nil
+		},
+		removeTagsFromResourceFunc: func(input *rds.RemoveTagsFromResourceInput) (*rds.RemoveTagsFromResourceOutput, error) {
+			for _, key := range aws.StringValueSlice(input.TagKeys) {
+				delete(fry, key)
+			}
+
+			return &rds.RemoveTagsFromResourceOutput{}, nil
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	handler := NewHandler(logrus.New(), mock, &mockSTS{}, WithInheritedTagKeys("CostCenter"),
+		WithAuditSink(NewFileAuditSink(path)))
+
+	_, err := handler.HandleTagChangeCall(context.Background(), tagChangeEvent("RemoveTagsFromResource",
+		`{"type": "IAMUser", "arn": "arn:aws:iam::123456789012:user/mom"}`,
+		`{"resourceName": "`+clusterArn+`", "tagKeys": ["CostCenter"]}`))
+	require.NoError(t, err)
+
+	records := readAuditFile(t, path)
+	require.Len(t, records, 2)
+
+	replica := records[1]
+	assert.Equal(t, "application-autoscaling-fry", replica.DBInstanceIdentifier)
+	assert.Equal(t, OutcomePropagated, replica.Outcome)
+	assert.Equal(t, map[string]string{"Owner": "professor-farnsworth", "CostCenter": "momcorp"}, replica.TagsBefore)
+	assert.Equal(t, map[string]string{"Owner": "professor-farnsworth"}, replica.TagsAfter)
+}
+
+// TestHandler_Audit_SinkFailure verifies records that cannot be written end up in the logs.
+func TestHandler_Audit_SinkFailure(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	var logs bytes.Buffer
+
+	logrus.SetOutput(&logs)
+	t.Cleanup(func() {
+		logrus.SetOutput(os.Stdout)
+	})
+
+	recorder := &countingRecorder{}
+	handler := NewHandler(logrus.New(), &mockRDS{}, &mockSTS{}, WithRecorder(recorder), WithAuditSink(failingAuditSink{}))
+
+	_, err := handler.HandleRequest(context.Background(), instanceEvent("RDS-EVENT-0005", "nibbler"))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, recorder.counts[MetricAuditWriteFailed])
+	assert.Contains(t, logs.String(), "Hermes lost the forms")
+	assert.Contains(t, logs.String(), `db_instance_identifier\":\"nibbler`)
+}
+
+// TestHandler_AuditRecords verifies per replica results of a cluster event get their own records.
+func TestHandler_AuditRecords(t *testing.T) {
+	handler := NewHandler(logrus.New(), &mockRDS{}, &mockSTS{})
+
+	records := handler.auditRecords(&Result{
+		EventID:           "slurm-propagation",
+		ClusterIdentifier: "planet-express",
+		Outcome:           OutcomePropagated,
+		Replicas: []*Result{
+			{DBInstanceIdentifier: "application-autoscaling-fry", Outcome: OutcomeTagged, TagsApplied: map[string]string{"CostCenter": "momcorp"}},
+			{DBInstanceIdentifier: "application-autoscaling-leela", Outcome: OutcomeUnchanged},
+		},
+	})
+
+	require.Len(t, records, 3)
+	assert.Equal(t, OutcomePropagated, records[0].Outcome)
+	assert.Equal(t, "application-autoscaling-fry", records[1].DBInstanceIdentifier)
+	assert.Equal(t, "slurm-propagation", records[1].EventID)
+	assert.Nil(t, records[1].TagsAfter)
+	assert.Equal(t, "application-autoscaling-leela", records[2].DBInstanceIdentifier)
+}
+
+// TestWriterAuditSink verifies records are written as JSON Lines.
+func TestWriterAuditSink(t *testing.T) {
+	var buf bytes.Buffer
+
+	sink := NewWriterAuditSink(&buf)
+	require.NoError(t, sink.Write([]AuditRecord{
+		{DBInstanceIdentifier: "application-autoscaling-fry", Outcome: OutcomeTagged},
+		{DBInstanceIdentifier: "application-autoscaling-leela", Outcome: OutcomeUnchanged},
+	}))
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	assert.Contains(t, string(lines[1]), `"db_instance_identifier":"application-autoscaling-leela"`)
+}
+
+// TestFileAuditSink verifies records are appended to the file.
+func TestFileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink := NewFileAuditSink(path)
+
+	require.NoError(t, sink.Write([]AuditRecord{{DBInstanceIdentifier: "application-autoscaling-fry", Outcome: OutcomeTagged}}))
+	require.NoError(t, sink.Write([]AuditRecord{{DBInstanceIdentifier: "application-autoscaling-fry", Outcome: OutcomeRemoved}}))
+
+	records := readAuditFile(t, path)
+	require.Len(t, records, 2)
+	assert.Equal(t, OutcomeRemoved, records[1].Outcome)
+
+	assert.Error(t, NewFileAuditSink(filepath.Join(path, "not-a-directory")).Write([]AuditRecord{{}}))
+}
+
+// mockS3 simulates the Planet Express filing cabinet for testing.
+type mockS3 struct {
+	S3API
+	putObjectFunc func(*s3.PutObjectInput) (*s3.PutObjectOutput, error)
+}
+
+// PutObject returns mock response or error based on the configured function.
+func (m *mockS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	if m.putObjectFunc != nil {
+		return m.putObjectFunc(input)
+	}
+
+	return nil, errors.New("PutObject not implemented")
+}
+
+// TestS3AuditSink covers the objects written to the audit bucket.
+func TestS3AuditSink(t *testing.T) {
+	recordedAt := time.Date(3000, time.January, 1, 12, 30, 0, 5, time.UTC)
+
+	tests := []struct {
+		name    string
+		record  AuditRecord
+		putErr  error
+		wantKey string
+		wantErr bool
+	}{
+		{
+			name:    "named after the request",
+			record:  AuditRecord{RecordedAt: recordedAt, RequestID: "form-27b-6", EventID: "slurm-1"},
+			wantKey: "audit/3000/01/01/30000101T123000.000000005Z-form-27b-6.jsonl",
+		},
+		{
+			name:    "named after the event outside Lambda",
+			record:  AuditRecord{RecordedAt: recordedAt, EventID: "slurm-1"},
+			wantKey: "audit/3000/01/01/30000101T123000.000000005Z-slurm-1.jsonl",
+		},
+		{
+			name:    "bucket unavailable",
+			record:  AuditRecord{RecordedAt: recordedAt, RequestID: "form-27b-6"},
+			putErr:  errors.New("AccessDenied"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var put *s3.PutObjectInput
+
+			mock := &mockS3{
+				putObjectFunc: func(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+					put = input
+					return &s3.PutObjectOutput{}, tt.putErr
+				},
+			}
+
+			err := NewS3AuditSink(mock, "hermes-ledger", "audit/").Write([]AuditRecord{tt.record, tt.record})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "hermes-ledger", aws.StringValue(put.Bucket))
+			assert.Equal(t, tt.wantKey, aws.StringValue(put.Key))
+
+			body, err := io.ReadAll(put.Body)
+			require.NoError(t, err)
+			assert.Len(t, bytes.Split(bytes.TrimSpace(body), []byte("\n")), 2)
+		})
+	}
+}
+
+// TestDynamoDBAuditSink covers the items written to the audit table.
+func TestDynamoDBAuditSink(t *testing.T) {
+	recordedAt := time.Date(3000, time.January, 1, 12, 30, 0, 0, time.UTC)
+
+	var items []map[string]*dynamodb.AttributeValue
+
+	mock := &mockDynamoDB{
+		putItemFunc: func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+			assert.Equal(t, "hermes-ledger", aws.StringValue(input.TableName))
+			items = append(items, input.Item)
+
+			return &dynamodb.PutItemOutput{}, nil
+		},
+	}
+
+	err := NewDynamoDBAuditSink(mock, "hermes-ledger").Write([]AuditRecord{
+		{RecordedAt: recordedAt, EventID: "slurm-1", DBInstanceIdentifier: "application-autoscaling-fry", Outcome: OutcomeTagged},
+		{RecordedAt: recordedAt, ClusterIdentifier: "planet-express", Outcome: OutcomePropagated},
+	})
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+
+	assert.Equal(t, "application-autoscaling-fry", aws.StringValue(items[0]["resource_id"].S))
+	assert.Equal(t, "3000-01-01T12:30:00Z", aws.StringValue(items[0]["recorded_at"].S))
+	assert.Equal(t, "tagged", aws.StringValue(items[0]["outcome"].S))
+	assert.Equal(t, "slurm-1", aws.StringValue(items[0]["event_id"].S))
+	assert.Contains(t, aws.StringValue(items[0]["record"].S), `"db_instance_identifier":"application-autoscaling-fry"`)
+
+	assert.Equal(t, "planet-express", aws.StringValue(items[1]["resource_id"].S))
+	assert.NotContains(t, items[1], "event_id")
+
+	mock.putItemFunc = nil
+	assert.Error(t, NewDynamoDBAuditSink(mock, "hermes-ledger").Write([]AuditRecord{{Outcome: OutcomeSkipped}}))
+}
@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// maxCatchUpLookback is how far back RDS keeps events for DescribeEvents.
+const maxCatchUpLookback = 14 * 24 * time.Hour
+
+// CatchUpRequestDetailType is the detail-type of a request to recover missed creation events.
+const CatchUpRequestDetailType = "Catch Up Request"
+
+// CatchUpRequest is the detail of a catch-up request, an empty lookback means the configured one or 24 hours.
+type CatchUpRequest struct {
+	Lookback string `json:"lookback"`
+}
+
+// CatchUpResult summarizes the recovery of creation events missed within the lookback window.
+type CatchUpResult struct {
+	ClusterIdentifier string    `json:"cluster_identifier"`
+	Since             time.Time `json:"since"`
+	Results           []*Result `json:"results"`
+	// Recovered counts replicas that were created in the window and still missed tags.
+	Recovered     int `json:"recovered"`
+	AlreadyTagged int `json:"already_tagged"`
+	Gone          int `json:"gone"`
+	Failed        int `json:"failed"`
+}
+
+// CatchUp finds the RDS-EVENT-0005 events of the configured cluster within the lookback window and tags the
+// replicas that still exist and are not tagged yet, then sets them up like the creation event would have.
+// It recovers events lost while the function was broken or throttled.
+func (h *Handler) CatchUp(ctx context.Context, lookback time.Duration) (*CatchUpResult, error) {
+	catchUp, err := h.catchUpLocked(ctx, lookback)
+	if catchUp != nil {
+		h.observe(ctx, catchUp.Results...)
+	}
+
+	return catchUp, err
+}
+
+// catchUpLocked runs the catch-up while holding h.mu and writes the audit records of its results.
+func (h *Handler) catchUpLocked(ctx context.Context, lookback time.Duration) (*CatchUpResult, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.logger = loggerFromContext(ctx)
+	h.requestID = requestIDFromContext(ctx)
+	h.deadline, _ = ctx.Deadline()
+
+	clusterID, tagsMap, err := h.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	since := h.now().Add(-lookback)
+
+	list, err := h.describeInstanceEvents(since, rdsEventCategoryCreation)
+	if err != nil {
+		return nil, err
+	}
+
+	// Members of the cluster by identifier, replicas that are missing were deleted or belong elsewhere.
+	members, err := h.listClusterInstances(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make(map[string]*rds.DBInstance, len(members))
+	for _, instance := range members {
+		instances[aws.StringValue(instance.DBInstanceIdentifier)] = instance
+	}
+
+	catchUp := &CatchUpResult{ClusterIdentifier: clusterID, Since: since}
+	done := make(map[string]bool)
+
+	var errs []error
+
+	for _, e := range list {
+		dbInstanceID := aws.StringValue(e.SourceIdentifier)
+		if rdsEventIDs[aws.StringValue(e.Message)] != rdsEventInstanceCreated || !isAutoscaledReplica(dbInstanceID) || done[dbInstanceID] {
+			continue
+		}
+
+		done[dbInstanceID] = true
+
+		result := &Result{
+			EventID:              rdsEventKey(e),
+			RDSEventID:           rdsEventInstanceCreated,
+			Message:              aws.StringValue(e.Message),
+			DBInstanceIdentifier: dbInstanceID,
+			DBInstanceArn:        aws.StringValue(e.SourceArn),
+			ClusterIdentifier:    clusterID,
+			Outcome:              OutcomeUnchanged,
+		}
+		catchUp.Results = append(catchUp.Results, result)
+
+		instance, ok := instances[dbInstanceID]
+		if !ok {
+			result.Outcome = OutcomeSkipped
+			result.Reason = fmt.Sprintf("no longer a member of cluster %s", clusterID)
+			catchUp.Gone++
+
+			continue
+		}
+
+		result.DBInstanceArn = aws.StringValue(instance.DBInstanceArn)
+
+		changes := changedTags(tagsMap, tagListToMap(instance.TagList))
+		if len(changes) == 0 {
+			catchUp.AlreadyTagged++
+			continue
+		}
+
+		if err := h.applyTags(dbInstanceID, result.DBInstanceArn, changes, result); err != nil {
+			result.Outcome = OutcomeFailed
+			result.Error = err.Error()
+			catchUp.Failed++
+			errs = append(errs, err)
+
+			continue
+		}
+
+		result.Outcome = OutcomeReconciled
+		result.Reason = fmt.Sprintf("missed creation event from %s", aws.TimeValue(e.Date).Format(time.RFC3339))
+
+		// Recovered replicas are set up like those whose creation event arrived.
+		if err := h.afterCreated(clusterID, dbInstanceID, aws.TimeValue(e.Date), result); err != nil {
+			result.Outcome = OutcomeFailed
+			result.Error = err.Error()
+			catchUp.Failed++
+			errs = append(errs, err)
+
+			continue
+		}
+
+		catchUp.Recovered++
+	}
+
+	h.audit(catchUp.Results...)
+	h.logger.Printf("Caught up on cluster %s since %s: %d recovered, %d already tagged, %d gone, %d failed",
+		clusterID, since.Format(time.RFC3339), catchUp.Recovered, catchUp.AlreadyTagged, catchUp.Gone, catchUp.Failed)
+
+	return catchUp, errors.Join(errs...)
+}
+
+// CatchUpOnStart catches up over the configured lookback window at startup, it does nothing when no
+// lookback is configured.
+func (h *Handler) CatchUpOnStart(ctx context.Context) (*CatchUpResult, error) {
+	if h.catchUpLookback <= 0 {
+		return nil, nil
+	}
+
+	return h.CatchUp(ctx, h.catchUpLookback)
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandler_CatchUp checks recovery of creation events missed while the function was down.
+// While the Professor was stuck in a time loop, the crew that joined still needs its badges.
+func TestHandler_CatchUp(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	now := time.Date(3000, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	var (
+		startTime time.Time
+		tagged    []string
+	)
+
+	mock := &mockRDS{
+		describeEventsFunc: func(input *rds.DescribeEventsInput) (*rds.DescribeEventsOutput, error) {
+			startTime = aws.TimeValue(input.StartTime)
+			assert.Equal(t, []string{"creation"}, aws.StringValueSlice(input.EventCategories))
+
+			return &rds.DescribeEventsOutput{
+				Events: []*rds.Event{
+					creationEvent("application-autoscaling-fry", now.Add(-3*time.Hour)),
+					creationEvent("application-autoscaling-leela", now.Add(-2*time.Hour)),
+					creationEvent("application-autoscaling-bender", now.Add(-time.Hour)),
+					creationEvent("planet-express-writer", now.Add(-time.Hour)),
+					creationEvent("application-autoscaling-fry", now.Add(-time.Minute)),
+				},
+			}, nil
+		},
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			require.Equal(t, "planet-express", aws.StringValue(input.Filters[0].Values[0]))
+
+			return &rds.DescribeDBInstancesOutput{
+				DBInstances: []*rds.DBInstance{
+					{
+						DBInstanceIdentifier: aws.String("application-autoscaling-fry"),
+						DBInstanceArn:        aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+					},
+					{
+						DBInstanceIdentifier: aws.String("application-autoscaling-leela"),
+						DBInstanceArn:        aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-leela"),
+						TagList:              rdsTags(map[string]string{"Owner": "professor-farnsworth"}),
+					},
+					{
+						DBInstanceIdentifier: aws.String("planet-express-writer"),
+						DBInstanceArn:        aws.String("arn:aws:rds:us-east-1:123456789012:db:planet-express-writer"),
+					},
+				},
+			}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			tagged = append(tagged, aws.StringValue(input.ResourceName))
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+	}
+
+	store := NewMemoryReplicaStore()
+	handler := NewHandler(logrus.New(), mock, &mockSTS{}, WithCatchUpLookback(6*time.Hour), WithReplicaStore(store))
+	handler.now = func() time.Time { return now }
+
+	result, err := handler.CatchUpOnStart(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, now.Add(-6*time.Hour), startTime)
+	assert.Equal(t, []string{"arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"}, tagged)
+	assert.Equal(t, 1, result.Recovered)
+	assert.Equal(t, 1, result.AlreadyTagged)
+	assert.Equal(t, 1, result.Gone)
+	assert.Equal(t, 0, result.Failed)
+	assert.Len(t, result.Results, 3)
+
+	// The recovered replica went through the same steps as after a creation event.
+	createdAt, ok, err := store.Removed("application-autoscaling-fry")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(-3*time.Hour), createdAt)
+}
+
+// TestHandler_CatchUpOnStartDisabled checks that nothing is called without a configured lookback.
+func TestHandler_CatchUpOnStartDisabled(t *testing.T) {
+	// The unconfigured mocks fail the catch-up if AWS is called.
+	result, err := NewHandler(logrus.New(), &mockRDS{}, &mockSTS{}).CatchUpOnStart(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, result)
+}
@@ -0,0 +1,265 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// Values identifying RDS API calls recorded by CloudTrail and made by Application Auto Scaling.
+const (
+	cloudTrailDetailType = "AWS API Call via CloudTrail"
+	rdsAPIEventSource    = "rds.amazonaws.com"
+	autoScalingPrincipal = "application-autoscaling.amazonaws.com"
+	autoScalingRoleName  = "AWSServiceRoleForApplicationAutoScaling_RDSCluster"
+)
+
+// UserIdentity is the caller of an API call recorded by CloudTrail.
+type UserIdentity struct {
+	Type           string `json:"type"`
+	PrincipalID    string `json:"principalId"`
+	ARN            string `json:"arn"`
+	AccountID      string `json:"accountId"`
+	InvokedBy      string `json:"invokedBy"`
+	SessionContext struct {
+		SessionIssuer struct {
+			ARN      string `json:"arn"`
+			UserName string `json:"userName"`
+		} `json:"sessionIssuer"`
+	} `json:"sessionContext"`
+}
+
+// isApplicationAutoScaling reports whether the call was made by Application Auto Scaling for an Aurora cluster.
+func (u UserIdentity) isApplicationAutoScaling() bool {
+	return u.InvokedBy == autoScalingPrincipal || u.SessionContext.SessionIssuer.UserName == autoScalingRoleName
+}
+
+// CloudTrailDetail is the detail of an "AWS API Call via CloudTrail" event.
+type CloudTrailDetail struct {
+	EventID           string          `json:"eventID"`
+	EventName         string          `json:"eventName"`
+	EventSource       string          `json:"eventSource"`
+	EventTime         time.Time       `json:"eventTime"`
+	AWSRegion         string          `json:"awsRegion"`
+	ErrorCode         string          `json:"errorCode"`
+	UserIdentity      UserIdentity    `json:"userIdentity"`
+	RequestParameters json.RawMessage `json:"requestParameters"`
+	ResponseElements  json.RawMessage `json:"responseElements"`
+}
+
+// createDBInstanceCall holds the parts of a CreateDBInstance call needed for tagging.
+type createDBInstanceCall struct {
+	Request struct {
+		DBInstanceIdentifier string `json:"dBInstanceIdentifier"`
+		DBClusterIdentifier  string `json:"dBClusterIdentifier"`
+	}
+	Response struct {
+		DBInstanceArn string `json:"dBInstanceArn"`
+	}
+}
+
+// decodeCloudTrailEvent parses the CloudTrail detail and validates that the event is one of the
+// expected RDS API calls from an allowed account and region.
+func (h *Handler) decodeCloudTrailEvent(event events.CloudWatchEvent, eventNames ...string) (CloudTrailDetail, error) {
+	var detail CloudTrailDetail
+	if err := json.Unmarshal(event.Detail, &detail); err != nil {
+		h.logger.Printf("Error unmarshalling CloudTrail event detail: %v", err)
+		return detail, err
+	}
+
+	var reason string
+
+	switch {
+	case event.Source != rdsEventSource:
+		reason = fmt.Sprintf("unexpected source %q", event.Source)
+	case event.DetailType != cloudTrailDetailType:
+		reason = fmt.Sprintf("unexpected detail-type %q", event.DetailType)
+	case detail.EventSource != rdsAPIEventSource:
+		reason = fmt.Sprintf("unexpected API event source %q", detail.EventSource)
+	case !containsString(eventNames, detail.EventName):
+		reason = fmt.Sprintf("unexpected API call %q", detail.EventName)
+	default:
+		reason = h.originMismatch(event)
+	}
+
+	if reason != "" {
+		return detail, h.rejectEvent(event, reason)
+	}
+
+	return detail, nil
+}
+
+// HandleCreateDBInstanceCall tags a replica as soon as Application Auto Scaling calls CreateDBInstance,
+// before RDS-EVENT-0005 is emitted when the instance becomes available.
+func (h *Handler) HandleCreateDBInstanceCall(ctx context.Context, event events.CloudWatchEvent) (*Result, error) {
+	return h.process(ctx, event, h.handleCreateDBInstanceCall)
+}
+
+// handleCreateDBInstanceCall applies tags for a single CreateDBInstance call and records the decision in result.
+func (h *Handler) handleCreateDBInstanceCall(event events.CloudWatchEvent, result *Result) error {
+	expectedClusterID, tagsMap, err := h.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	detail, err := h.decodeCloudTrailEvent(event, "CreateDBInstance")
+	if err != nil {
+		if errors.Is(err, ErrEventRejected) {
+			result.Outcome = OutcomeRejected
+			result.Reason = err.Error()
+		}
+
+		return err
+	}
+
+	var call createDBInstanceCall
+	if err := json.Unmarshal(detail.RequestParameters, &call.Request); err != nil {
+		return fmt.Errorf("failed to decode CreateDBInstance request parameters: %w", err)
+	}
+
+	dbInstanceID := call.Request.DBInstanceIdentifier
+	result.DBInstanceIdentifier = dbInstanceID
+	result.ClusterIdentifier = call.Request.DBClusterIdentifier
+	result.Message = fmt.Sprintf("%s called by %s", detail.EventName, describeCaller(detail.UserIdentity))
+	h.logger.Printf("Received %s call for DB instance %s by %s", detail.EventName, dbInstanceID, describeCaller(detail.UserIdentity))
+
+	result.Outcome = OutcomeSkipped
+
+	switch {
+	case detail.ErrorCode != "":
+		result.Reason = fmt.Sprintf("call failed with %s", detail.ErrorCode)
+	case !detail.UserIdentity.isApplicationAutoScaling():
+		result.Reason = "not called by application autoscaling"
+	case !isAutoscaledReplica(dbInstanceID):
+		result.Reason = "not an autoscaled replica"
+	case call.Request.DBClusterIdentifier != expectedClusterID:
+		result.Reason = fmt.Sprintf("not a member of cluster %s", expectedClusterID)
+	}
+
+	if result.Reason != "" {
+		h.logger.Printf("Skipping %s call for DB instance %s: %s", detail.EventName, dbInstanceID, result.Reason)
+		return nil
+	}
+
+	if len(detail.ResponseElements) > 0 {
+		if err := json.Unmarshal(detail.ResponseElements, &call.Response); err != nil {
+			return fmt.Errorf("failed to decode CreateDBInstance response elements: %w", err)
+		}
+	}
+
+	// The payload can be crafted, so the ARN it reports must be the instance in the account and region of the event.
+	if call.Response.DBInstanceArn != "" {
+		if reason := resourceArnMismatch(event, call.Response.DBInstanceArn, "db:"+dbInstanceID); reason != "" {
+			err := h.rejectEvent(event, reason)
+			result.Outcome = OutcomeRejected
+			result.Reason = err.Error()
+
+			return err
+		}
+	}
+
+	// The cluster from the request parameters is confirmed with RDS, which also provides the ARN to tag.
+	instance, err := h.describeInstanceWhenExists(dbInstanceID)
+	if err != nil {
+		h.logger.Printf("Error describing DB instance %s: %v", dbInstanceID, err)
+		return err
+	}
+
+	if clusterID := aws.StringValue(instance.DBClusterIdentifier); clusterID != expectedClusterID {
+		result.ClusterIdentifier = clusterID
+		result.Reason = fmt.Sprintf("not a member of cluster %s", expectedClusterID)
+		h.logger.Printf("Skipping %s call for DB instance %s: %s", detail.EventName, dbInstanceID, result.Reason)
+
+		return nil
+	}
+
+	arn := aws.StringValue(instance.DBInstanceArn)
+	result.DBInstanceArn = arn
+	result.Outcome = OutcomeTagged
+
+	return h.applyTagsWhenExists(dbInstanceID, arn, tagsMap, result)
+}
+
+// describeInstanceWhenExists describes an instance, retrying while it is not yet visible to the API.
+func (h *Handler) describeInstanceWhenExists(dbInstanceID string) (*rds.DBInstance, error) {
+	var err error
+
+	for attempt := 1; attempt <= h.resourceWaitAttempts; attempt++ {
+		if attempt > 1 {
+			if err := h.wait(h.resourceWaitDelay); err != nil {
+				return nil, err
+			}
+		}
+
+		var output *rds.DescribeDBInstancesOutput
+
+		output, err = h.rds.DescribeDBInstances(&rds.DescribeDBInstancesInput{DBInstanceIdentifier: aws.String(dbInstanceID)})
+
+		switch {
+		case err == nil && len(output.DBInstances) > 0:
+			return output.DBInstances[0], nil
+		case err == nil:
+			err = fmt.Errorf("no DB instance found with ID: %s", dbInstanceID)
+		case !isNotFound(err):
+			return nil, fmt.Errorf("failed to describe DB instance %s: %w", dbInstanceID, err)
+		}
+	}
+
+	return nil, fmt.Errorf("DB instance %s did not appear: %w", dbInstanceID, err)
+}
+
+// applyTagsWhenExists applies tags, retrying while the instance is not yet visible to the tagging API.
+func (h *Handler) applyTagsWhenExists(dbInstanceID, arn string, tagsMap map[string]string, result *Result) error {
+	var err error
+
+	for attempt := 1; attempt <= h.resourceWaitAttempts; attempt++ {
+		if attempt > 1 {
+			if err := h.wait(h.resourceWaitDelay); err != nil {
+				return err
+			}
+		}
+
+		err = h.applyTags(dbInstanceID, arn, tagsMap, result)
+		if !isNotFound(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// isNotFound reports whether the AWS error means the RDS resource does not exist.
+func isNotFound(err error) bool {
+	var awsErr awserr.Error
+
+	return errors.As(err, &awsErr) &&
+		(awsErr.Code() == rds.ErrCodeDBInstanceNotFoundFault || awsErr.Code() == rds.ErrCodeDBClusterNotFoundFault)
+}
+
+// containsString reports whether values contains value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// describeCaller returns a readable name of the CloudTrail caller for logs.
+func describeCaller(identity UserIdentity) string {
+	if identity.ARN != "" {
+		return identity.ARN
+	}
+
+	return strings.TrimSpace(identity.Type + " " + identity.PrincipalID)
+}
@@ -0,0 +1,220 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createDBInstanceEvent builds a CloudTrail CreateDBInstance event with the given caller and instance.
+func createDBInstanceEvent(identity, instanceID, clusterID, errorCode string) events.CloudWatchEvent {
+	detail := map[string]interface{}{
+		"eventID":      "hypnotoad",
+		"eventName":    "CreateDBInstance",
+		"eventSource":  "rds.amazonaws.com",
+		"eventTime":    "3000-01-01T00:00:00Z",
+		"awsRegion":    "us-east-1",
+		"userIdentity": json.RawMessage(identity),
+		"requestParameters": map[string]string{
+			"dBInstanceIdentifier": instanceID,
+			"dBClusterIdentifier":  clusterID,
+		},
+		"responseElements": map[string]string{
+			"dBInstanceArn": "arn:aws:rds:us-east-1:123456789012:db:" + instanceID,
+		},
+	}
+	if errorCode != "" {
+		detail["errorCode"] = errorCode
+	}
+
+	raw, _ := json.Marshal(detail)
+
+	return events.CloudWatchEvent{
+		ID:         "all-glory-to-the-hypnotoad",
+		Source:     "aws.rds",
+		DetailType: "AWS API Call via CloudTrail",
+		AccountID:  "123456789012",
+		Region:     "us-east-1",
+		Detail:     raw,
+	}
+}
+
+// TestHandler_HandleCreateDBInstanceCall covers tagging on the CreateDBInstance call itself. Nothing in the payload is
+// trusted, the ARN must match the event and the cluster is confirmed with RDS.
+// Only Application Auto Scaling may order new crew members for the Planet Express ship.
+func TestHandler_HandleCreateDBInstanceCall(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	const (
+		autoscaling = `{"type": "AssumedRole", "arn": "arn:aws:sts::123456789012:assumed-role/AWSServiceRoleForApplicationAutoScaling_RDSCluster/AutoScaling",
+			"invokedBy": "application-autoscaling.amazonaws.com",
+			"sessionContext": {"sessionIssuer": {"userName": "AWSServiceRoleForApplicationAutoScaling_RDSCluster"}}}`
+		human = `{"type": "IAMUser", "arn": "arn:aws:iam::123456789012:user/zapp-brannigan"}`
+	)
+
+	tests := []struct {
+		name        string
+		event       events.CloudWatchEvent
+		notFound    int
+		cluster     string
+		wantOutcome Outcome
+		wantTagged  string
+		wantErr     error
+	}{
+		{
+			name:        "autoscaled replica is tagged",
+			event:       createDBInstanceEvent(autoscaling, "application-autoscaling-fry", "planet-express", ""),
+			wantOutcome: OutcomeTagged,
+			wantTagged:  "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry",
+		},
+		{
+			name:        "tagging waits for the instance to appear",
+			event:       createDBInstanceEvent(autoscaling, "application-autoscaling-fry", "planet-express", ""),
+			notFound:    2,
+			wantOutcome: OutcomeTagged,
+			wantTagged:  "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry",
+		},
+		{
+			name:        "instance never appears",
+			event:       createDBInstanceEvent(autoscaling, "application-autoscaling-fry", "planet-express", ""),
+			notFound:    10,
+			wantOutcome: OutcomeFailed,
+		},
+		{
+			name:        "request parameters claim the wrong cluster",
+			event:       createDBInstanceEvent(autoscaling, "application-autoscaling-kif", "planet-express", ""),
+			cluster:     "nimbus",
+			wantOutcome: OutcomeSkipped,
+		},
+		{
+			name: "response ARN of another instance",
+			event: func() events.CloudWatchEvent {
+				e := createDBInstanceEvent(autoscaling, "application-autoscaling-fry", "planet-express", "")
+				e.Detail = []byte(strings.Replace(string(e.Detail), "db:application-autoscaling-fry", "db:planet-express-writer", 1))
+
+				return e
+			}(),
+			wantOutcome: OutcomeRejected,
+			wantErr:     ErrEventRejected,
+		},
+		{
+			name: "response ARN from another account",
+			event: func() events.CloudWatchEvent {
+				e := createDBInstanceEvent(autoscaling, "application-autoscaling-fry", "planet-express", "")
+				e.Detail = []byte(strings.Replace(string(e.Detail), "123456789012:db:", "666666666666:db:", 1))
+
+				return e
+			}(),
+			wantOutcome: OutcomeRejected,
+			wantErr:     ErrEventRejected,
+		},
+		{
+			name:        "instance created by a human",
+			event:       createDBInstanceEvent(human, "application-autoscaling-fry", "planet-express", ""),
+			wantOutcome: OutcomeSkipped,
+		},
+		{
+			name:        "failed call",
+			event:       createDBInstanceEvent(autoscaling, "application-autoscaling-fry", "planet-express", "InsufficientDBInstanceCapacity"),
+			wantOutcome: OutcomeSkipped,
+		},
+		{
+			name:        "replica of another cluster",
+			event:       createDBInstanceEvent(autoscaling, "application-autoscaling-kif", "nimbus", ""),
+			wantOutcome: OutcomeSkipped,
+		},
+		{
+			name: "other API call",
+			event: func() events.CloudWatchEvent {
+				e := createDBInstanceEvent(autoscaling, "application-autoscaling-fry", "planet-express", "")
+				e.Detail = []byte(`{"eventName": "DeleteDBInstance", "eventSource": "rds.amazonaws.com"}`)
+
+				return e
+			}(),
+			wantOutcome: OutcomeRejected,
+			wantErr:     ErrEventRejected,
+		},
+		{
+			name: "foreign account",
+			event: func() events.CloudWatchEvent {
+				e := createDBInstanceEvent(autoscaling, "application-autoscaling-fry", "planet-express", "")
+				e.AccountID = "666666666666"
+
+				return e
+			}(),
+			wantOutcome: OutcomeRejected,
+			wantErr:     ErrEventRejected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardLogs(t)
+
+			var (
+				attempts  int
+				taggedArn string
+			)
+
+			cluster := tt.cluster
+			if cluster == "" {
+				cluster = "planet-express"
+			}
+
+			mock := &mockRDS{
+				describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+					attempts++
+					if attempts <= tt.notFound {
+						return nil, awserr.New(rds.ErrCodeDBInstanceNotFoundFault, "DBInstance not found", nil)
+					}
+
+					id := aws.StringValue(input.DBInstanceIdentifier)
+
+					return &rds.DescribeDBInstancesOutput{
+						DBInstances: []*rds.DBInstance{
+							{
+								DBInstanceIdentifier: aws.String(id),
+								DBInstanceArn:        aws.String("arn:aws:rds:us-east-1:123456789012:db:" + id),
+								DBClusterIdentifier:  aws.String(cluster),
+							},
+						},
+					}, nil
+				},
+				addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+					taggedArn = aws.StringValue(input.ResourceName)
+					return &rds.AddTagsToResourceOutput{}, nil
+				},
+			}
+
+			// The unconfigured STS mock fails the invocation if the account is looked up.
+			handler := NewHandler(logrus.New(), mock, &mockSTS{}, WithAllowedAccounts("123456789012"))
+			handler.sleep = func(time.Duration) {}
+
+			result, err := handler.HandleCreateDBInstanceCall(context.Background(), tt.event)
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantOutcome == OutcomeFailed:
+				assert.Error(t, err)
+				assert.Equal(t, handler.resourceWaitAttempts, attempts)
+			default:
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantOutcome, result.Outcome)
+			assert.Equal(t, tt.wantTagged, taggedArn)
+		})
+	}
+}
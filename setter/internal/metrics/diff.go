@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// missingTags returns the desired tags whose keys are not present in current.
+func missingTags(desired, current map[string]string) map[string]string {
+	missing := make(map[string]string)
+
+	for k, v := range desired {
+		if _, ok := current[k]; !ok {
+			missing[k] = v
+		}
+	}
+
+	return missing
+}
+
+// changedTags returns the desired tags that are missing from current or have a different value there.
+func changedTags(desired, current map[string]string) map[string]string {
+	changed := make(map[string]string)
+
+	for k, v := range desired {
+		if got, ok := current[k]; !ok || got != v {
+			changed[k] = v
+		}
+	}
+
+	return changed
+}
+
+// tagListToMap converts an RDS tag list into a map.
+func tagListToMap(list []*rds.Tag) map[string]string {
+	tags := make(map[string]string, len(list))
+	for _, tag := range list {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	return tags
+}
@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+)
+
+const (
+	// DomainEventSource is the source of the domain events published by the handler.
+	DomainEventSource = "rds-tag-setter"
+	// DomainEventReplicaTagged is the detail type of the event published after a replica was tagged.
+	DomainEventReplicaTagged = "Replica Tagged"
+	// ReplicaTaggedSchemaVersion is the version of the ReplicaTaggedDetail schema. It changes only when fields
+	// are removed or change meaning, new optional fields are added without a new version.
+	ReplicaTaggedSchemaVersion = "1"
+)
+
+// ReplicaTaggedDetail is the detail of the "Replica Tagged" domain event, see the README for the schema.
+type ReplicaTaggedDetail struct {
+	SchemaVersion        string               `json:"schema_version"`
+	DBInstanceIdentifier string               `json:"db_instance_identifier"`
+	DBInstanceArn        string               `json:"db_instance_arn"`
+	ClusterIdentifier    string               `json:"cluster_identifier"`
+	TagsApplied          map[string]string    `json:"tags_applied"`
+	Diff                 map[string]TagChange `json:"diff"`
+	ScalingCause         string               `json:"scaling_cause,omitempty"`
+	RequestID            string               `json:"request_id,omitempty"`
+	EventID              string               `json:"event_id,omitempty"`
+	TaggedAt             time.Time            `json:"tagged_at"`
+}
+
+// TagChange is the value of a tag before and after tagging, Old is nil when the tag was added.
+type TagChange struct {
+	Old *string `json:"old"`
+	New string  `json:"new"`
+}
+
+// tagDiff returns the changes the applied tags made to the tags before, tags written with their current value
+// are left out.
+func tagDiff(before, applied map[string]string) map[string]TagChange {
+	diff := make(map[string]TagChange)
+
+	for k, v := range applied {
+		old, ok := before[k]
+
+		switch {
+		case !ok:
+			diff[k] = TagChange{New: v}
+		case old != v:
+			diff[k] = TagChange{Old: aws.String(old), New: v}
+		}
+	}
+
+	return diff
+}
+
+// publishReplicaTagged sends the "Replica Tagged" event for the tags just applied to the instance. Failures are
+// logged and counted but do not fail the event, the tags are on the replica already.
+func (h *Handler) publishReplicaTagged(dbInstanceID, arn string, before, applied map[string]string, result *Result) {
+	detail := ReplicaTaggedDetail{
+		SchemaVersion:        ReplicaTaggedSchemaVersion,
+		DBInstanceIdentifier: dbInstanceID,
+		DBInstanceArn:        arn,
+		ClusterIdentifier:    result.ClusterIdentifier,
+		TagsApplied:          applied,
+		Diff:                 tagDiff(before, applied),
+		ScalingCause:         h.scalingCause(result.ClusterIdentifier),
+		RequestID:            h.requestID,
+		EventID:              result.EventID,
+		TaggedAt:             h.now().UTC(),
+	}
+
+	if err := h.putDomainEvent(DomainEventReplicaTagged, arn, detail); err != nil {
+		h.recorder.Inc(MetricDomainEventFailed)
+		h.logger.Printf("Error publishing replica tagged event for DB instance %s: %v", dbInstanceID, err)
+
+		return
+	}
+
+	h.logger.Printf("Published replica tagged event for DB instance %s to event bus %s", dbInstanceID, h.eventBusName)
+}
+
+// putDomainEvent sends a single event about resource to the configured event bus.
+func (h *Handler) putDomainEvent(detailType, resource string, detail interface{}) error {
+	raw, err := json.Marshal(detail)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", detailType, err)
+	}
+
+	output, err := h.eventBridge.PutEvents(&eventbridge.PutEventsInput{
+		Entries: []*eventbridge.PutEventsRequestEntry{{
+			EventBusName: aws.String(h.eventBusName),
+			Source:       aws.String(DomainEventSource),
+			DetailType:   aws.String(detailType),
+			Detail:       aws.String(string(raw)),
+			Resources:    aws.StringSlice([]string{resource}),
+			Time:         aws.Time(h.now()),
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put %s event: %w", detailType, err)
+	}
+
+	if aws.Int64Value(output.FailedEntryCount) > 0 {
+		for _, entry := range output.Entries {
+			if entry.ErrorCode != nil {
+				return fmt.Errorf("%s event rejected: %s: %s", detailType,
+					aws.StringValue(entry.ErrorCode), aws.StringValue(entry.ErrorMessage))
+			}
+		}
+
+		return fmt.Errorf("%s event rejected", detailType)
+	}
+
+	return nil
+}
+
+// scalingCause returns the cause of the latest scaling activity of the read replicas of the cluster, or an
+// empty string when it is unknown.
+func (h *Handler) scalingCause(clusterID string) string {
+	if h.scalingActivities == nil || clusterID == "" {
+		return ""
+	}
+
+	output, err := h.scalingActivities.DescribeScalingActivities(&applicationautoscaling.DescribeScalingActivitiesInput{
+		ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceRds),
+		ScalableDimension: aws.String(applicationautoscaling.ScalableDimensionRdsClusterReadReplicaCount),
+		ResourceId:        aws.String("cluster:" + clusterID),
+		MaxResults:        aws.Int64(1),
+	})
+	if err != nil {
+		h.logger.Printf("Error describing scaling activities of cluster %s: %v", clusterID, err)
+		return ""
+	}
+
+	if len(output.ScalingActivities) == 0 {
+		return ""
+	}
+
+	return aws.StringValue(output.ScalingActivities[0].Cause)
+}
@@ -0,0 +1,310 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTagDiff checks that only added and changed tags are reported.
+func TestTagDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  map[string]string
+		applied map[string]string
+		want    map[string]TagChange
+	}{
+		{
+			name:    "tags added",
+			applied: map[string]string{"Owner": "professor-farnsworth"},
+			want:    map[string]TagChange{"Owner": {New: "professor-farnsworth"}},
+		},
+		{
+			name:    "tag changed",
+			before:  map[string]string{"Owner": "bender", "Ship": "planet-express-ship"},
+			applied: map[string]string{"Owner": "professor-farnsworth"},
+			want:    map[string]TagChange{"Owner": {Old: aws.String("bender"), New: "professor-farnsworth"}},
+		},
+		{
+			name:    "tag written with its value",
+			before:  map[string]string{"Owner": "professor-farnsworth"},
+			applied: map[string]string{"Owner": "professor-farnsworth"},
+			want:    map[string]TagChange{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tagDiff(tt.before, tt.applied))
+		})
+	}
+}
+
+// TestHandler_PublishReplicaTagged covers the "Replica Tagged" event sent after a new replica is tagged.
+// Every new crew member is announced over the Planet Express intercom, whether anybody listens or not.
+func TestHandler_PublishReplicaTagged(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth","Purpose":"delivery-company"}`)
+
+	taggedAt := time.Date(3000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		current    map[string]string
+		activities *mockApplicationAutoScaling
+		putErr     error
+		failed     bool
+		wantDetail *ReplicaTaggedDetail
+		wantFailed int
+	}{
+		{
+			name:    "new and changed tags",
+			current: map[string]string{"Owner": "bender"},
+			wantDetail: &ReplicaTaggedDetail{
+				Diff: map[string]TagChange{
+					"Owner":   {Old: aws.String("bender"), New: "professor-farnsworth"},
+					"Purpose": {New: "delivery-company"},
+				},
+			},
+		},
+		{
+			name: "scaling cause included",
+			activities: &mockApplicationAutoScaling{
+				describeScalingActivitiesFunc: func(input *applicationautoscaling.DescribeScalingActivitiesInput) (*applicationautoscaling.DescribeScalingActivitiesOutput, error) {
+					assert.Equal(t, "cluster:planet-express", aws.StringValue(input.ResourceId))
+
+					return &applicationautoscaling.DescribeScalingActivitiesOutput{
+						ScalingActivities: []*applicationautoscaling.ScalingActivity{{
+							Cause: aws.String("monitor alarm delivery-backlog in state ALARM triggered policy crew-size"),
+						}},
+					}, nil
+				},
+			},
+			wantDetail: &ReplicaTaggedDetail{
+				Diff: map[string]TagChange{
+					"Owner":   {New: "professor-farnsworth"},
+					"Purpose": {New: "delivery-company"},
+				},
+				ScalingCause: "monitor alarm delivery-backlog in state ALARM triggered policy crew-size",
+			},
+		},
+		{
+			name: "unknown scaling cause",
+			activities: &mockApplicationAutoScaling{
+				describeScalingActivitiesFunc: func(*applicationautoscaling.DescribeScalingActivitiesInput) (*applicationautoscaling.DescribeScalingActivitiesOutput, error) {
+					return nil, errors.New("the scheduling office is closed")
+				},
+			},
+			wantDetail: &ReplicaTaggedDetail{
+				Diff: map[string]TagChange{
+					"Owner":   {New: "professor-farnsworth"},
+					"Purpose": {New: "delivery-company"},
+				},
+			},
+		},
+		{
+			name:       "event bus unavailable",
+			putErr:     errors.New("intercom broken"),
+			wantFailed: 1,
+		},
+		{
+			name:       "event rejected",
+			failed:     true,
+			wantFailed: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardLogs(t)
+
+			var put *eventbridge.PutEventsInput
+
+			rdsMock := &mockRDS{
+				describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+					return &rds.DescribeDBInstancesOutput{DBInstances: []*rds.DBInstance{{
+						DBClusterIdentifier: aws.String("planet-express"),
+						DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+					}}}, nil
+				},
+				listTagsForResourceFunc: func(input *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+					return &rds.ListTagsForResourceOutput{TagList: rdsTags(tt.current)}, nil
+				},
+				addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+					return &rds.AddTagsToResourceOutput{}, nil
+				},
+			}
+			eventsMock := &mockEventBridge{
+				putEventsFunc: func(input *eventbridge.PutEventsInput) (*eventbridge.PutEventsOutput, error) {
+					put = input
+
+					if tt.failed {
+						return &eventbridge.PutEventsOutput{
+							FailedEntryCount: aws.Int64(1),
+							Entries: []*eventbridge.PutEventsResultEntry{{
+								ErrorCode:    aws.String("InternalFailure"),
+								ErrorMessage: aws.String("the intercom only plays Hypnotoad"),
+							}},
+						}, nil
+					}
+
+					return &eventbridge.PutEventsOutput{FailedEntryCount: aws.Int64(0)}, tt.putErr
+				},
+			}
+
+			var activities ApplicationAutoScalingAPI
+			if tt.activities != nil {
+				activities = tt.activities
+			}
+
+			recorder := &countingRecorder{}
+			handler := NewHandler(logrus.New(), rdsMock, &mockSTS{}, WithRecorder(recorder),
+				WithDomainEvents(eventsMock, "planet-express-bus", activities))
+			handler.now = func() time.Time { return taggedAt }
+
+			ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "good-news-everyone"})
+
+			result, err := handler.HandleRequest(ctx, instanceEvent("RDS-EVENT-0005", "application-autoscaling-fry"))
+			require.NoError(t, err)
+			assert.Equal(t, OutcomeTagged, result.Outcome)
+			assert.Equal(t, tt.wantFailed, recorder.counts[MetricDomainEventFailed])
+
+			require.NotNil(t, put)
+			require.Len(t, put.Entries, 1)
+
+			entry := put.Entries[0]
+			assert.Equal(t, "planet-express-bus", aws.StringValue(entry.EventBusName))
+			assert.Equal(t, DomainEventSource, aws.StringValue(entry.Source))
+			assert.Equal(t, DomainEventReplicaTagged, aws.StringValue(entry.DetailType))
+			assert.Equal(t, []string{"arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"}, aws.StringValueSlice(entry.Resources))
+
+			if tt.wantDetail == nil {
+				return
+			}
+
+			want := *tt.wantDetail
+			want.SchemaVersion = ReplicaTaggedSchemaVersion
+			want.DBInstanceIdentifier = "application-autoscaling-fry"
+			want.DBInstanceArn = "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"
+			want.ClusterIdentifier = "planet-express"
+			want.TagsApplied = map[string]string{"Owner": "professor-farnsworth", "Purpose": "delivery-company"}
+			want.RequestID = "good-news-everyone"
+			want.EventID = "slurm-application-autoscaling-fry"
+			want.TaggedAt = taggedAt
+
+			var got ReplicaTaggedDetail
+			require.NoError(t, json.Unmarshal([]byte(aws.StringValue(entry.Detail)), &got))
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+// TestHandler_PublishReplicaTagged_Disabled verifies tags are not read before writing when events are disabled.
+func TestHandler_PublishReplicaTagged_Disabled(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+	discardLogs(t)
+
+	rdsMock := &mockRDS{
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			return &rds.DescribeDBInstancesOutput{DBInstances: []*rds.DBInstance{{
+				DBClusterIdentifier: aws.String("planet-express"),
+				DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+			}}}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+	}
+
+	result, err := NewHandler(logrus.New(), rdsMock, &mockSTS{}).HandleRequest(context.Background(),
+		instanceEvent("RDS-EVENT-0005", "application-autoscaling-fry"))
+	require.NoError(t, err)
+	assert.Equal(t, OutcomeTagged, result.Outcome)
+}
+
+// TestHandler_PublishReplicaTagged_AfterVerification verifies the domain event is only published once the tags
+// read back as written. Nobody celebrates a delivery before the package is signed for.
+func TestHandler_PublishReplicaTagged_AfterVerification(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	tests := []struct {
+		name          string
+		consistent    bool
+		wantPublished bool
+	}{
+		{
+			name:          "tags read back as written",
+			consistent:    true,
+			wantPublished: true,
+		},
+		{
+			name: "tags never read back",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardLogs(t)
+
+			written := false
+			published := false
+
+			rdsMock := &mockRDS{
+				describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+					return &rds.DescribeDBInstancesOutput{DBInstances: []*rds.DBInstance{{
+						DBClusterIdentifier: aws.String("planet-express"),
+						DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+					}}}, nil
+				},
+				listTagsForResourceFunc: func(input *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+					// Publishing before the read-back would already see the write recorded.
+					assert.False(t, published, "domain event published before the tags were verified")
+
+					if written && tt.consistent {
+						return &rds.ListTagsForResourceOutput{TagList: rdsTags(map[string]string{"Owner": "professor-farnsworth"})}, nil
+					}
+
+					return &rds.ListTagsForResourceOutput{}, nil
+				},
+				addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+					written = true
+					return &rds.AddTagsToResourceOutput{}, nil
+				},
+			}
+			eventsMock := &mockEventBridge{
+				putEventsFunc: func(input *eventbridge.PutEventsInput) (*eventbridge.PutEventsOutput, error) {
+					published = true
+					return &eventbridge.PutEventsOutput{FailedEntryCount: aws.Int64(0)}, nil
+				},
+			}
+
+			handler := NewHandler(logrus.New(), rdsMock, &mockSTS{}, WithTagVerification(2, time.Millisecond),
+				WithDomainEvents(eventsMock, "planet-express-bus", nil))
+			handler.sleep = func(time.Duration) {}
+
+			result, err := handler.HandleRequest(context.Background(), instanceEvent("RDS-EVENT-0005", "application-autoscaling-fry"))
+			if tt.consistent {
+				require.NoError(t, err)
+				assert.Equal(t, OutcomeTagged, result.Outcome)
+			} else {
+				require.ErrorIs(t, err, ErrTagVerificationFailed)
+				assert.Equal(t, OutcomeFailed, result.Outcome)
+			}
+
+			assert.Equal(t, tt.wantPublished, published)
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// rdsEndpointTypeCustom is the endpoint type of custom endpoints, cluster endpoints cannot be modified.
+const rdsEndpointTypeCustom = "CUSTOM"
+
+// EndpointTagRule selects custom endpoints carrying a tag with the given key and value.
+type EndpointTagRule struct {
+	Key   string
+	Value string
+}
+
+// ParseEndpointTagRule parses a rule of the form key=value.
+func ParseEndpointTagRule(raw string) (EndpointTagRule, error) {
+	key, value, ok := strings.Cut(raw, "=")
+	if !ok || key == "" {
+		return EndpointTagRule{}, fmt.Errorf("endpoint tag rule must be key=value, got %q", raw)
+	}
+
+	return EndpointTagRule{Key: key, Value: value}, nil
+}
+
+// customEndpointsEnabled reports whether replicas are added to custom endpoints.
+func (h *Handler) customEndpointsEnabled() bool {
+	return len(h.customEndpoints) > 0 || h.endpointTagRule != nil
+}
+
+// selectCustomEndpoints returns the identifiers of the custom endpoints of the cluster that are configured by name
+// or match the tag rule.
+func (h *Handler) selectCustomEndpoints(clusterID string) ([]string, error) {
+	input := &rds.DescribeDBClusterEndpointsInput{DBClusterIdentifier: aws.String(clusterID)}
+
+	var selected []string
+
+	for {
+		output, err := h.rds.DescribeDBClusterEndpoints(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe endpoints of cluster %s: %w", clusterID, err)
+		}
+
+		for _, endpoint := range output.DBClusterEndpoints {
+			if aws.StringValue(endpoint.EndpointType) != rdsEndpointTypeCustom {
+				continue
+			}
+
+			id := aws.StringValue(endpoint.DBClusterEndpointIdentifier)
+
+			match := h.customEndpoints[id]
+			if !match && h.endpointTagRule != nil {
+				tags, err := h.listTags(aws.StringValue(endpoint.DBClusterEndpointArn))
+				if err != nil {
+					return nil, err
+				}
+
+				value, ok := tags[h.endpointTagRule.Key]
+				match = ok && value == h.endpointTagRule.Value
+			}
+
+			if match {
+				selected = append(selected, id)
+			}
+		}
+
+		if aws.StringValue(output.Marker) == "" {
+			return selected, nil
+		}
+
+		input.Marker = output.Marker
+	}
+}
+
+// joinCustomEndpoints adds the replica to the static members of the selected custom endpoints of the cluster.
+func (h *Handler) joinCustomEndpoints(clusterID, dbInstanceID string, result *Result) error {
+	if !h.customEndpointsEnabled() {
+		return nil
+	}
+
+	return h.updateCustomEndpoints(clusterID, dbInstanceID, true, result)
+}
+
+// updateCustomEndpoints adds the instance to or removes it from the static members of the selected custom
+// endpoints, and records the endpoints that changed in result.
+func (h *Handler) updateCustomEndpoints(clusterID, dbInstanceID string, add bool, result *Result) error {
+	endpoints, err := h.selectCustomEndpoints(clusterID)
+	if err != nil {
+		return err
+	}
+
+	for _, endpointID := range endpoints {
+		changed, err := h.updateStaticMembers(endpointID, dbInstanceID, add)
+		if err != nil {
+			h.logger.Printf("Error updating custom endpoint %s for DB instance %s: %v", endpointID, dbInstanceID, err)
+			return err
+		}
+
+		if changed {
+			result.Endpoints = append(result.Endpoints, endpointID)
+		}
+	}
+
+	return nil
+}
+
+// updateStaticMembers adds the instance to or removes it from the static members of the endpoint and reports
+// whether the endpoint was modified. ModifyDBClusterEndpoint replaces the whole list, so a concurrent
+// modification can undo the change. The endpoint is read again after each change until it shows the wanted
+// membership, and changes are only made while it is available.
+func (h *Handler) updateStaticMembers(endpointID, dbInstanceID string, add bool) (bool, error) {
+	changed := false
+
+	for attempt := 1; ; attempt++ {
+		endpoint, err := h.describeClusterEndpoint(endpointID)
+		if err != nil {
+			return changed, err
+		}
+
+		members := aws.StringValueSlice(endpoint.StaticMembers)
+
+		switch {
+		case len(members) == 0 && add:
+			// Endpoints without static members include every instance that is not excluded.
+			h.logger.Printf("Custom endpoint %s has no static members, DB instance %s is included already", endpointID, dbInstanceID)
+			return changed, nil
+		case containsString(members, dbInstanceID) == add:
+			return changed, nil
+		case len(members) == 1 && !add:
+			// An empty list would turn the endpoint into one including every instance.
+			h.logger.Printf("DB instance %s is the only static member of custom endpoint %s, leaving it as is", dbInstanceID, endpointID)
+			return changed, nil
+		case attempt > h.resourceWaitAttempts:
+			return changed, fmt.Errorf("custom endpoint %s still not updated after %d attempts", endpointID, h.resourceWaitAttempts)
+		case aws.StringValue(endpoint.Status) != "available":
+			h.logger.Printf("Custom endpoint %s is %s, waiting %s (attempt %d/%d)",
+				endpointID, aws.StringValue(endpoint.Status), h.resourceWaitDelay, attempt, h.resourceWaitAttempts)
+			if err := h.wait(h.resourceWaitDelay); err != nil {
+				return changed, err
+			}
+
+			continue
+		}
+
+		_, err = h.rds.ModifyDBClusterEndpoint(&rds.ModifyDBClusterEndpointInput{
+			DBClusterEndpointIdentifier: aws.String(endpointID),
+			StaticMembers:               aws.StringSlice(withMember(members, dbInstanceID, add)),
+		})
+
+		var awsErr awserr.Error
+
+		switch {
+		case errors.As(err, &awsErr) && awsErr.Code() == rds.ErrCodeInvalidDBClusterEndpointStateFault:
+			// Another modification started since the endpoint was read.
+			h.logger.Printf("Custom endpoint %s is being modified, retrying in %s (attempt %d/%d)",
+				endpointID, h.resourceWaitDelay, attempt, h.resourceWaitAttempts)
+		case err != nil:
+			return changed, fmt.Errorf("failed to modify custom endpoint %s: %w", endpointID, err)
+		default:
+			changed = true
+
+			if add {
+				h.logger.Printf("Added DB instance %s to custom endpoint %s", dbInstanceID, endpointID)
+			} else {
+				h.logger.Printf("Removed DB instance %s from custom endpoint %s", dbInstanceID, endpointID)
+			}
+		}
+
+		if err := h.wait(h.resourceWaitDelay); err != nil {
+			return changed, err
+		}
+	}
+}
+
+// describeClusterEndpoint returns the current state of a custom endpoint.
+func (h *Handler) describeClusterEndpoint(endpointID string) (*rds.DBClusterEndpoint, error) {
+	output, err := h.rds.DescribeDBClusterEndpoints(&rds.DescribeDBClusterEndpointsInput{
+		DBClusterEndpointIdentifier: aws.String(endpointID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe custom endpoint %s: %w", endpointID, err)
+	}
+
+	if len(output.DBClusterEndpoints) == 0 {
+		return nil, fmt.Errorf("custom endpoint %s not found", endpointID)
+	}
+
+	return output.DBClusterEndpoints[0], nil
+}
+
+// withMember returns a copy of members with the instance added or removed.
+func withMember(members []string, dbInstanceID string, add bool) []string {
+	if add {
+		return append(append([]string(nil), members...), dbInstanceID)
+	}
+
+	var kept []string
+
+	for _, member := range members {
+		if member != dbInstanceID {
+			kept = append(kept, member)
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,287 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEndpoints simulates the custom endpoints of the Planet Express cluster.
+type fakeEndpoints struct {
+	endpoints []*rds.DBClusterEndpoint
+	tags      map[string]map[string]string
+	modified  int
+	// beforeModify runs before each modification is applied, it returns an error to fail the call.
+	beforeModify func(endpoint *rds.DBClusterEndpoint) error
+}
+
+// endpoint returns the endpoint with the given identifier.
+func (f *fakeEndpoints) endpoint(id string) *rds.DBClusterEndpoint {
+	for _, endpoint := range f.endpoints {
+		if aws.StringValue(endpoint.DBClusterEndpointIdentifier) == id {
+			return endpoint
+		}
+	}
+
+	return nil
+}
+
+// mock returns an RDS mock serving the endpoints, the cluster members and their tags.
+func (f *fakeEndpoints) mock() *mockRDS {
+	return &mockRDS{
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			return &rds.DescribeDBInstancesOutput{
+				DBInstances: []*rds.DBInstance{
+					{
+						DBClusterIdentifier: aws.String("planet-express"),
+						DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:" + aws.StringValue(input.DBInstanceIdentifier)),
+					},
+				},
+			}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+		listTagsForResourceFunc: func(input *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+			return &rds.ListTagsForResourceOutput{TagList: rdsTags(f.tags[aws.StringValue(input.ResourceName)])}, nil
+		},
+		describeDBClusterEndpointsFunc: func(input *rds.DescribeDBClusterEndpointsInput) (*rds.DescribeDBClusterEndpointsOutput, error) {
+			if id := aws.StringValue(input.DBClusterEndpointIdentifier); id != "" {
+				endpoint := *f.endpoint(id)
+				return &rds.DescribeDBClusterEndpointsOutput{DBClusterEndpoints: []*rds.DBClusterEndpoint{&endpoint}}, nil
+			}
+
+			return &rds.DescribeDBClusterEndpointsOutput{DBClusterEndpoints: f.endpoints}, nil
+		},
+		modifyDBClusterEndpointFunc: func(input *rds.ModifyDBClusterEndpointInput) (*rds.ModifyDBClusterEndpointOutput, error) {
+			endpoint := f.endpoint(aws.StringValue(input.DBClusterEndpointIdentifier))
+
+			if f.beforeModify != nil {
+				if err := f.beforeModify(endpoint); err != nil {
+					return nil, err
+				}
+			}
+
+			f.modified++
+			endpoint.StaticMembers = input.StaticMembers
+
+			return &rds.ModifyDBClusterEndpointOutput{}, nil
+		},
+	}
+}
+
+// customEndpoint builds an available custom endpoint of the cluster with the given static members.
+func customEndpoint(id string, members ...string) *rds.DBClusterEndpoint {
+	return &rds.DBClusterEndpoint{
+		DBClusterEndpointIdentifier: aws.String(id),
+		DBClusterEndpointArn:        aws.String("arn:aws:rds:us-east-1:123456789012:cluster-endpoint:" + id),
+		DBClusterIdentifier:         aws.String("planet-express"),
+		EndpointType:                aws.String(rdsEndpointTypeCustom),
+		Status:                      aws.String("available"),
+		StaticMembers:               aws.StringSlice(members),
+	}
+}
+
+// instanceEvent builds an RDS instance event of an autoscaled replica.
+func instanceEvent(rdsEventID, instanceID string) events.CloudWatchEvent {
+	return events.CloudWatchEvent{
+		ID:         "slurm-" + instanceID,
+		Source:     "aws.rds",
+		DetailType: "RDS DB Instance Event",
+		AccountID:  "123456789012",
+		Region:     "us-east-1",
+		Detail: []byte(`{"EventID": "` + rdsEventID + `", "SourceType": "DB_INSTANCE", "SourceIdentifier": "` + instanceID +
+			`", "SourceArn": "arn:aws:rds:us-east-1:123456789012:db:` + instanceID + `"}`),
+	}
+}
+
+// TestHandler_JoinCustomEndpoints covers adding new replicas to custom endpoints after tagging.
+// New crew members are added to the delivery roster, but only the roster Hermes picked.
+func TestHandler_JoinCustomEndpoints(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	stateFault := awserr.New(rds.ErrCodeInvalidDBClusterEndpointStateFault, "endpoint is modifying", nil)
+
+	tests := []struct {
+		name          string
+		opts          []Option
+		endpoints     []*rds.DBClusterEndpoint
+		tags          map[string]map[string]string
+		beforeModify  func(calls *int) func(*rds.DBClusterEndpoint) error
+		wantEndpoints []string
+		wantMembers   map[string][]string
+		wantErr       bool
+	}{
+		{
+			name: "disabled",
+			endpoints: []*rds.DBClusterEndpoint{
+				customEndpoint("deliveries", "planet-express-leela"),
+			},
+			wantMembers: map[string][]string{"deliveries": {"planet-express-leela"}},
+		},
+		{
+			name: "endpoint selected by name",
+			opts: []Option{WithCustomEndpoints("deliveries")},
+			endpoints: []*rds.DBClusterEndpoint{
+				customEndpoint("deliveries", "planet-express-leela"),
+				customEndpoint("accounting", "planet-express-hermes"),
+			},
+			wantEndpoints: []string{"deliveries"},
+			wantMembers: map[string][]string{
+				"deliveries": {"planet-express-leela", "application-autoscaling-fry"},
+				"accounting": {"planet-express-hermes"},
+			},
+		},
+		{
+			name: "endpoint selected by tag",
+			opts: []Option{WithCustomEndpointTagRule(EndpointTagRule{Key: "Workload", Value: "analytics"})},
+			endpoints: []*rds.DBClusterEndpoint{
+				customEndpoint("deliveries", "planet-express-leela"),
+				customEndpoint("accounting", "planet-express-hermes"),
+			},
+			tags: map[string]map[string]string{
+				"arn:aws:rds:us-east-1:123456789012:cluster-endpoint:accounting": {"Workload": "analytics"},
+				"arn:aws:rds:us-east-1:123456789012:cluster-endpoint:deliveries": {"Workload": "delivery"},
+			},
+			wantEndpoints: []string{"accounting"},
+			wantMembers: map[string][]string{
+				"deliveries": {"planet-express-leela"},
+				"accounting": {"planet-express-hermes", "application-autoscaling-fry"},
+			},
+		},
+		{
+			name: "cluster endpoints are never modified",
+			opts: []Option{WithCustomEndpoints("planet-express-reader")},
+			endpoints: []*rds.DBClusterEndpoint{
+				{
+					DBClusterEndpointIdentifier: aws.String("planet-express-reader"),
+					EndpointType:                aws.String("READER"),
+				},
+			},
+		},
+		{
+			name: "endpoint without static members includes the replica already",
+			opts: []Option{WithCustomEndpoints("deliveries")},
+			endpoints: []*rds.DBClusterEndpoint{
+				customEndpoint("deliveries"),
+			},
+			wantMembers: map[string][]string{"deliveries": {}},
+		},
+		{
+			name: "replica is a member already",
+			opts: []Option{WithCustomEndpoints("deliveries")},
+			endpoints: []*rds.DBClusterEndpoint{
+				customEndpoint("deliveries", "application-autoscaling-fry"),
+			},
+			wantMembers: map[string][]string{"deliveries": {"application-autoscaling-fry"}},
+		},
+		{
+			name: "concurrent modification is retried",
+			opts: []Option{WithCustomEndpoints("deliveries")},
+			endpoints: []*rds.DBClusterEndpoint{
+				customEndpoint("deliveries", "planet-express-leela"),
+			},
+			beforeModify: func(calls *int) func(*rds.DBClusterEndpoint) error {
+				return func(*rds.DBClusterEndpoint) error {
+					*calls++
+					if *calls == 1 {
+						return stateFault
+					}
+
+					return nil
+				}
+			},
+			wantEndpoints: []string{"deliveries"},
+			wantMembers:   map[string][]string{"deliveries": {"planet-express-leela", "application-autoscaling-fry"}},
+		},
+		{
+			name: "change overwritten by another writer is applied again",
+			opts: []Option{WithCustomEndpoints("deliveries")},
+			endpoints: []*rds.DBClusterEndpoint{
+				customEndpoint("deliveries", "planet-express-leela"),
+			},
+			beforeModify: func(calls *int) func(*rds.DBClusterEndpoint) error {
+				return func(endpoint *rds.DBClusterEndpoint) error {
+					*calls++
+					if *calls == 2 {
+						// Zapp replaces the list with the one he read before our change.
+						endpoint.StaticMembers = aws.StringSlice([]string{"planet-express-leela", "nimbus-kif"})
+					}
+
+					return nil
+				}
+			},
+			wantEndpoints: []string{"deliveries"},
+			wantMembers:   map[string][]string{"deliveries": {"planet-express-leela", "application-autoscaling-fry"}},
+		},
+		{
+			name: "endpoint stays busy",
+			opts: []Option{WithCustomEndpoints("deliveries")},
+			endpoints: []*rds.DBClusterEndpoint{
+				customEndpoint("deliveries", "planet-express-leela"),
+			},
+			beforeModify: func(*int) func(*rds.DBClusterEndpoint) error {
+				return func(*rds.DBClusterEndpoint) error { return stateFault }
+			},
+			wantErr:     true,
+			wantMembers: map[string][]string{"deliveries": {"planet-express-leela"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardLogs(t)
+
+			fake := &fakeEndpoints{endpoints: tt.endpoints, tags: tt.tags}
+
+			if tt.beforeModify != nil {
+				calls := 0
+				fake.beforeModify = tt.beforeModify(&calls)
+			}
+
+			handler := NewHandler(logrus.New(), fake.mock(), &mockSTS{}, tt.opts...)
+			handler.sleep = func(time.Duration) {}
+
+			result, err := handler.HandleRequest(context.Background(), instanceEvent("RDS-EVENT-0005", "application-autoscaling-fry"))
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Equal(t, OutcomeFailed, result.Outcome)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, OutcomeTagged, result.Outcome)
+			}
+
+			assert.Equal(t, tt.wantEndpoints, result.Endpoints)
+
+			for id, members := range tt.wantMembers {
+				assert.Equal(t, members, aws.StringValueSlice(fake.endpoint(id).StaticMembers), id)
+			}
+		})
+	}
+}
+
+// TestParseEndpointTagRule checks parsing of key=value rules.
+func TestParseEndpointTagRule(t *testing.T) {
+	rule, err := ParseEndpointTagRule("Workload=analytics")
+	require.NoError(t, err)
+	assert.Equal(t, EndpointTagRule{Key: "Workload", Value: "analytics"}, rule)
+
+	rule, err = ParseEndpointTagRule("Workload=")
+	require.NoError(t, err)
+	assert.Equal(t, EndpointTagRule{Key: "Workload"}, rule)
+
+	_, err = ParseEndpointTagRule("Workload")
+	assert.Error(t, err)
+
+	_, err = ParseEndpointTagRule("=analytics")
+	assert.Error(t, err)
+}
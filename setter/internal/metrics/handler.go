@@ -4,15 +4,22 @@ package metrics
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"counter/internal/version"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
 	"github.com/aws/aws-sdk-go/service/rds"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/sirupsen/logrus"
@@ -22,6 +29,12 @@ import (
 type RDSAPI interface {
 	DescribeDBInstances(*rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error)
 	AddTagsToResource(*rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error)
+	ListTagsForResource(*rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error)
+	RemoveTagsFromResource(*rds.RemoveTagsFromResourceInput) (*rds.RemoveTagsFromResourceOutput, error)
+	DescribeEvents(*rds.DescribeEventsInput) (*rds.DescribeEventsOutput, error)
+	ModifyDBInstance(*rds.ModifyDBInstanceInput) (*rds.ModifyDBInstanceOutput, error)
+	DescribeDBClusterEndpoints(*rds.DescribeDBClusterEndpointsInput) (*rds.DescribeDBClusterEndpointsOutput, error)
+	ModifyDBClusterEndpoint(*rds.ModifyDBClusterEndpointInput) (*rds.ModifyDBClusterEndpointOutput, error)
 }
 
 // STSAPI defines the STS operations we use for AWS identity operations.
@@ -29,25 +42,230 @@ type STSAPI interface {
 	GetCallerIdentity(*sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error)
 }
 
+// CloudWatchAPI defines the CloudWatch operations we use for per-replica alarms.
+type CloudWatchAPI interface {
+	PutMetricAlarm(*cloudwatch.PutMetricAlarmInput) (*cloudwatch.PutMetricAlarmOutput, error)
+	DescribeAlarms(*cloudwatch.DescribeAlarmsInput) (*cloudwatch.DescribeAlarmsOutput, error)
+	DeleteAlarms(*cloudwatch.DeleteAlarmsInput) (*cloudwatch.DeleteAlarmsOutput, error)
+}
+
+// CloudWatchLogsAPI defines the CloudWatch Logs operations we use for log export groups.
+type CloudWatchLogsAPI interface {
+	DescribeLogGroups(*cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error)
+	ListTagsForResource(*cloudwatchlogs.ListTagsForResourceInput) (*cloudwatchlogs.ListTagsForResourceOutput, error)
+	TagResource(*cloudwatchlogs.TagResourceInput) (*cloudwatchlogs.TagResourceOutput, error)
+	PutRetentionPolicy(*cloudwatchlogs.PutRetentionPolicyInput) (*cloudwatchlogs.PutRetentionPolicyOutput, error)
+}
+
+// ApplicationAutoScalingAPI defines the Application Auto Scaling operations we use for the cluster's scalable target.
+type ApplicationAutoScalingAPI interface {
+	DescribeScalableTargets(*applicationautoscaling.DescribeScalableTargetsInput) (*applicationautoscaling.DescribeScalableTargetsOutput, error)
+	ListTagsForResource(*applicationautoscaling.ListTagsForResourceInput) (*applicationautoscaling.ListTagsForResourceOutput, error)
+	TagResource(*applicationautoscaling.TagResourceInput) (*applicationautoscaling.TagResourceOutput, error)
+	DescribeScalingActivities(*applicationautoscaling.DescribeScalingActivitiesInput) (*applicationautoscaling.DescribeScalingActivitiesOutput, error)
+}
+
+// EventBridgeAPI defines the EventBridge operations we use for domain events.
+type EventBridgeAPI interface {
+	PutEvents(*eventbridge.PutEventsInput) (*eventbridge.PutEventsOutput, error)
+}
+
 // Handler manages RDS cluster tag operations with AWS service clients and logging.
 type Handler struct {
-	logger logrus.FieldLogger
-	rds    RDSAPI
-	sts    STSAPI
+	// mu serializes invocations, the daemon runs the poller and the admin API concurrently.
+	mu sync.Mutex
+
+	logger   logrus.FieldLogger
+	rds      RDSAPI
+	sts      STSAPI
+	recorder Recorder
+
+	// requestID is the Lambda request ID of the current invocation, empty outside Lambda.
+	requestID string
+
+	// deadline is the deadline of the current invocation, zero when it has none.
+	deadline time.Time
+
+	idempotency IdempotencyStore
+
+	// verifyAttempts is the number of tag read-back attempts, zero disables verification.
+	verifyAttempts int
+	verifyDelay    time.Duration
+	sleep          func(time.Duration)
+
+	// maxEventAge is the age after which events are stale, zero disables the check.
+	maxEventAge    time.Duration
+	staleEventMode StaleEventMode
+	now            func() time.Time
+
+	// allowedAccounts and allowedRegions restrict event origins, empty sets allow any.
+	allowedAccounts map[string]bool
+	allowedRegions  map[string]bool
+
+	// resourceWaitAttempts bounds the tagging attempts while a new instance is not yet visible.
+	resourceWaitAttempts int
+	resourceWaitDelay    time.Duration
+
+	// inheritedTagKeys are the cluster tag keys propagated to its replicas.
+	inheritedTagKeys map[string]bool
+
+	// customEndpoints and endpointTagRule select the custom endpoints new replicas are added to.
+	customEndpoints map[string]bool
+	endpointTagRule *EndpointTagRule
+
+	// instanceSettings are written to new replicas after tagging, nil disables it.
+	instanceSettings *InstanceSettings
+	settingsDryRun   bool
+	// promotionTier is enforced on new replicas and during sweeps, nil disables it.
+	promotionTier *int64
+	// alarmTemplates are created as alarms for each new replica through cloudwatch, and deleted with it.
+	cloudwatch     CloudWatchAPI
+	alarmTemplates []AlarmTemplate
+
+	// logs tags the log export groups of new replicas, logRetention in days is set on them when not zero.
+	logs         CloudWatchLogsAPI
+	logRetention int64
+
+	// autoscaling tags the scalable target of the cluster at startup and during sweeps, nil disables it.
+	autoscaling ApplicationAutoScalingAPI
+
+	// eventBridge publishes domain events to eventBusName, nil disables them. The cause of the scaling
+	// activity is read through scalingActivities when it is set.
+	eventBridge       EventBridgeAPI
+	eventBusName      string
+	scalingActivities ApplicationAutoScalingAPI
+
+	// auditSink stores an audit record of every result, nil disables the audit trail.
+	auditSink AuditSink
+
+	// replicaStore records creation times of replicas to report their lifetime on deletion, nil disables it.
+	replicaStore ReplicaStore
+
+	// settingsWait bounds the wait for a new replica to become available before it is modified.
+	settingsWait time.Duration
+
+	// catchUpLookback is the window searched for missed creation events at startup, zero disables it.
+	catchUpLookback time.Duration
+
+	observers []Observer
+
+	// ownRole is the name of the role the function runs as, resolved on first use.
+	ownRole string
 }
 
 // NewHandler creates a new Handler instance with the provided dependencies.
-func NewHandler(logger logrus.FieldLogger, rdsClient RDSAPI, stsClient STSAPI) *Handler {
-	return &Handler{
-		logger: logger,
-		rds:    rdsClient,
-		sts:    stsClient,
+func NewHandler(logger logrus.FieldLogger, rdsClient RDSAPI, stsClient STSAPI, opts ...Option) *Handler {
+	h := &Handler{
+		logger:   logger,
+		rds:      rdsClient,
+		sts:      stsClient,
+		recorder: NopRecorder{},
+		sleep:    time.Sleep,
+		now:      time.Now,
+
+		resourceWaitAttempts: 5,
+		resourceWaitDelay:    2 * time.Second,
+		settingsWait:         defaultSettingsWait,
+	}
+
+	for _, opt := range opts {
+		opt(h)
 	}
+
+	return h
+}
+
+// deadlineMargin is the time kept before the invocation deadline to release the event and report the outcome.
+const deadlineMargin = 5 * time.Second
+
+// ErrDeadlineNear is returned when waiting any longer would run into the invocation deadline.
+var ErrDeadlineNear = errors.New("invocation deadline is near")
+
+// Outcome describes what the handler decided to do with an event.
+type Outcome string
+
+// Outcomes reported by the handler.
+const (
+	// OutcomeTagged means tags were applied to the instance.
+	OutcomeTagged Outcome = "tagged"
+	// OutcomeSkipped means the instance is not managed by this function.
+	OutcomeSkipped Outcome = "skipped"
+	// OutcomeDuplicate means the event was already processed.
+	OutcomeDuplicate Outcome = "duplicate"
+	// OutcomeFailed means processing ended with an error.
+	OutcomeFailed Outcome = "failed"
+	// OutcomeStale means the event was older than the maximum event age and was ignored.
+	OutcomeStale Outcome = "stale"
+	// OutcomeReconciled means a stale event added only the tags that were missing.
+	OutcomeReconciled Outcome = "reconciled"
+	// OutcomeUnchanged means all tags were already present, nothing was written.
+	OutcomeUnchanged Outcome = "unchanged"
+	// OutcomeRejected means the event failed source, account or region validation.
+	OutcomeRejected Outcome = "rejected"
+	// OutcomeIgnored means no handler is registered for the event.
+	OutcomeIgnored Outcome = "ignored"
+	// OutcomeRestored means managed tags changed by someone else were put back.
+	OutcomeRestored Outcome = "restored"
+	// OutcomePropagated means changed cluster tags were pushed to its replicas.
+	OutcomePropagated Outcome = "propagated"
+	// OutcomeRemoved means a deleted replica was cleaned up after and its lifetime recorded.
+	OutcomeRemoved Outcome = "removed"
+)
+
+// Result is the decision taken for a single event, it is returned to the Lambda caller.
+type Result struct {
+	EventID              string            `json:"event_id,omitempty"`
+	RDSEventID           string            `json:"rds_event_id,omitempty"`
+	Message              string            `json:"message,omitempty"`
+	DBInstanceIdentifier string            `json:"db_instance_identifier,omitempty"`
+	DBInstanceArn        string            `json:"db_instance_arn,omitempty"`
+	ClusterIdentifier    string            `json:"cluster_identifier,omitempty"`
+	Outcome              Outcome           `json:"outcome"`
+	Reason               string            `json:"reason,omitempty"`
+	TagsApplied          map[string]string `json:"tags_applied,omitempty"`
+	TagsBefore           map[string]string `json:"tags_before,omitempty"`
+	TagsAfter            map[string]string `json:"tags_after,omitempty"`
+	Endpoints            []string          `json:"endpoints,omitempty"`
+	Alarms               []string          `json:"alarms,omitempty"`
+	LogGroups            []string          `json:"log_groups,omitempty"`
+	Lifetime             string            `json:"lifetime,omitempty"`
+	SettingsChanged      map[string]string `json:"settings_changed,omitempty"`
+	SettingsDryRun       bool              `json:"settings_dry_run,omitempty"`
+	Error                string            `json:"error,omitempty"`
+	// Replicas holds the result per replica when a cluster event changed several instances.
+	Replicas []*Result `json:"replicas,omitempty"`
 }
 
-// EventDetail represents the CloudWatch event detail containing the RDS instance identifier.
+// EventDetail represents the detail of an RDS event delivered by EventBridge.
 type EventDetail struct {
-	SourceIdentifier string `json:"SourceIdentifier"`
+	EventCategories  []string  `json:"EventCategories"`
+	SourceType       string    `json:"SourceType"`
+	SourceArn        string    `json:"SourceArn"`
+	Date             time.Time `json:"Date"`
+	Message          string    `json:"Message"`
+	SourceIdentifier string    `json:"SourceIdentifier"`
+	EventID          string    `json:"EventID"`
+}
+
+// loadConfig reads the target cluster and the tags to apply from the required environment variables.
+func (h *Handler) loadConfig() (string, map[string]string, error) {
+	// Validate required environment variables.
+	expectedClusterID := os.Getenv("RDS_CLUSTER_IDENTIFIER")
+	if expectedClusterID == "" {
+		h.logger.Printf("RDS_CLUSTER_IDENTIFIER environment variable is not set")
+		return "", nil, fmt.Errorf("RDS_CLUSTER_IDENTIFIER environment variable is required")
+	}
+
+	tagsEnv := os.Getenv("TAGS")
+
+	var tagsMap map[string]string
+
+	if err := json.Unmarshal([]byte(tagsEnv), &tagsMap); err != nil {
+		h.logger.Printf("Error parsing tags from environment: %v", err)
+		return "", nil, err
+	}
+
+	return expectedClusterID, tagsMap, nil
 }
 
 // loggerFromContext extracts Lambda context and returns a logger with request metadata.
@@ -74,6 +292,34 @@ func loggerFromContext(ctx context.Context) *logrus.Entry {
 	return logrus.WithFields(fields)
 }
 
+// wait sleeps for d unless the invocation would then have less than deadlineMargin left. The handler fails
+// instead while there is still time to release the idempotency claim, a timed out invocation would keep the
+// event claimed and its retry would be dropped as a duplicate.
+func (h *Handler) wait(d time.Duration) error {
+	if !h.deadline.IsZero() && h.now().Add(d+deadlineMargin).After(h.deadline) {
+		return fmt.Errorf("%w: %s left", ErrDeadlineNear, h.deadline.Sub(h.now()).Round(time.Millisecond))
+	}
+
+	h.sleep(d)
+
+	return nil
+}
+
+// requestIDFromContext returns the Lambda request ID, or an empty string outside Lambda.
+func requestIDFromContext(ctx context.Context) string {
+	lambdaCtx, ok := lambdacontext.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	return lambdaCtx.AwsRequestID
+}
+
+// isAutoscaledReplica reports whether the instance was created by application autoscaling.
+func isAutoscaledReplica(dbInstanceID string) bool {
+	return strings.Contains(dbInstanceID, "application-autoscaling-")
+}
+
 // getClusterIdentifier retrieves the cluster ID for a given RDS instance.
 func (h *Handler) getClusterIdentifier(DBInstanceIdentifier string) (string, error) {
 	input := &rds.DescribeDBInstancesInput{
@@ -98,22 +344,87 @@ func (h *Handler) getClusterIdentifier(DBInstanceIdentifier string) (string, err
 }
 
 // HandleRequest processes CloudWatch events to update RDS instance tags.
-func (h *Handler) HandleRequest(ctx context.Context, event events.CloudWatchEvent) error {
+func (h *Handler) HandleRequest(ctx context.Context, event events.CloudWatchEvent) (*Result, error) {
+	return h.process(ctx, event, h.handle)
+}
+
+// process runs handle for a single event, skipping duplicate deliveries, and logs and observes the outcome.
+func (h *Handler) process(ctx context.Context, event events.CloudWatchEvent,
+	handle func(events.CloudWatchEvent, *Result) error) (*Result, error) {
+	result, err := h.processLocked(ctx, event, handle)
+	h.observe(ctx, result)
+
+	return result, err
+}
+
+// processLocked runs processOnce while holding h.mu and writes the audit records of the outcome.
+func (h *Handler) processLocked(ctx context.Context, event events.CloudWatchEvent,
+	handle func(events.CloudWatchEvent, *Result) error) (*Result, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	h.logger = loggerFromContext(ctx)
+	h.requestID = requestIDFromContext(ctx)
+	h.deadline, _ = ctx.Deadline()
 
-	// Validate required environment variables.
-	expectedClusterID := os.Getenv("RDS_CLUSTER_IDENTIFIER")
-	if expectedClusterID == "" {
-		h.logger.Printf("RDS_CLUSTER_IDENTIFIER environment variable is not set")
-		return fmt.Errorf("RDS_CLUSTER_IDENTIFIER environment variable is required")
+	result, err := h.processOnce(event, handle)
+	h.audit(result)
+
+	return result, err
+}
+
+// processOnce claims the event ID, runs handle and releases the claim again when handle fails.
+func (h *Handler) processOnce(event events.CloudWatchEvent, handle func(events.CloudWatchEvent, *Result) error) (*Result, error) {
+	// EventBridge delivers at least once, so each event ID is processed only once.
+	claimed := false
+
+	if h.idempotency != nil && event.ID != "" {
+		first, err := h.idempotency.Claim(event.ID)
+		if err != nil {
+			h.logger.Printf("Error recording event %s as processed: %v", event.ID, err)
+			return &Result{EventID: event.ID, Outcome: OutcomeFailed}, err
+		}
+
+		if !first {
+			h.recorder.Inc(MetricDuplicateEvent)
+			h.logger.WithField("outcome", OutcomeDuplicate).Printf("Event %s was already processed. Skipping.", event.ID)
+
+			return &Result{EventID: event.ID, Outcome: OutcomeDuplicate}, nil
+		}
+
+		claimed = true
 	}
 
-	tagsEnv := os.Getenv("TAGS")
+	result := &Result{EventID: event.ID}
 
-	var tagsMap map[string]string
+	err := handle(event, result)
+	if err != nil {
+		result.Error = err.Error()
 
-	if err := json.Unmarshal([]byte(tagsEnv), &tagsMap); err != nil {
-		h.logger.Printf("Error parsing tags from environment: %v", err)
+		if result.Outcome != OutcomeRejected {
+			result.Outcome = OutcomeFailed
+		}
+
+		// Forget the event so that the retry is not treated as a duplicate.
+		if claimed {
+			if releaseErr := h.idempotency.Release(event.ID); releaseErr != nil {
+				h.logger.Printf("Error releasing event %s: %v", event.ID, releaseErr)
+			}
+		}
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"outcome": result.Outcome,
+		"reason":  result.Reason,
+	}).Printf("Finished processing event %s", event.ID)
+
+	return result, err
+}
+
+// handle applies tags for a single CloudWatch event and records the decision in result.
+func (h *Handler) handle(event events.CloudWatchEvent, result *Result) error {
+	expectedClusterID, tagsMap, err := h.loadConfig()
+	if err != nil {
 		return err
 	}
 
@@ -123,31 +434,158 @@ func (h *Handler) HandleRequest(ctx context.Context, event events.CloudWatchEven
 		return err
 	}
 
+	result.RDSEventID = detail.EventID
+	result.Message = detail.Message
+
+	if err := h.validateEvent(event, detail, rdsEventInstanceCreated); err != nil {
+		result.Outcome = OutcomeRejected
+		result.Reason = err.Error()
+
+		return err
+	}
+
 	dbInstanceID := detail.SourceIdentifier
-	h.logger.Printf("Received event for DB instance: %s", dbInstanceID)
+	result.DBInstanceIdentifier = dbInstanceID
+	h.logger.Printf("Received event %s for DB instance %s: %s", detail.EventID, dbInstanceID, detail.Message)
+
+	// Old events are replays or heavily delayed retries, the instance may have been re-tagged since.
+	stale := h.isStale(event)
+	if stale && h.staleEventMode == StaleEventIgnore {
+		result.Outcome = OutcomeStale
+		result.Reason = fmt.Sprintf("event from %s is older than %s", event.Time.Format(time.RFC3339), h.maxEventAge)
+		h.logger.Printf("Event for DB instance %s is stale: %s. Skipping.", dbInstanceID, result.Reason)
+
+		return nil
+	}
 
 	// Validate instance type and cluster membership.
-	if !strings.Contains(dbInstanceID, "application-autoscaling-") {
+	if !isAutoscaledReplica(dbInstanceID) {
+		result.Outcome = OutcomeSkipped
+		result.Reason = "not an autoscaled replica"
 		h.logger.Printf("DB instance %s is not an Aurora instance. Skipping.", dbInstanceID)
+
 		return nil
 	}
 
 	clusterID, err := h.getClusterIdentifier(dbInstanceID)
+
+	// Short-lived replicas can be deleted before their creation event is handled, retrying would never succeed.
+	if isNotFound(err) {
+		result.Outcome = OutcomeSkipped
+		result.Reason = "DB instance no longer exists"
+		h.logger.Printf("DB instance %s no longer exists. Skipping.", dbInstanceID)
+
+		return nil
+	}
+
 	if err != nil {
 		h.logger.Printf("Error getting cluster identifier for instance %s: %v", dbInstanceID, err)
 		return err
 	}
 
+	result.ClusterIdentifier = clusterID
+
 	if clusterID != expectedClusterID {
+		result.Outcome = OutcomeSkipped
+		result.Reason = fmt.Sprintf("not a member of cluster %s", expectedClusterID)
 		h.logger.Printf("DB instance %s is not a member of cluster %s. Skipping.", dbInstanceID, expectedClusterID)
+
 		return nil
 	}
 
+	arn, err := h.instanceArn(event, detail)
+	if err != nil {
+		return err
+	}
+
+	result.DBInstanceArn = arn
+
+	result.Outcome = OutcomeTagged
+
+	// Stale events only fill in tags that are missing, values changed by hand are kept.
+	if stale {
+		current, err := h.listTags(arn)
+		if err != nil {
+			h.logger.Printf("Error reading tags of DB instance %s: %v", dbInstanceID, err)
+			return err
+		}
+
+		tagsMap = missingTags(tagsMap, current)
+		result.TagsBefore = current
+		result.Outcome = OutcomeReconciled
+		result.Reason = fmt.Sprintf("stale event from %s reconciled", event.Time.Format(time.RFC3339))
+
+		if len(tagsMap) == 0 {
+			// Nothing is written, so the tags just read are the tags after as well.
+			result.TagsAfter = current
+			result.Outcome = OutcomeUnchanged
+			h.logger.Printf("All tags already present on DB instance %s. Skipping.", dbInstanceID)
+
+			return h.afterCreated(clusterID, dbInstanceID, eventTime(event, detail), result)
+		}
+	}
+
+	if err := h.applyTags(dbInstanceID, arn, tagsMap, result); err != nil {
+		return err
+	}
+
+	return h.afterCreated(clusterID, dbInstanceID, eventTime(event, detail), result)
+}
+
+// afterCreated records the creation of a new replica once it is tagged and sets it up.
+func (h *Handler) afterCreated(clusterID, dbInstanceID string, createdAt time.Time, result *Result) error {
+	if err := h.recordCreated(dbInstanceID, createdAt); err != nil {
+		return err
+	}
+
+	return h.afterTagging(clusterID, dbInstanceID, result)
+}
+
+// afterTagging adds a new replica to custom endpoints, creates its alarms, tags its log groups and brings it
+// to the desired instance settings.
+func (h *Handler) afterTagging(clusterID, dbInstanceID string, result *Result) error {
+	if err := h.joinCustomEndpoints(clusterID, dbInstanceID, result); err != nil {
+		return err
+	}
+
+	if err := h.createAlarms(dbInstanceID, result); err != nil {
+		return err
+	}
+
+	if err := h.tagLogGroups(dbInstanceID, result); err != nil {
+		return err
+	}
+
+	return h.applyInstanceSettings(dbInstanceID, result)
+}
+
+// instanceArn returns the tagging target, preferring the SourceArn carried by the event.
+func (h *Handler) instanceArn(event events.CloudWatchEvent, detail EventDetail) (string, error) {
+	if detail.SourceArn != "" {
+		return detail.SourceArn, nil
+	}
+
 	// Get AWS account information for ARN construction.
 	callerIdentityOutput, err := h.sts.GetCallerIdentity(&sts.GetCallerIdentityInput{})
 	if err != nil {
 		h.logger.Printf("Error getting AWS caller identity: %v", err)
-		return err
+		return "", err
+	}
+
+	return fmt.Sprintf("arn:aws:rds:%s:%s:db:%s", event.Region, *callerIdentityOutput.Account, detail.SourceIdentifier), nil
+}
+
+// applyTags adds tags to the RDS instance and verifies them when verification is enabled.
+func (h *Handler) applyTags(dbInstanceID, arn string, tagsMap map[string]string, result *Result) error {
+	// Domain events and the audit trail report the previous values of the tags written.
+	if h.eventBridge != nil || h.auditSink != nil {
+		before, err := h.listTags(arn)
+		if err != nil {
+			h.logger.Printf("Error reading tags of DB instance %s: %v", dbInstanceID, err)
+			return err
+		}
+
+		result.TagsBefore = before
 	}
 
 	// Prepare tags for application.
@@ -160,8 +598,7 @@ func (h *Handler) HandleRequest(ctx context.Context, event events.CloudWatchEven
 	}
 
 	// Apply tags to the RDS instance.
-	arn := fmt.Sprintf("arn:aws:rds:%s:%s:db:%s", event.Region, *callerIdentityOutput.Account, dbInstanceID)
-	_, err = h.rds.AddTagsToResource(&rds.AddTagsToResourceInput{
+	_, err := h.rds.AddTagsToResource(&rds.AddTagsToResourceInput{
 		ResourceName: aws.String(arn),
 		Tags:         awsTags,
 	})
@@ -171,5 +608,25 @@ func (h *Handler) HandleRequest(ctx context.Context, event events.CloudWatchEven
 		return err
 	}
 
+	result.TagsApplied = tagsMap
+
+	// Confirm the tags are visible before reporting success, the tags read back are the ones recorded as after.
+	if h.verifyAttempts > 0 {
+		after, err := h.verifyTags(arn, tagsMap)
+		result.TagsAfter = after
+
+		if err != nil {
+			h.logger.Printf("Error verifying tags on DB instance %s: %v", dbInstanceID, err)
+			return err
+		}
+	} else {
+		h.observeTagsAfter(dbInstanceID, arn, result)
+	}
+
+	// Consumers only hear about tags that are known to be in place.
+	if h.eventBridge != nil {
+		h.publishReplicaTagged(dbInstanceID, arn, result.TagsBefore, tagsMap, result)
+	}
+
 	return nil
 }
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"testing"
 
@@ -14,6 +15,10 @@ import (
 	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
 	"github.com/aws/aws-sdk-go/service/rds"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/sirupsen/logrus"
@@ -26,6 +31,14 @@ type mockRDS struct {
 	RDSAPI
 	describeDBInstancesFunc func(*rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error)
 	addTagsToResourceFunc   func(*rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error)
+	listTagsForResourceFunc func(*rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error)
+
+	removeTagsFromResourceFunc func(*rds.RemoveTagsFromResourceInput) (*rds.RemoveTagsFromResourceOutput, error)
+	describeEventsFunc         func(*rds.DescribeEventsInput) (*rds.DescribeEventsOutput, error)
+
+	modifyDBInstanceFunc           func(*rds.ModifyDBInstanceInput) (*rds.ModifyDBInstanceOutput, error)
+	describeDBClusterEndpointsFunc func(*rds.DescribeDBClusterEndpointsInput) (*rds.DescribeDBClusterEndpointsOutput, error)
+	modifyDBClusterEndpointFunc    func(*rds.ModifyDBClusterEndpointInput) (*rds.ModifyDBClusterEndpointOutput, error)
 }
 
 // mockRDS simulates the Planet Express RDS delivery system for testing.
@@ -46,6 +59,60 @@ func (m *mockRDS) AddTagsToResource(input *rds.AddTagsToResourceInput) (*rds.Add
 	return nil, fmt.Errorf("AddTagsToResource not implemented")
 }
 
+// ListTagsForResource returns mock response or error based on the configured function.
+func (m *mockRDS) ListTagsForResource(input *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+	if m.listTagsForResourceFunc != nil {
+		return m.listTagsForResourceFunc(input)
+	}
+
+	return nil, fmt.Errorf("ListTagsForResource not implemented")
+}
+
+// RemoveTagsFromResource returns mock response or error based on the configured function.
+func (m *mockRDS) RemoveTagsFromResource(input *rds.RemoveTagsFromResourceInput) (*rds.RemoveTagsFromResourceOutput, error) {
+	if m.removeTagsFromResourceFunc != nil {
+		return m.removeTagsFromResourceFunc(input)
+	}
+
+	return nil, fmt.Errorf("RemoveTagsFromResource not implemented")
+}
+
+// DescribeEvents returns mock response or error based on the configured function.
+func (m *mockRDS) DescribeEvents(input *rds.DescribeEventsInput) (*rds.DescribeEventsOutput, error) {
+	if m.describeEventsFunc != nil {
+		return m.describeEventsFunc(input)
+	}
+
+	return nil, fmt.Errorf("DescribeEvents not implemented")
+}
+
+// ModifyDBInstance returns mock response or error based on the configured function.
+func (m *mockRDS) ModifyDBInstance(input *rds.ModifyDBInstanceInput) (*rds.ModifyDBInstanceOutput, error) {
+	if m.modifyDBInstanceFunc != nil {
+		return m.modifyDBInstanceFunc(input)
+	}
+
+	return nil, fmt.Errorf("ModifyDBInstance not implemented")
+}
+
+// DescribeDBClusterEndpoints returns mock response or error based on the configured function.
+func (m *mockRDS) DescribeDBClusterEndpoints(input *rds.DescribeDBClusterEndpointsInput) (*rds.DescribeDBClusterEndpointsOutput, error) {
+	if m.describeDBClusterEndpointsFunc != nil {
+		return m.describeDBClusterEndpointsFunc(input)
+	}
+
+	return nil, fmt.Errorf("DescribeDBClusterEndpoints not implemented")
+}
+
+// ModifyDBClusterEndpoint returns mock response or error based on the configured function.
+func (m *mockRDS) ModifyDBClusterEndpoint(input *rds.ModifyDBClusterEndpointInput) (*rds.ModifyDBClusterEndpointOutput, error) {
+	if m.modifyDBClusterEndpointFunc != nil {
+		return m.modifyDBClusterEndpointFunc(input)
+	}
+
+	return nil, fmt.Errorf("ModifyDBClusterEndpoint not implemented")
+}
+
 // mockSTS simulates the Space Transport Security service for testing.
 type mockSTS struct {
 	STSAPI
@@ -61,6 +128,156 @@ func (m *mockSTS) GetCallerIdentity(input *sts.GetCallerIdentityInput) (*sts.Get
 	return nil, fmt.Errorf("GetCallerIdentity not implemented")
 }
 
+// mockCloudWatch simulates the alarm panel of the Planet Express ship for testing.
+type mockCloudWatch struct {
+	CloudWatchAPI
+	putMetricAlarmFunc func(*cloudwatch.PutMetricAlarmInput) (*cloudwatch.PutMetricAlarmOutput, error)
+	describeAlarmsFunc func(*cloudwatch.DescribeAlarmsInput) (*cloudwatch.DescribeAlarmsOutput, error)
+	deleteAlarmsFunc   func(*cloudwatch.DeleteAlarmsInput) (*cloudwatch.DeleteAlarmsOutput, error)
+}
+
+// PutMetricAlarm returns mock response or error based on the configured function.
+func (m *mockCloudWatch) PutMetricAlarm(input *cloudwatch.PutMetricAlarmInput) (*cloudwatch.PutMetricAlarmOutput, error) {
+	if m.putMetricAlarmFunc != nil {
+		return m.putMetricAlarmFunc(input)
+	}
+
+	return nil, fmt.Errorf("PutMetricAlarm not implemented")
+}
+
+// DescribeAlarms returns mock response or error based on the configured function.
+func (m *mockCloudWatch) DescribeAlarms(input *cloudwatch.DescribeAlarmsInput) (*cloudwatch.DescribeAlarmsOutput, error) {
+	if m.describeAlarmsFunc != nil {
+		return m.describeAlarmsFunc(input)
+	}
+
+	return nil, fmt.Errorf("DescribeAlarms not implemented")
+}
+
+// DeleteAlarms returns mock response or error based on the configured function.
+func (m *mockCloudWatch) DeleteAlarms(input *cloudwatch.DeleteAlarmsInput) (*cloudwatch.DeleteAlarmsOutput, error) {
+	if m.deleteAlarmsFunc != nil {
+		return m.deleteAlarmsFunc(input)
+	}
+
+	return nil, fmt.Errorf("DeleteAlarms not implemented")
+}
+
+// mockCloudWatchLogs simulates the ship's log book for testing.
+type mockCloudWatchLogs struct {
+	CloudWatchLogsAPI
+	describeLogGroupsFunc   func(*cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error)
+	listTagsForResourceFunc func(*cloudwatchlogs.ListTagsForResourceInput) (*cloudwatchlogs.ListTagsForResourceOutput, error)
+	tagResourceFunc         func(*cloudwatchlogs.TagResourceInput) (*cloudwatchlogs.TagResourceOutput, error)
+	putRetentionPolicyFunc  func(*cloudwatchlogs.PutRetentionPolicyInput) (*cloudwatchlogs.PutRetentionPolicyOutput, error)
+}
+
+// DescribeLogGroups returns mock response or error based on the configured function.
+func (m *mockCloudWatchLogs) DescribeLogGroups(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	if m.describeLogGroupsFunc != nil {
+		return m.describeLogGroupsFunc(input)
+	}
+
+	return nil, fmt.Errorf("DescribeLogGroups not implemented")
+}
+
+// ListTagsForResource returns mock response or error based on the configured function.
+func (m *mockCloudWatchLogs) ListTagsForResource(input *cloudwatchlogs.ListTagsForResourceInput) (*cloudwatchlogs.ListTagsForResourceOutput, error) {
+	if m.listTagsForResourceFunc != nil {
+		return m.listTagsForResourceFunc(input)
+	}
+
+	return nil, fmt.Errorf("ListTagsForResource not implemented")
+}
+
+// TagResource returns mock response or error based on the configured function.
+func (m *mockCloudWatchLogs) TagResource(input *cloudwatchlogs.TagResourceInput) (*cloudwatchlogs.TagResourceOutput, error) {
+	if m.tagResourceFunc != nil {
+		return m.tagResourceFunc(input)
+	}
+
+	return nil, fmt.Errorf("TagResource not implemented")
+}
+
+// PutRetentionPolicy returns mock response or error based on the configured function.
+func (m *mockCloudWatchLogs) PutRetentionPolicy(input *cloudwatchlogs.PutRetentionPolicyInput) (*cloudwatchlogs.PutRetentionPolicyOutput, error) {
+	if m.putRetentionPolicyFunc != nil {
+		return m.putRetentionPolicyFunc(input)
+	}
+
+	return nil, fmt.Errorf("PutRetentionPolicy not implemented")
+}
+
+// mockApplicationAutoScaling simulates the crew scheduling office for testing.
+type mockApplicationAutoScaling struct {
+	ApplicationAutoScalingAPI
+	describeScalableTargetsFunc   func(*applicationautoscaling.DescribeScalableTargetsInput) (*applicationautoscaling.DescribeScalableTargetsOutput, error)
+	listTagsForResourceFunc       func(*applicationautoscaling.ListTagsForResourceInput) (*applicationautoscaling.ListTagsForResourceOutput, error)
+	tagResourceFunc               func(*applicationautoscaling.TagResourceInput) (*applicationautoscaling.TagResourceOutput, error)
+	describeScalingActivitiesFunc func(*applicationautoscaling.DescribeScalingActivitiesInput) (*applicationautoscaling.DescribeScalingActivitiesOutput, error)
+}
+
+// DescribeScalableTargets returns mock response or error based on the configured function.
+func (m *mockApplicationAutoScaling) DescribeScalableTargets(input *applicationautoscaling.DescribeScalableTargetsInput) (*applicationautoscaling.DescribeScalableTargetsOutput, error) {
+	if m.describeScalableTargetsFunc != nil {
+		return m.describeScalableTargetsFunc(input)
+	}
+
+	return nil, fmt.Errorf("DescribeScalableTargets not implemented")
+}
+
+// ListTagsForResource returns mock response or error based on the configured function.
+func (m *mockApplicationAutoScaling) ListTagsForResource(input *applicationautoscaling.ListTagsForResourceInput) (*applicationautoscaling.ListTagsForResourceOutput, error) {
+	if m.listTagsForResourceFunc != nil {
+		return m.listTagsForResourceFunc(input)
+	}
+
+	return nil, fmt.Errorf("ListTagsForResource not implemented")
+}
+
+// TagResource returns mock response or error based on the configured function.
+func (m *mockApplicationAutoScaling) TagResource(input *applicationautoscaling.TagResourceInput) (*applicationautoscaling.TagResourceOutput, error) {
+	if m.tagResourceFunc != nil {
+		return m.tagResourceFunc(input)
+	}
+
+	return nil, fmt.Errorf("TagResource not implemented")
+}
+
+// DescribeScalingActivities returns mock response or error based on the configured function.
+func (m *mockApplicationAutoScaling) DescribeScalingActivities(input *applicationautoscaling.DescribeScalingActivitiesInput) (*applicationautoscaling.DescribeScalingActivitiesOutput, error) {
+	if m.describeScalingActivitiesFunc != nil {
+		return m.describeScalingActivitiesFunc(input)
+	}
+
+	return nil, fmt.Errorf("DescribeScalingActivities not implemented")
+}
+
+// mockEventBridge simulates the Planet Express delivery announcements for testing.
+type mockEventBridge struct {
+	EventBridgeAPI
+	putEventsFunc func(*eventbridge.PutEventsInput) (*eventbridge.PutEventsOutput, error)
+}
+
+// PutEvents returns mock response or error based on the configured function.
+func (m *mockEventBridge) PutEvents(input *eventbridge.PutEventsInput) (*eventbridge.PutEventsOutput, error) {
+	if m.putEventsFunc != nil {
+		return m.putEventsFunc(input)
+	}
+
+	return nil, fmt.Errorf("PutEvents not implemented")
+}
+
+// discardLogs silences the global logrus logger used by HandleRequest for the duration of the test.
+func discardLogs(t *testing.T) {
+	t.Helper()
+
+	logrus.SetOutput(io.Discard)
+	t.Cleanup(func() {
+		logrus.SetOutput(os.Stdout)
+	})
+}
+
 // TestHandler_HandleRequest tests all paths of the HandleRequest method.
 // Each test case is named after a Futurama character and simulates their unique scenarios:
 //   - Nibbler: Non-autoscaling instance that should be skipped.
@@ -133,8 +350,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "non-autoscaling instance",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`{"SourceIdentifier": "nibbler"}`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "nibbler"}`),
+				Region:     "us-east-1",
 			},
 			envVars: map[string]string{
 				"RDS_CLUSTER_IDENTIFIER": "planet-express",
@@ -148,8 +367,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "sts get caller identity error",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`{"SourceIdentifier": "application-autoscaling-hypnotoad"}`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-hypnotoad"}`),
+				Region:     "us-east-1",
 			},
 			envVars: map[string]string{
 				"RDS_CLUSTER_IDENTIFIER": "planet-express",
@@ -167,8 +388,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "permission denied error",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`{"SourceIdentifier": "application-autoscaling-fry"}`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-fry"}`),
+				Region:     "us-east-1",
 			},
 			envVars: map[string]string{
 				"RDS_CLUSTER_IDENTIFIER": "planet-express",
@@ -196,8 +419,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "instance from different cluster",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`{"SourceIdentifier": "application-autoscaling-mom"}`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-mom"}`),
+				Region:     "us-east-1",
 			},
 			envVars: map[string]string{
 				"RDS_CLUSTER_IDENTIFIER": "planet-express",
@@ -222,8 +447,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "invalid event detail",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`invalid json`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`invalid json`),
+				Region:     "us-east-1",
 			},
 			envVars: map[string]string{
 				"RDS_CLUSTER_IDENTIFIER": "planet-express",
@@ -237,8 +464,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "add tags error",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`{"SourceIdentifier": "application-autoscaling-zoidberg"}`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-zoidberg"}`),
+				Region:     "us-east-1",
 			},
 			envVars: map[string]string{
 				"RDS_CLUSTER_IDENTIFIER": "planet-express",
@@ -266,8 +495,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "autoscaling instance with valid cluster",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`{"SourceIdentifier": "application-autoscaling-fry"}`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-fry"}`),
+				Region:     "us-east-1",
 			},
 			envVars: map[string]string{
 				"RDS_CLUSTER_IDENTIFIER": "planet-express",
@@ -281,8 +512,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "autoscaling instance with invalid tags JSON",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`{"SourceIdentifier": "application-autoscaling-leela"}`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-leela"}`),
+				Region:     "us-east-1",
 			},
 			envVars: map[string]string{
 				"RDS_CLUSTER_IDENTIFIER": "planet-express",
@@ -296,8 +529,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "missing RDS_CLUSTER_IDENTIFIER",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`{"SourceIdentifier": "application-autoscaling-amy"}`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-amy"}`),
+				Region:     "us-east-1",
 			},
 			envVars: map[string]string{
 				"RDS_CLUSTER_IDENTIFIER": "",
@@ -311,8 +546,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "missing RDS_CLUSTER_IDENTIFIER environment variable",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`{"SourceIdentifier": "application-autoscaling-hermes"}`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-hermes"}`),
+				Region:     "us-east-1",
 			},
 			rds:     defaultMockRDS,
 			sts:     defaultMockSTS,
@@ -322,8 +559,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "get cluster identifier error",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`{"SourceIdentifier": "application-autoscaling-scruffy"}`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-scruffy"}`),
+				Region:     "us-east-1",
 			},
 			envVars: map[string]string{
 				"RDS_CLUSTER_IDENTIFIER": "planet-express",
@@ -341,8 +580,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "instance from different cluster",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`{"SourceIdentifier": "application-autoscaling-mom"}`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-mom"}`),
+				Region:     "us-east-1",
 			},
 			envVars: map[string]string{
 				"RDS_CLUSTER_IDENTIFIER": "planet-express",
@@ -366,8 +607,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "aws api throttling error",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`{"SourceIdentifier": "application-autoscaling-bender"}`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-bender"}`),
+				Region:     "us-east-1",
 			},
 			envVars: map[string]string{
 				"RDS_CLUSTER_IDENTIFIER": "planet-express",
@@ -388,8 +631,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "malformed arn",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`{"SourceIdentifier": "application-autoscaling-leela"}`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-leela"}`),
+				Region:     "us-east-1",
 			},
 			envVars: map[string]string{
 				"RDS_CLUSTER_IDENTIFIER": "planet-express",
@@ -406,8 +651,10 @@ func TestHandler_HandleRequest(t *testing.T) {
 		{
 			name: "missing environment variables",
 			event: events.CloudWatchEvent{
-				Detail: []byte(`{"SourceIdentifier": "application-autoscaling-zoidberg"}`),
-				Region: "us-east-1",
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-zoidberg"}`),
+				Region:     "us-east-1",
 			},
 			envVars: map[string]string{},
 			rds:     defaultMockRDS,
@@ -480,7 +727,7 @@ func TestHandler_HandleRequest(t *testing.T) {
 			ctx := lambdacontext.NewContext(context.Background(), lc)
 
 			// Run the handler and verify results.
-			err := handler.HandleRequest(ctx, tt.event)
+			_, err := handler.HandleRequest(ctx, tt.event)
 			if tt.wantErr {
 				assert.Error(t, err, "Handler should return error")
 			} else {
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// IdempotencyStore records processed event IDs so duplicate deliveries are skipped.
+type IdempotencyStore interface {
+	// Claim records eventID and reports whether it is seen for the first time.
+	Claim(eventID string) (bool, error)
+	// Release forgets eventID so that a failed event can be retried.
+	Release(eventID string) error
+}
+
+// DynamoDBAPI defines the DynamoDB operations we use for conditional writes and reads.
+type DynamoDBAPI interface {
+	GetItem(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
+	PutItem(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
+	DeleteItem(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
+	TransactWriteItems(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// MemoryIdempotencyStore keeps claimed event IDs in memory, it is meant for tests and local runs.
+type MemoryIdempotencyStore struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+// NewMemoryIdempotencyStore creates a MemoryIdempotencyStore forgetting claims after ttl.
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		seen: make(map[string]time.Time),
+		ttl:  ttl,
+		now:  time.Now,
+	}
+}
+
+// Claim records eventID unless it was claimed before and has not expired yet.
+func (s *MemoryIdempotencyStore) Claim(eventID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if expiresAt, ok := s.seen[eventID]; ok && now.Before(expiresAt) {
+		return false, nil
+	}
+
+	s.seen[eventID] = now.Add(s.ttl)
+
+	return true, nil
+}
+
+// Release forgets eventID.
+func (s *MemoryIdempotencyStore) Release(eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.seen, eventID)
+
+	return nil
+}
+
+// DynamoDBIdempotencyStore claims event IDs with conditional writes to a DynamoDB table.
+// The table needs a string hash key named event_id, expires_at can be used as its TTL attribute.
+type DynamoDBIdempotencyStore struct {
+	client DynamoDBAPI
+	table  string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewDynamoDBIdempotencyStore creates a DynamoDBIdempotencyStore backed by the given table.
+func NewDynamoDBIdempotencyStore(client DynamoDBAPI, table string, ttl time.Duration) *DynamoDBIdempotencyStore {
+	return &DynamoDBIdempotencyStore{
+		client: client,
+		table:  table,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Claim writes the event ID unless an unexpired record for it already exists.
+func (s *DynamoDBIdempotencyStore) Claim(eventID string) (bool, error) {
+	now := s.now()
+
+	_, err := s.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"event_id":   {S: aws.String(eventID)},
+			"expires_at": {N: aws.String(strconv.FormatInt(now.Add(s.ttl).Unix(), 10))},
+		},
+		// DynamoDB TTL deletes lazily, so expired records are treated as absent.
+		ConditionExpression: aws.String("attribute_not_exists(event_id) OR expires_at < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to claim event %s: %w", eventID, err)
+	}
+
+	return true, nil
+}
+
+// Release deletes the record of eventID.
+func (s *DynamoDBIdempotencyStore) Release(eventID string) error {
+	_, err := s.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"event_id": {S: aws.String(eventID)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release event %s: %w", eventID, err)
+	}
+
+	return nil
+}
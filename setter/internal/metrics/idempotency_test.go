@@ -0,0 +1,216 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockDynamoDB simulates the Central Bureaucracy filing cabinets for testing.
+type mockDynamoDB struct {
+	DynamoDBAPI
+	getItemFunc    func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
+	putItemFunc    func(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
+	deleteItemFunc func(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
+	transactFunc   func(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// GetItem returns mock response or error based on the configured function.
+func (m *mockDynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	if m.getItemFunc != nil {
+		return m.getItemFunc(input)
+	}
+
+	return nil, fmt.Errorf("GetItem not implemented")
+}
+
+// PutItem returns mock response or error based on the configured function.
+func (m *mockDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	if m.putItemFunc != nil {
+		return m.putItemFunc(input)
+	}
+
+	return nil, fmt.Errorf("PutItem not implemented")
+}
+
+// DeleteItem returns mock response or error based on the configured function.
+func (m *mockDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	if m.deleteItemFunc != nil {
+		return m.deleteItemFunc(input)
+	}
+
+	return nil, fmt.Errorf("DeleteItem not implemented")
+}
+
+// TransactWriteItems returns mock response or error based on the configured function.
+func (m *mockDynamoDB) TransactWriteItems(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	if m.transactFunc != nil {
+		return m.transactFunc(input)
+	}
+
+	return nil, fmt.Errorf("TransactWriteItems not implemented")
+}
+
+// TestMemoryIdempotencyStore verifies claims, expiry and release of the in-memory store.
+func TestMemoryIdempotencyStore(t *testing.T) {
+	now := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryIdempotencyStore(time.Hour)
+	store.now = func() time.Time { return now }
+
+	first, err := store.Claim("event-1")
+	require.NoError(t, err)
+	assert.True(t, first)
+
+	first, err = store.Claim("event-1")
+	require.NoError(t, err)
+	assert.False(t, first, "second delivery should be a duplicate")
+
+	require.NoError(t, store.Release("event-1"))
+
+	first, err = store.Claim("event-1")
+	require.NoError(t, err)
+	assert.True(t, first, "released event should be claimable again")
+
+	now = now.Add(2 * time.Hour)
+
+	first, err = store.Claim("event-1")
+	require.NoError(t, err)
+	assert.True(t, first, "expired claim should be claimable again")
+}
+
+// TestDynamoDBIdempotencyStore verifies the conditional write and its error handling.
+func TestDynamoDBIdempotencyStore(t *testing.T) {
+	tests := []struct {
+		name      string
+		putErr    error
+		wantFirst bool
+		wantErr   bool
+	}{
+		{
+			name:      "first delivery",
+			wantFirst: true,
+		},
+		{
+			name:   "duplicate delivery",
+			putErr: awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil),
+		},
+		{
+			name:    "table unavailable",
+			putErr:  awserr.New(dynamodb.ErrCodeResourceNotFoundException, "Requested resource not found", nil),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDynamoDB{
+				putItemFunc: func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+					assert.Equal(t, "planet-express-ledger", aws.StringValue(input.TableName))
+					assert.Equal(t, "event-1", aws.StringValue(input.Item["event_id"].S))
+					assert.Equal(t, "32503683600", aws.StringValue(input.Item["expires_at"].N))
+					assert.Equal(t, "32503680000", aws.StringValue(input.ExpressionAttributeValues[":now"].N))
+
+					return &dynamodb.PutItemOutput{}, tt.putErr
+				},
+			}
+
+			store := NewDynamoDBIdempotencyStore(mock, "planet-express-ledger", time.Hour)
+			store.now = func() time.Time { return time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+			first, err := store.Claim("event-1")
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantFirst, first)
+		})
+	}
+}
+
+// TestHandler_HandleRequestIdempotency checks that duplicates are skipped and failures can be retried.
+func TestHandler_HandleRequestIdempotency(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	addTagsCalls := 0
+	failAddTags := true
+
+	mock := &mockRDS{
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			return &rds.DescribeDBInstancesOutput{
+				DBInstances: []*rds.DBInstance{
+					{
+						DBClusterIdentifier: aws.String("planet-express"),
+						DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-cubert"),
+					},
+				},
+			}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			addTagsCalls++
+
+			if failAddTags {
+				return nil, fmt.Errorf("cubert broke the tagging machine")
+			}
+
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+	}
+	stsMock := &mockSTS{
+		getCallerIdentityFunc: func(input *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+			return &sts.GetCallerIdentityOutput{Account: aws.String("123456789012")}, nil
+		},
+	}
+
+	recorder := &countingRecorder{}
+	discardLogs(t)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	handler := NewHandler(logger, mock, stsMock,
+		WithRecorder(recorder),
+		WithIdempotencyStore(NewMemoryIdempotencyStore(time.Hour)),
+	)
+
+	event := events.CloudWatchEvent{
+		ID:         "cubert-clone",
+		Source:     "aws.rds",
+		DetailType: "RDS DB Instance Event",
+		Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-cubert"}`),
+		Region:     "us-east-1",
+	}
+
+	// The first delivery fails, so the retry must be processed again.
+	result, err := handler.HandleRequest(context.Background(), event)
+	assert.Error(t, err)
+	assert.Equal(t, OutcomeFailed, result.Outcome)
+
+	failAddTags = false
+
+	result, err = handler.HandleRequest(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Equal(t, OutcomeTagged, result.Outcome)
+	assert.Equal(t, 2, addTagsCalls)
+
+	// The same event delivered after success is a duplicate.
+	result, err = handler.HandleRequest(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Equal(t, OutcomeDuplicate, result.Outcome)
+	assert.Equal(t, 2, addTagsCalls)
+	assert.Equal(t, 1, recorder.counts[MetricDuplicateEvent])
+}
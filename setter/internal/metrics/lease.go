@@ -0,0 +1,420 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrLeaseLost is returned when a replica writes shared state after it lost the leader lease.
+var ErrLeaseLost = errors.New("leader lease lost")
+
+// Lease is a leadership claim shared by the replicas of a daemon deployment, held by at most one
+// of them until it expires.
+type Lease interface {
+	// Acquire takes the lease for holder when it is free or expired, or extends it when holder
+	// already has it, and reports whether holder has the lease for the next ttl.
+	Acquire(holder string, ttl time.Duration) (bool, error)
+	// Release gives up the lease if holder has it, so another replica can take over at once.
+	Release(holder string) error
+}
+
+// MemoryLease keeps the lease in memory, it is meant for tests and single process runs.
+type MemoryLease struct {
+	mu        sync.Mutex
+	holder    string
+	expiresAt time.Time
+	now       func() time.Time
+}
+
+// NewMemoryLease creates a free MemoryLease.
+func NewMemoryLease() *MemoryLease {
+	return &MemoryLease{now: time.Now}
+}
+
+// Acquire takes or extends the lease unless another holder has an unexpired lease.
+func (l *MemoryLease) Acquire(holder string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if l.holder != "" && l.holder != holder && now.Before(l.expiresAt) {
+		return false, nil
+	}
+
+	l.holder, l.expiresAt = holder, now.Add(ttl)
+
+	return true, nil
+}
+
+// Release frees the lease if holder has it.
+func (l *MemoryLease) Release(holder string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.holder == holder {
+		l.holder, l.expiresAt = "", time.Time{}
+	}
+
+	return nil
+}
+
+// DynamoDBLease keeps the lease in an item of a DynamoDB table, taken and extended with conditional writes.
+// The table needs a string hash key named id, it can be shared with DynamoDBCursorStore.
+type DynamoDBLease struct {
+	client DynamoDBAPI
+	table  string
+	id     string
+	now    func() time.Time
+}
+
+// NewDynamoDBLease creates a DynamoDBLease stored in the item id of table.
+func NewDynamoDBLease(client DynamoDBAPI, table, id string) *DynamoDBLease {
+	return &DynamoDBLease{
+		client: client,
+		table:  table,
+		id:     id,
+		now:    time.Now,
+	}
+}
+
+// Acquire writes holder to the lease item unless another holder has an unexpired lease.
+func (l *DynamoDBLease) Acquire(holder string, ttl time.Duration) (bool, error) {
+	now := l.now()
+
+	_, err := l.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(l.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id":         {S: aws.String(l.id)},
+			"holder":     {S: aws.String(holder)},
+			"expires_at": {N: aws.String(strconv.FormatInt(now.Add(ttl).UnixMilli(), 10))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(id) OR expires_at < :now OR holder = :holder"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now":    {N: aws.String(strconv.FormatInt(now.UnixMilli(), 10))},
+			":holder": {S: aws.String(holder)},
+		},
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to acquire lease %s: %w", l.id, err)
+	}
+
+	return true, nil
+}
+
+// Release deletes the lease item if holder has it.
+func (l *DynamoDBLease) Release(holder string) error {
+	_, err := l.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(l.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(l.id)},
+		},
+		ConditionExpression: aws.String("holder = :holder"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":holder": {S: aws.String(holder)},
+		},
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return nil
+		}
+
+		return fmt.Errorf("failed to release lease %s: %w", l.id, err)
+	}
+
+	return nil
+}
+
+// DynamoDBCursorStore keeps the poller cursor in an item of a DynamoDB table, so a replica taking over
+// the lease continues where the previous leader stopped. The table needs a string hash key named id.
+type DynamoDBCursorStore struct {
+	client DynamoDBAPI
+	table  string
+	id     string
+	now    func() time.Time
+
+	// leaseID and holder fence saves to the holder of the lease, saves are unconditional when leaseID is empty.
+	leaseID string
+	holder  string
+}
+
+// NewDynamoDBCursorStore creates a DynamoDBCursorStore stored in the item id of table.
+func NewDynamoDBCursorStore(client DynamoDBAPI, table, id string) *DynamoDBCursorStore {
+	return &DynamoDBCursorStore{
+		client: client,
+		table:  table,
+		id:     id,
+		now:    time.Now,
+	}
+}
+
+// FencedBy makes saves fail with ErrLeaseLost unless holder has the unexpired lease in the item leaseID of the
+// same table, so a deposed leader cannot move the cursor back after the new leader advanced it.
+func (s *DynamoDBCursorStore) FencedBy(leaseID, holder string) *DynamoDBCursorStore {
+	s.leaseID, s.holder = leaseID, holder
+	return s
+}
+
+// Load reads the cursor item, a missing item means no cursor was saved yet.
+func (s *DynamoDBCursorStore) Load() (Cursor, bool, error) {
+	output, err := s.client.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(s.id)},
+		},
+	})
+	if err != nil {
+		return Cursor{}, false, fmt.Errorf("failed to read cursor %s: %w", s.id, err)
+	}
+
+	attr, ok := output.Item["cursor"]
+	if !ok || attr.S == nil {
+		return Cursor{}, false, nil
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal([]byte(aws.StringValue(attr.S)), &cursor); err != nil {
+		return Cursor{}, false, fmt.Errorf("failed to decode cursor %s: %w", s.id, err)
+	}
+
+	return cursor, true, nil
+}
+
+// Save writes the cursor item, in one transaction with a check of the lease when the store is fenced.
+func (s *DynamoDBCursorStore) Save(cursor Cursor) error {
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		return err
+	}
+
+	item := map[string]*dynamodb.AttributeValue{
+		"id":     {S: aws.String(s.id)},
+		"cursor": {S: aws.String(string(raw))},
+	}
+
+	if s.leaseID == "" {
+		_, err = s.client.PutItem(&dynamodb.PutItemInput{TableName: aws.String(s.table), Item: item})
+		if err != nil {
+			return fmt.Errorf("failed to save cursor %s: %w", s.id, err)
+		}
+
+		return nil
+	}
+
+	_, err = s.client.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				ConditionCheck: &dynamodb.ConditionCheck{
+					TableName: aws.String(s.table),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(s.leaseID)},
+					},
+					ConditionExpression: aws.String("holder = :holder AND expires_at > :now"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":holder": {S: aws.String(s.holder)},
+						":now":    {N: aws.String(strconv.FormatInt(s.now().UnixMilli(), 10))},
+					},
+				},
+			},
+			{
+				Put: &dynamodb.Put{TableName: aws.String(s.table), Item: item},
+			},
+		},
+	})
+	if err != nil {
+		var canceled *dynamodb.TransactionCanceledException
+		if errors.As(err, &canceled) && len(canceled.CancellationReasons) > 0 &&
+			aws.StringValue(canceled.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+			return fmt.Errorf("%w: %s cannot save cursor %s", ErrLeaseLost, s.holder, s.id)
+		}
+
+		return fmt.Errorf("failed to save cursor %s: %w", s.id, err)
+	}
+
+	return nil
+}
+
+// Elector keeps acquiring a Lease for one replica and tracks whether the replica is the leader.
+// Leadership is only assumed until the lease acquired last would expire, so a replica that cannot
+// renew steps down before another one can take over.
+type Elector struct {
+	logger logrus.FieldLogger
+	lease  Lease
+	holder string
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu         sync.Mutex
+	validUntil time.Time
+	err        error
+}
+
+// NewElector creates an Elector acquiring lease as holder for ttl at a time.
+func NewElector(logger logrus.FieldLogger, lease Lease, holder string, ttl time.Duration) *Elector {
+	return &Elector{
+		logger: logger,
+		lease:  lease,
+		holder: holder,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// NewElectorFromEnv creates an Elector for the lease of the configured cluster in the LEASE_TABLE DynamoDB table,
+// held for LEASE_TTL (default 30s) by LEASE_HOLDER (default host name and process ID). It returns nil when
+// LEASE_TABLE is unset, leader election is then disabled.
+func NewElectorFromEnv(logger logrus.FieldLogger, sess client.ConfigProvider) (*Elector, error) {
+	table := os.Getenv("LEASE_TABLE")
+	if table == "" {
+		return nil, nil
+	}
+
+	ttl := 30 * time.Second
+
+	if raw := os.Getenv("LEASE_TTL"); raw != "" {
+		var err error
+
+		ttl, err = time.ParseDuration(raw)
+		if err != nil || ttl < 3*time.Second {
+			return nil, fmt.Errorf("LEASE_TTL must be a duration of at least 3s, got %q", raw)
+		}
+	}
+
+	holder, err := leaseHolderFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	lease := NewDynamoDBLease(dynamodb.New(sess), table, leaseIDFromEnv())
+
+	return NewElector(logger, lease, holder, ttl), nil
+}
+
+// leaseHolderFromEnv returns LEASE_HOLDER, or the host name and process ID when it is unset.
+func leaseHolderFromEnv() (string, error) {
+	if holder := os.Getenv("LEASE_HOLDER"); holder != "" {
+		return holder, nil
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to get host name for LEASE_HOLDER: %w", err)
+	}
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid()), nil
+}
+
+// leaseIDFromEnv returns the ID of the lease item of the configured cluster.
+func leaseIDFromEnv() string {
+	return "leader/" + os.Getenv("RDS_CLUSTER_IDENTIFIER")
+}
+
+// Run acquires the lease at once and then every third of its ttl until ctx is cancelled, and
+// releases it before returning.
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		e.Campaign()
+
+		select {
+		case <-ctx.Done():
+			e.resign()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Campaign tries to acquire the lease once and reports whether this replica is the leader.
+func (e *Elector) Campaign() bool {
+	// The lease is counted from before the call, the store counts it from a later time.
+	start := e.now()
+	acquired, err := e.lease.Acquire(e.holder, e.ttl)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	wasLeader := start.Before(e.validUntil)
+	e.err = err
+
+	switch {
+	case err != nil:
+		// The lease may still be ours, but it cannot be renewed, so stop acting on it.
+		e.validUntil = time.Time{}
+		e.logger.Printf("Error acquiring leader lease as %s: %v", e.holder, err)
+	case acquired:
+		e.validUntil = start.Add(e.ttl)
+	default:
+		e.validUntil = time.Time{}
+	}
+
+	isLeader := !e.validUntil.IsZero()
+
+	switch {
+	case isLeader && !wasLeader:
+		e.logger.Printf("Acquired leader lease as %s", e.holder)
+	case !isLeader && wasLeader:
+		e.logger.Printf("Lost leader lease as %s", e.holder)
+	}
+
+	return isLeader
+}
+
+// IsLeader reports whether this replica has the lease.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.now().Before(e.validUntil)
+}
+
+// Ready returns the error of the last acquisition attempt, followers that reach the lease store are ready.
+func (e *Elector) Ready() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.err != nil {
+		return fmt.Errorf("leader lease unavailable: %w", e.err)
+	}
+
+	return nil
+}
+
+// resign releases the lease so a follower can take over without waiting for it to expire.
+func (e *Elector) resign() {
+	e.mu.Lock()
+	wasLeader := e.now().Before(e.validUntil)
+	e.validUntil = time.Time{}
+	e.mu.Unlock()
+
+	if !wasLeader {
+		return
+	}
+
+	if err := e.lease.Release(e.holder); err != nil {
+		e.logger.Printf("Error releasing leader lease as %s: %v", e.holder, err)
+		return
+	}
+
+	e.logger.Printf("Released leader lease as %s", e.holder)
+}
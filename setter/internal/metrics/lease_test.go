@@ -0,0 +1,324 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingLease fails every call, like a lease table that cannot be reached.
+type failingLease struct{}
+
+// Acquire always fails.
+func (failingLease) Acquire(string, time.Duration) (bool, error) {
+	return false, errors.New("the Central Bureaucracy is closed")
+}
+
+// Release always fails.
+func (failingLease) Release(string) error {
+	return errors.New("the Central Bureaucracy is closed")
+}
+
+// TestMemoryLease verifies contention, renewal, expiry and release of the in-memory lease.
+func TestMemoryLease(t *testing.T) {
+	now := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+	lease := NewMemoryLease()
+	lease.now = func() time.Time { return now }
+
+	acquired, err := lease.Acquire("hermes", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = lease.Acquire("morgan", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired, "the lease is held by another replica")
+
+	now = now.Add(50 * time.Second)
+	acquired, err = lease.Acquire("hermes", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired, "the holder renews the lease")
+
+	now = now.Add(50 * time.Second)
+	acquired, err = lease.Acquire("morgan", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired, "the renewed lease has not expired yet")
+
+	now = now.Add(11 * time.Second)
+	acquired, err = lease.Acquire("morgan", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired, "the expired lease is taken over")
+
+	require.NoError(t, lease.Release("hermes"))
+
+	acquired, err = lease.Acquire("hermes", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired, "only the holder can release the lease")
+
+	require.NoError(t, lease.Release("morgan"))
+
+	acquired, err = lease.Acquire("hermes", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+// TestDynamoDBLease checks the conditional writes of the DynamoDB lease.
+func TestDynamoDBLease(t *testing.T) {
+	now := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+	conditionFailed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "held by someone else", nil)
+
+	tests := []struct {
+		name         string
+		putErr       error
+		wantAcquired bool
+		wantErr      bool
+	}{
+		{
+			name:         "free lease",
+			wantAcquired: true,
+		},
+		{
+			name:   "lease held by another replica",
+			putErr: conditionFailed,
+		},
+		{
+			name:    "table unavailable",
+			putErr:  errors.New("ProvisionedThroughputExceededException"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input *dynamodb.PutItemInput
+
+			mock := &mockDynamoDB{
+				putItemFunc: func(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+					input = in
+					return &dynamodb.PutItemOutput{}, tt.putErr
+				},
+			}
+
+			lease := NewDynamoDBLease(mock, "bureaucracy", "leader/planet-express")
+			lease.now = func() time.Time { return now }
+
+			acquired, err := lease.Acquire("hermes", 30*time.Second)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantAcquired, acquired)
+			require.NotNil(t, input)
+			assert.Equal(t, "leader/planet-express", aws.StringValue(input.Item["id"].S))
+			assert.Equal(t, "hermes", aws.StringValue(input.Item["holder"].S))
+			assert.Equal(t, "32503680030000", aws.StringValue(input.Item["expires_at"].N))
+			assert.Equal(t, "32503680000000", aws.StringValue(input.ExpressionAttributeValues[":now"].N))
+			assert.Contains(t, aws.StringValue(input.ConditionExpression), "holder = :holder")
+		})
+	}
+
+	t.Run("release of a lease held by another replica", func(t *testing.T) {
+		mock := &mockDynamoDB{
+			deleteItemFunc: func(in *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+				assert.Equal(t, "hermes", aws.StringValue(in.ExpressionAttributeValues[":holder"].S))
+				return nil, conditionFailed
+			},
+		}
+
+		assert.NoError(t, NewDynamoDBLease(mock, "bureaucracy", "leader/planet-express").Release("hermes"))
+	})
+}
+
+// TestDynamoDBCursorStore checks that the cursor saved by one replica is loaded by another.
+func TestDynamoDBCursorStore(t *testing.T) {
+	items := make(map[string]map[string]*dynamodb.AttributeValue)
+
+	mock := &mockDynamoDB{
+		getItemFunc: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			assert.True(t, aws.BoolValue(input.ConsistentRead))
+			return &dynamodb.GetItemOutput{Item: items[aws.StringValue(input.Key["id"].S)]}, nil
+		},
+		putItemFunc: func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+			items[aws.StringValue(input.Item["id"].S)] = input.Item
+			return &dynamodb.PutItemOutput{}, nil
+		},
+	}
+
+	_, ok, err := NewDynamoDBCursorStore(mock, "bureaucracy", "cursor/planet-express").Load()
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	cursor := Cursor{
+		Time: time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC),
+		Seen: []string{"application-autoscaling-fry"},
+	}
+	require.NoError(t, NewDynamoDBCursorStore(mock, "bureaucracy", "cursor/planet-express").Save(cursor))
+
+	loaded, ok, err := NewDynamoDBCursorStore(mock, "bureaucracy", "cursor/planet-express").Load()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, cursor, loaded)
+}
+
+// TestDynamoDBCursorStore_Fenced verifies a deposed leader cannot overwrite the cursor of the new leader.
+// Hermes comes back from his vacation to find Number 1.0 at his desk, his old stamps no longer count.
+func TestDynamoDBCursorStore_Fenced(t *testing.T) {
+	now := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+	items := make(map[string]map[string]*dynamodb.AttributeValue)
+
+	// The table keeps its items in memory and checks lease conditions like DynamoDB does.
+	mock := &mockDynamoDB{
+		getItemFunc: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: items[aws.StringValue(input.Key["id"].S)]}, nil
+		},
+		putItemFunc: func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+			items[aws.StringValue(input.Item["id"].S)] = input.Item
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		transactFunc: func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+			require.Len(t, input.TransactItems, 2)
+
+			check := input.TransactItems[0].ConditionCheck
+			require.NotNil(t, check)
+			assert.Equal(t, "holder = :holder AND expires_at > :now", aws.StringValue(check.ConditionExpression))
+
+			lease := items[aws.StringValue(check.Key["id"].S)]
+			held := lease != nil &&
+				aws.StringValue(lease["holder"].S) == aws.StringValue(check.ExpressionAttributeValues[":holder"].S) &&
+				aws.StringValue(lease["expires_at"].N) > aws.StringValue(check.ExpressionAttributeValues[":now"].N)
+
+			if !held {
+				return nil, &dynamodb.TransactionCanceledException{
+					Message_: aws.String("Transaction cancelled"),
+					CancellationReasons: []*dynamodb.CancellationReason{
+						{Code: aws.String("ConditionalCheckFailed")},
+						{Code: aws.String("None")},
+					},
+				}
+			}
+
+			put := input.TransactItems[1].Put
+			items[aws.StringValue(put.Item["id"].S)] = put.Item
+
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+	}
+
+	lease := NewDynamoDBLease(mock, "bureaucracy", "leader/planet-express")
+	lease.now = func() time.Time { return now }
+
+	store := func(holder string) *DynamoDBCursorStore {
+		s := NewDynamoDBCursorStore(mock, "bureaucracy", "cursor/planet-express").FencedBy("leader/planet-express", holder)
+		s.now = func() time.Time { return now }
+
+		return s
+	}
+
+	hermes, number1 := store("hermes"), store("number-1.0")
+
+	acquired, err := lease.Acquire("hermes", 30*time.Second)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	require.NoError(t, hermes.Save(Cursor{Time: now}))
+	assert.ErrorIs(t, number1.Save(Cursor{Time: now}), ErrLeaseLost, "only the leader saves the cursor")
+
+	// Hermes' lease expires while his poll is still running, and Number 1.0 takes over and advances the cursor.
+	now = now.Add(time.Minute)
+
+	acquired, err = lease.Acquire("number-1.0", 30*time.Second)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	advanced := Cursor{Time: now, Seen: []string{"application-autoscaling-fry"}}
+	require.NoError(t, number1.Save(advanced))
+
+	assert.ErrorIs(t, hermes.Save(Cursor{Time: now.Add(-time.Minute)}), ErrLeaseLost)
+
+	loaded, ok, err := number1.Load()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, advanced, loaded)
+
+	t.Run("other transaction failures are not a lost lease", func(t *testing.T) {
+		mock.transactFunc = func(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+			return nil, errors.New("ProvisionedThroughputExceededException")
+		}
+
+		err := number1.Save(advanced)
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrLeaseLost)
+	})
+}
+
+// TestElector covers leader election between two replicas sharing a lease.
+// Hermes and Number 1.0 compete for the bureaucrat grade, only one of them may stamp forms.
+func TestElector(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	now := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	lease := NewMemoryLease()
+	lease.now = clock
+
+	hermes := NewElector(logger, lease, "hermes", 30*time.Second)
+	hermes.now = clock
+	morgan := NewElector(logger, lease, "morgan", 30*time.Second)
+	morgan.now = clock
+
+	assert.True(t, hermes.Campaign())
+	assert.False(t, morgan.Campaign())
+	assert.True(t, hermes.IsLeader())
+	assert.False(t, morgan.IsLeader())
+	assert.NoError(t, morgan.Ready(), "followers are ready")
+
+	// Hermes stops renewing, he stops acting as leader when his lease runs out and Morgan takes over.
+	now = now.Add(20 * time.Second)
+	assert.False(t, morgan.Campaign())
+
+	now = now.Add(11 * time.Second)
+	assert.False(t, hermes.IsLeader())
+	assert.True(t, morgan.Campaign())
+	assert.False(t, hermes.Campaign())
+
+	// Resigning hands the lease over without waiting for it to expire.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	morgan.Run(ctx)
+
+	assert.False(t, morgan.IsLeader())
+	assert.True(t, hermes.Campaign())
+
+	// A replica that cannot reach the lease store steps down and is not ready.
+	hermes.lease = failingLease{}
+	assert.False(t, hermes.Campaign())
+	assert.False(t, hermes.IsLeader())
+	assert.Error(t, hermes.Ready())
+}
+
+// TestNewElectorFromEnv checks that leader election is only enabled with a lease table.
+func TestNewElectorFromEnv(t *testing.T) {
+	t.Setenv("LEASE_TABLE", "")
+
+	elector, err := NewElectorFromEnv(logrus.New(), nil)
+	require.NoError(t, err)
+	assert.Nil(t, elector)
+
+	t.Setenv("LEASE_TABLE", "bureaucracy")
+	t.Setenv("LEASE_TTL", "1s")
+
+	_, err = NewElectorFromEnv(logrus.New(), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ReplicaStore remembers when autoscaled replicas were created, so their lifetime is known once they are deleted.
+type ReplicaStore interface {
+	// Created records the creation time of the replica.
+	Created(dbInstanceID string, at time.Time) error
+	// Removed forgets the replica and returns its creation time, ok is false when it was not recorded.
+	Removed(dbInstanceID string) (at time.Time, ok bool, err error)
+}
+
+// MemoryReplicaStore keeps creation times in memory, it is meant for tests and local runs.
+type MemoryReplicaStore struct {
+	mu      sync.Mutex
+	created map[string]time.Time
+}
+
+// NewMemoryReplicaStore creates an empty MemoryReplicaStore.
+func NewMemoryReplicaStore() *MemoryReplicaStore {
+	return &MemoryReplicaStore{created: make(map[string]time.Time)}
+}
+
+// Created records the creation time of the replica.
+func (s *MemoryReplicaStore) Created(dbInstanceID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.created[dbInstanceID] = at
+
+	return nil
+}
+
+// Removed forgets the replica and returns its creation time.
+func (s *MemoryReplicaStore) Removed(dbInstanceID string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	at, ok := s.created[dbInstanceID]
+	delete(s.created, dbInstanceID)
+
+	return at, ok, nil
+}
+
+// DynamoDBReplicaStore keeps creation times in a DynamoDB table with a string hash key named instance_id.
+type DynamoDBReplicaStore struct {
+	client DynamoDBAPI
+	table  string
+}
+
+// NewDynamoDBReplicaStore creates a DynamoDBReplicaStore backed by the given table.
+func NewDynamoDBReplicaStore(client DynamoDBAPI, table string) *DynamoDBReplicaStore {
+	return &DynamoDBReplicaStore{client: client, table: table}
+}
+
+// Created records the creation time of the replica as unix milliseconds in created_at.
+func (s *DynamoDBReplicaStore) Created(dbInstanceID string, at time.Time) error {
+	_, err := s.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"instance_id": {S: aws.String(dbInstanceID)},
+			"created_at":  {N: aws.String(strconv.FormatInt(at.UnixMilli(), 10))},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record creation of DB instance %s: %w", dbInstanceID, err)
+	}
+
+	return nil
+}
+
+// Removed deletes the record of the replica and returns the creation time it held.
+func (s *DynamoDBReplicaStore) Removed(dbInstanceID string) (time.Time, bool, error) {
+	output, err := s.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"instance_id": {S: aws.String(dbInstanceID)},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+	})
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to remove record of DB instance %s: %w", dbInstanceID, err)
+	}
+
+	attribute, ok := output.Attributes["created_at"]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	millis, err := strconv.ParseInt(aws.StringValue(attribute.N), 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid creation time of DB instance %s: %w", dbInstanceID, err)
+	}
+
+	return time.UnixMilli(millis).UTC(), true, nil
+}
+
+// eventTime returns when RDS says the event happened, falling back to the time EventBridge received it.
+func eventTime(event events.CloudWatchEvent, detail EventDetail) time.Time {
+	if !detail.Date.IsZero() {
+		return detail.Date
+	}
+
+	return event.Time
+}
+
+// recordCreated remembers the creation time of a new replica when a replica store is configured.
+func (h *Handler) recordCreated(dbInstanceID string, at time.Time) error {
+	if h.replicaStore == nil {
+		return nil
+	}
+
+	if err := h.replicaStore.Created(dbInstanceID, at); err != nil {
+		h.logger.Printf("Error recording creation of DB instance %s: %v", dbInstanceID, err)
+		return err
+	}
+
+	return nil
+}
+
+// HandleInstanceDeleted cleans up after a deleted autoscaled replica: it is removed from the custom endpoints it
+// was added to, its alarms are deleted and its lifetime is recorded.
+func (h *Handler) HandleInstanceDeleted(ctx context.Context, event events.CloudWatchEvent) (*Result, error) {
+	return h.process(ctx, event, h.handleInstanceDeleted)
+}
+
+// handleInstanceDeleted cleans up after a single deletion event and records the decision in result.
+func (h *Handler) handleInstanceDeleted(event events.CloudWatchEvent, result *Result) error {
+	expectedClusterID, _, err := h.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	var detail EventDetail
+	if err := json.Unmarshal(event.Detail, &detail); err != nil {
+		return fmt.Errorf("failed to decode RDS instance event detail: %w", err)
+	}
+
+	result.RDSEventID = detail.EventID
+	result.Message = detail.Message
+
+	if err := h.validateEvent(event, detail, rdsEventInstanceDeleted); err != nil {
+		result.Outcome = OutcomeRejected
+		result.Reason = err.Error()
+
+		return err
+	}
+
+	dbInstanceID := detail.SourceIdentifier
+	result.DBInstanceIdentifier = dbInstanceID
+	result.DBInstanceArn = detail.SourceArn
+
+	if !isAutoscaledReplica(dbInstanceID) {
+		result.Outcome = OutcomeSkipped
+		result.Reason = "not an autoscaled replica"
+		h.logger.Printf("Skipping deletion of DB instance %s: %s", dbInstanceID, result.Reason)
+
+		return nil
+	}
+
+	// The instance is gone, so its cluster cannot be looked up. The endpoints of the configured
+	// cluster are searched instead, only endpoints listing the instance are modified.
+	result.ClusterIdentifier = expectedClusterID
+
+	if h.customEndpointsEnabled() {
+		if err := h.updateCustomEndpoints(expectedClusterID, dbInstanceID, false, result); err != nil {
+			return err
+		}
+	}
+
+	if h.cloudwatch != nil && len(h.alarmTemplates) > 0 {
+		if err := h.deleteAlarms(dbInstanceID, result); err != nil {
+			return err
+		}
+	}
+
+	// The record is only removed once the cleanup succeeded, so a retried event still finds it.
+	if h.replicaStore != nil {
+		created, ok, err := h.replicaStore.Removed(dbInstanceID)
+		if err != nil {
+			h.logger.Printf("Error removing record of DB instance %s: %v", dbInstanceID, err)
+			return err
+		}
+
+		if ok {
+			result.Lifetime = eventTime(event, detail).Sub(created).Round(time.Second).String()
+		}
+	}
+
+	result.Outcome = OutcomeRemoved
+	result.Reason = "replica deleted"
+	h.recorder.Inc(MetricReplicaRemoved)
+
+	if result.Lifetime != "" {
+		h.logger.Printf("DB instance %s removed after %s", dbInstanceID, result.Lifetime)
+	} else {
+		h.logger.Printf("DB instance %s removed", dbInstanceID)
+	}
+
+	return nil
+}
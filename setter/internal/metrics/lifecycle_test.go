@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandler_HandleInstanceDeleted covers the cleanup and bookkeeping after deleted replicas.
+// When a crew member leaves, Hermes strikes them from the roster and files how long they lasted.
+func TestHandler_HandleInstanceDeleted(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	created := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	deleted := instanceEvent("RDS-EVENT-0003", "application-autoscaling-fry")
+	deleted.Time = created.Add(26*time.Hour + 30*time.Minute)
+
+	tests := []struct {
+		name         string
+		opts         []Option
+		event        events.CloudWatchEvent
+		members      []string
+		recorded     bool
+		wantOutcome  Outcome
+		wantMembers  []string
+		wantModified int
+		wantLifetime string
+		wantErr      error
+	}{
+		{
+			name:         "removed from the endpoint",
+			opts:         []Option{WithCustomEndpoints("deliveries")},
+			event:        deleted,
+			members:      []string{"planet-express-leela", "application-autoscaling-fry"},
+			wantOutcome:  OutcomeRemoved,
+			wantMembers:  []string{"planet-express-leela"},
+			wantModified: 1,
+		},
+		{
+			name:        "not a member",
+			opts:        []Option{WithCustomEndpoints("deliveries")},
+			event:       deleted,
+			members:     []string{"planet-express-leela"},
+			wantOutcome: OutcomeRemoved,
+			wantMembers: []string{"planet-express-leela"},
+		},
+		{
+			name:        "only member is kept",
+			opts:        []Option{WithCustomEndpoints("deliveries")},
+			event:       deleted,
+			members:     []string{"application-autoscaling-fry"},
+			wantOutcome: OutcomeRemoved,
+			wantMembers: []string{"application-autoscaling-fry"},
+		},
+		{
+			name:         "lifetime of a recorded replica",
+			event:        deleted,
+			members:      []string{"planet-express-leela", "application-autoscaling-fry"},
+			recorded:     true,
+			wantOutcome:  OutcomeRemoved,
+			wantMembers:  []string{"planet-express-leela", "application-autoscaling-fry"},
+			wantLifetime: "26h30m0s",
+		},
+		{
+			name:        "replica created before the store",
+			event:       deleted,
+			members:     []string{"planet-express-leela", "application-autoscaling-fry"},
+			wantOutcome: OutcomeRemoved,
+			wantMembers: []string{"planet-express-leela", "application-autoscaling-fry"},
+		},
+		{
+			name:        "provisioned instance",
+			opts:        []Option{WithCustomEndpoints("deliveries")},
+			event:       instanceEvent("RDS-EVENT-0003", "planet-express-leela"),
+			members:     []string{"planet-express-leela", "application-autoscaling-fry"},
+			wantOutcome: OutcomeSkipped,
+			wantMembers: []string{"planet-express-leela", "application-autoscaling-fry"},
+		},
+		{
+			name:        "creation event",
+			opts:        []Option{WithCustomEndpoints("deliveries")},
+			event:       instanceEvent("RDS-EVENT-0005", "application-autoscaling-fry"),
+			members:     []string{"planet-express-leela", "application-autoscaling-fry"},
+			wantOutcome: OutcomeRejected,
+			wantMembers: []string{"planet-express-leela", "application-autoscaling-fry"},
+			wantErr:     ErrEventRejected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardLogs(t)
+
+			fake := &fakeEndpoints{endpoints: []*rds.DBClusterEndpoint{customEndpoint("deliveries", tt.members...)}}
+
+			store := NewMemoryReplicaStore()
+			if tt.recorded {
+				require.NoError(t, store.Created("application-autoscaling-fry", created))
+			}
+
+			recorder := &countingRecorder{}
+			opts := append([]Option{WithReplicaStore(store), WithRecorder(recorder)}, tt.opts...)
+
+			handler := NewHandler(logrus.New(), fake.mock(), &mockSTS{}, opts...)
+			handler.sleep = func(time.Duration) {}
+
+			result, err := handler.HandleInstanceDeleted(context.Background(), tt.event)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantOutcome, result.Outcome)
+			assert.Equal(t, tt.wantMembers, aws.StringValueSlice(fake.endpoint("deliveries").StaticMembers))
+			assert.Equal(t, tt.wantModified, fake.modified)
+			assert.Equal(t, tt.wantLifetime, result.Lifetime)
+
+			if tt.wantOutcome == OutcomeRemoved {
+				assert.Equal(t, 1, recorder.counts[MetricReplicaRemoved])
+
+				_, ok, err := store.Removed("application-autoscaling-fry")
+				require.NoError(t, err)
+				assert.False(t, ok, "the record is removed with the replica")
+			}
+		})
+	}
+}
+
+// TestHandler_RecordCreated checks that tagged replicas are recorded with the time of their creation event.
+func TestHandler_RecordCreated(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	created := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	event := instanceEvent("RDS-EVENT-0005", "application-autoscaling-fry")
+	event.Time = created.Add(time.Minute)
+	event.Detail = []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-fry",
+		"SourceArn": "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry", "Date": "3000-01-01T00:00:00Z"}`)
+
+	fake := &fakeEndpoints{}
+	store := NewMemoryReplicaStore()
+
+	handler := NewHandler(logrus.New(), fake.mock(), &mockSTS{}, WithReplicaStore(store))
+
+	result, err := handler.HandleRequest(context.Background(), event)
+	require.NoError(t, err)
+	assert.Equal(t, OutcomeTagged, result.Outcome)
+
+	at, ok, err := store.Removed("application-autoscaling-fry")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, created, at, "the RDS event date is preferred over the EventBridge time")
+}
+
+// TestDynamoDBReplicaStore checks the records kept in DynamoDB.
+func TestDynamoDBReplicaStore(t *testing.T) {
+	items := make(map[string]map[string]*dynamodb.AttributeValue)
+
+	mock := &mockDynamoDB{
+		putItemFunc: func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+			assert.Equal(t, "crew", aws.StringValue(input.TableName))
+			items[aws.StringValue(input.Item["instance_id"].S)] = input.Item
+
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		deleteItemFunc: func(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+			assert.Equal(t, dynamodb.ReturnValueAllOld, aws.StringValue(input.ReturnValues))
+
+			id := aws.StringValue(input.Key["instance_id"].S)
+			old := items[id]
+			delete(items, id)
+
+			return &dynamodb.DeleteItemOutput{Attributes: old}, nil
+		},
+	}
+
+	store := NewDynamoDBReplicaStore(mock, "crew")
+	created := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, store.Created("application-autoscaling-fry", created))
+	assert.Equal(t, "32503680000000", aws.StringValue(items["application-autoscaling-fry"]["created_at"].N))
+
+	at, ok, err := store.Removed("application-autoscaling-fry")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, created, at)
+
+	_, ok, err = store.Removed("application-autoscaling-fry")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	mock.deleteItemFunc = func(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+		return nil, errors.New("the crew quarters are flooded")
+	}
+
+	_, _, err = store.Removed("application-autoscaling-fry")
+	assert.Error(t, err)
+}
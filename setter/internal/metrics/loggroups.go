@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// logRetentionDays are the retention periods PutRetentionPolicy accepts.
+var logRetentionDays = []int64{1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1096, 1827, 2192, 2557, 2922, 3288, 3653}
+
+// ValidLogRetention reports whether days is a retention period CloudWatch Logs accepts.
+func ValidLogRetention(days int64) bool {
+	for _, valid := range logRetentionDays {
+		if days == valid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// instanceLogGroupPrefix is the common prefix of the log groups RDS exports the instance's logs to.
+func instanceLogGroupPrefix(dbInstanceID string) string {
+	return "/aws/rds/instance/" + dbInstanceID + "/"
+}
+
+// tagLogGroups applies the configured tags to the log export groups of the replica and sets their retention.
+// RDS creates the groups shortly after the instance, so the function waits until a group exists for every
+// enabled log export, up to the attempts used while waiting for new instances. Groups still missing then are
+// left to the next time the replica is handled.
+func (h *Handler) tagLogGroups(dbInstanceID string, result *Result) error {
+	if h.logs == nil {
+		return nil
+	}
+
+	_, tagsMap, err := h.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	exports, err := h.logExports(dbInstanceID)
+	if err != nil {
+		return err
+	}
+
+	if len(exports) == 0 {
+		return nil
+	}
+
+	prefix := instanceLogGroupPrefix(dbInstanceID)
+
+	var groups []*cloudwatchlogs.LogGroup
+
+	for attempt := 1; ; attempt++ {
+		groups, err = h.describeLogGroups(prefix)
+		if err != nil {
+			return err
+		}
+
+		missing := missingLogGroups(prefix, exports, groups)
+		if len(missing) == 0 {
+			break
+		}
+
+		if attempt >= h.resourceWaitAttempts {
+			h.logger.Printf("Log groups of DB instance %s not created yet, leaving them: %v", dbInstanceID, missing)
+			break
+		}
+
+		h.logger.Printf("Waiting %s for log groups of DB instance %s (attempt %d/%d): %v",
+			h.resourceWaitDelay, dbInstanceID, attempt, h.resourceWaitAttempts, missing)
+		if err := h.wait(h.resourceWaitDelay); err != nil {
+			return err
+		}
+	}
+
+	for _, group := range groups {
+		if err := h.tagLogGroup(group, tagsMap); err != nil {
+			h.logger.Printf("Error updating log group %s: %v", aws.StringValue(group.LogGroupName), err)
+			return err
+		}
+
+		result.LogGroups = append(result.LogGroups, aws.StringValue(group.LogGroupName))
+	}
+
+	return nil
+}
+
+// tagLogGroup writes the tags that are missing or differ and sets the retention where it differs.
+func (h *Handler) tagLogGroup(group *cloudwatchlogs.LogGroup, tagsMap map[string]string) error {
+	name := aws.StringValue(group.LogGroupName)
+	// DescribeLogGroups reports the ARN with a trailing :*, the tagging API wants it without.
+	arn := strings.TrimSuffix(aws.StringValue(group.Arn), ":*")
+
+	output, err := h.logs.ListTagsForResource(&cloudwatchlogs.ListTagsForResourceInput{ResourceArn: aws.String(arn)})
+	if err != nil {
+		return fmt.Errorf("failed to list tags of log group %s: %w", name, err)
+	}
+
+	if changes := changedTags(tagsMap, aws.StringValueMap(output.Tags)); len(changes) > 0 {
+		_, err := h.logs.TagResource(&cloudwatchlogs.TagResourceInput{
+			ResourceArn: aws.String(arn),
+			Tags:        aws.StringMap(changes),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to tag log group %s: %w", name, err)
+		}
+
+		h.logger.Printf("Tagged log group %s with %d tags", name, len(changes))
+	}
+
+	if h.logRetention > 0 && aws.Int64Value(group.RetentionInDays) != h.logRetention {
+		_, err := h.logs.PutRetentionPolicy(&cloudwatchlogs.PutRetentionPolicyInput{
+			LogGroupName:    aws.String(name),
+			RetentionInDays: aws.Int64(h.logRetention),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set retention of log group %s: %w", name, err)
+		}
+
+		h.logger.Printf("Set retention of log group %s to %d days", name, h.logRetention)
+	}
+
+	return nil
+}
+
+// logExports returns the log types the instance exports to CloudWatch Logs.
+func (h *Handler) logExports(dbInstanceID string) ([]string, error) {
+	output, err := h.rds.DescribeDBInstances(&rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: aws.String(dbInstanceID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe DB instance %s: %w", dbInstanceID, err)
+	}
+
+	if len(output.DBInstances) == 0 {
+		return nil, fmt.Errorf("DB instance %s not found", dbInstanceID)
+	}
+
+	return aws.StringValueSlice(output.DBInstances[0].EnabledCloudwatchLogsExports), nil
+}
+
+// describeLogGroups lists the log groups whose names start with prefix.
+func (h *Handler) describeLogGroups(prefix string) ([]*cloudwatchlogs.LogGroup, error) {
+	input := &cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: aws.String(prefix)}
+
+	var groups []*cloudwatchlogs.LogGroup
+
+	for {
+		output, err := h.logs.DescribeLogGroups(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe log groups %s*: %w", prefix, err)
+		}
+
+		groups = append(groups, output.LogGroups...)
+
+		if aws.StringValue(output.NextToken) == "" {
+			return groups, nil
+		}
+
+		input.NextToken = output.NextToken
+	}
+}
+
+// missingLogGroups returns the exported log types that have no log group yet, sorted.
+func missingLogGroups(prefix string, exports []string, groups []*cloudwatchlogs.LogGroup) []string {
+	existing := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		existing[strings.TrimPrefix(aws.StringValue(group.LogGroupName), prefix)] = true
+	}
+
+	var missing []string
+
+	for _, export := range exports {
+		if !existing[export] {
+			missing = append(missing, export)
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing
+}
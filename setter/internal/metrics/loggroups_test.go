@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandler_TagLogGroups covers tagging the log export groups of new replicas and setting their retention.
+// Fry's diary gets the same Planet Express stamp as Fry, and is shredded after a month.
+func TestHandler_TagLogGroups(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth","Purpose":"delivery-company"}`)
+
+	const prefix = "/aws/rds/instance/application-autoscaling-fry/"
+
+	group := func(log string, retention int64) *cloudwatchlogs.LogGroup {
+		g := &cloudwatchlogs.LogGroup{
+			LogGroupName: aws.String(prefix + log),
+			Arn:          aws.String("arn:aws:logs:us-east-1:123456789012:log-group:" + prefix + log + ":*"),
+		}
+		if retention > 0 {
+			g.RetentionInDays = aws.Int64(retention)
+		}
+
+		return g
+	}
+
+	tests := []struct {
+		name          string
+		exports       []string
+		groups        []*cloudwatchlogs.LogGroup
+		tags          map[string]string
+		createdAfter  int
+		retention     int64
+		wantGroups    []string
+		wantTagged    map[string]map[string]string
+		wantRetention []string
+		wantDescribes int
+	}{
+		{
+			name:       "existing groups are tagged",
+			exports:    []string{"postgresql"},
+			groups:     []*cloudwatchlogs.LogGroup{group("postgresql", 0)},
+			wantGroups: []string{prefix + "postgresql"},
+			wantTagged: map[string]map[string]string{
+				prefix + "postgresql": {"Owner": "professor-farnsworth", "Purpose": "delivery-company"},
+			},
+			wantDescribes: 1,
+		},
+		{
+			name:         "groups created late are waited for",
+			exports:      []string{"audit", "error"},
+			groups:       []*cloudwatchlogs.LogGroup{group("audit", 0), group("error", 0)},
+			createdAfter: 2,
+			retention:    30,
+			wantGroups:   []string{prefix + "audit", prefix + "error"},
+			wantTagged: map[string]map[string]string{
+				prefix + "audit": {"Owner": "professor-farnsworth", "Purpose": "delivery-company"},
+				prefix + "error": {"Owner": "professor-farnsworth", "Purpose": "delivery-company"},
+			},
+			wantRetention: []string{prefix + "audit", prefix + "error"},
+			wantDescribes: 4,
+		},
+		{
+			name:          "groups never created are left",
+			exports:       []string{"audit", "error"},
+			groups:        []*cloudwatchlogs.LogGroup{group("error", 30)},
+			retention:     30,
+			wantGroups:    []string{prefix + "error"},
+			wantTagged:    map[string]map[string]string{prefix + "error": {"Owner": "professor-farnsworth", "Purpose": "delivery-company"}},
+			wantDescribes: 5,
+		},
+		{
+			name:          "changed values are overwritten",
+			exports:       []string{"postgresql"},
+			groups:        []*cloudwatchlogs.LogGroup{group("postgresql", 0)},
+			tags:          map[string]string{"Owner": "bender", "Purpose": "delivery-company"},
+			wantGroups:    []string{prefix + "postgresql"},
+			wantTagged:    map[string]map[string]string{prefix + "postgresql": {"Owner": "professor-farnsworth"}},
+			wantDescribes: 1,
+		},
+		{
+			name:          "tags already present",
+			exports:       []string{"postgresql"},
+			groups:        []*cloudwatchlogs.LogGroup{group("postgresql", 0)},
+			tags:          map[string]string{"Owner": "professor-farnsworth", "Purpose": "delivery-company"},
+			wantGroups:    []string{prefix + "postgresql"},
+			wantTagged:    map[string]map[string]string{},
+			wantDescribes: 1,
+		},
+		{
+			name:       "no log exports",
+			wantTagged: map[string]map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardLogs(t)
+
+			var (
+				describes int
+				retention []string
+			)
+
+			tagged := make(map[string]map[string]string)
+
+			rdsMock := &mockRDS{
+				describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+					return &rds.DescribeDBInstancesOutput{DBInstances: []*rds.DBInstance{{
+						DBClusterIdentifier:          aws.String("planet-express"),
+						DBInstanceArn:                aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+						EnabledCloudwatchLogsExports: aws.StringSlice(tt.exports),
+					}}}, nil
+				},
+				addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+					return &rds.AddTagsToResourceOutput{}, nil
+				},
+			}
+			logsMock := &mockCloudWatchLogs{
+				describeLogGroupsFunc: func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+					describes++
+					assert.Equal(t, prefix, aws.StringValue(input.LogGroupNamePrefix))
+
+					if describes <= tt.createdAfter {
+						return &cloudwatchlogs.DescribeLogGroupsOutput{}, nil
+					}
+
+					// One group per page.
+					start := 0
+					if token := aws.StringValue(input.NextToken); token != "" {
+						for i, g := range tt.groups {
+							if aws.StringValue(g.LogGroupName) == token {
+								start = i
+							}
+						}
+					}
+
+					output := &cloudwatchlogs.DescribeLogGroupsOutput{LogGroups: tt.groups[start : start+1]}
+					if start+1 < len(tt.groups) {
+						output.NextToken = tt.groups[start+1].LogGroupName
+					}
+
+					return output, nil
+				},
+				listTagsForResourceFunc: func(input *cloudwatchlogs.ListTagsForResourceInput) (*cloudwatchlogs.ListTagsForResourceOutput, error) {
+					assert.False(t, strings.HasSuffix(aws.StringValue(input.ResourceArn), ":*"))
+					return &cloudwatchlogs.ListTagsForResourceOutput{Tags: aws.StringMap(tt.tags)}, nil
+				},
+				tagResourceFunc: func(input *cloudwatchlogs.TagResourceInput) (*cloudwatchlogs.TagResourceOutput, error) {
+					name := strings.TrimPrefix(aws.StringValue(input.ResourceArn), "arn:aws:logs:us-east-1:123456789012:log-group:")
+					tagged[name] = aws.StringValueMap(input.Tags)
+
+					return &cloudwatchlogs.TagResourceOutput{}, nil
+				},
+				putRetentionPolicyFunc: func(input *cloudwatchlogs.PutRetentionPolicyInput) (*cloudwatchlogs.PutRetentionPolicyOutput, error) {
+					assert.Equal(t, tt.retention, aws.Int64Value(input.RetentionInDays))
+					retention = append(retention, aws.StringValue(input.LogGroupName))
+
+					return &cloudwatchlogs.PutRetentionPolicyOutput{}, nil
+				},
+			}
+
+			handler := NewHandler(logrus.New(), rdsMock, &mockSTS{}, WithLogGroups(logsMock, tt.retention))
+			handler.sleep = func(time.Duration) {}
+
+			result, err := handler.HandleRequest(context.Background(), instanceEvent("RDS-EVENT-0005", "application-autoscaling-fry"))
+			require.NoError(t, err)
+
+			assert.Equal(t, OutcomeTagged, result.Outcome)
+			assert.Equal(t, tt.wantGroups, result.LogGroups)
+			assert.Equal(t, tt.wantTagged, tagged)
+			assert.Equal(t, tt.wantRetention, retention)
+			assert.Equal(t, tt.wantDescribes, describes)
+		})
+	}
+}
+
+// TestValidLogRetention checks the retention periods CloudWatch Logs accepts.
+func TestValidLogRetention(t *testing.T) {
+	assert.True(t, ValidLogRetention(30))
+	assert.True(t, ValidLogRetention(3653))
+	assert.False(t, ValidLogRetention(0))
+	assert.False(t, ValidLogRetention(42))
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import "context"
+
+// Observer is told the result of every processed event and of every replica handled by a sweep or catch-up.
+// Observers are called once the handler is done with the invocation, ctx ends deadlineMargin before the
+// invocation deadline and observers should give up on slow work when it is done.
+type Observer interface {
+	Observe(ctx context.Context, result *Result)
+}
+
+// WithObserver adds an observer of handler results.
+func WithObserver(observer Observer) Option {
+	return func(h *Handler) {
+		h.observers = append(h.observers, observer)
+	}
+}
+
+// observe passes the results to every observer. It is called without holding h.mu, so a slow observer does not
+// hold up the next invocation.
+func (h *Handler) observe(ctx context.Context, results ...*Result) {
+	if len(h.observers) == 0 || len(results) == 0 {
+		return
+	}
+
+	ctx, cancel := observeContext(ctx)
+	defer cancel()
+
+	for _, observer := range h.observers {
+		for _, result := range results {
+			observer.Observe(ctx, result)
+		}
+	}
+}
+
+// observeContext derives the context of observers from the invocation context, it ends deadlineMargin before the
+// invocation deadline.
+func observeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithDeadline(ctx, deadline.Add(-deadlineMargin))
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingObserver keeps every observed result.
+type recordingObserver struct {
+	results []*Result
+}
+
+// Observe records the result.
+func (o *recordingObserver) Observe(_ context.Context, result *Result) {
+	o.results = append(o.results, result)
+}
+
+// TestHandler_Observers checks that every observer sees the result of a processed event.
+// Both Hermes and the Central Bureaucracy need a copy of every form.
+func TestHandler_Observers(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	hermes, bureaucracy := &recordingObserver{}, &recordingObserver{}
+	handler := NewHandler(logrus.New(), &mockRDS{}, &mockSTS{}, WithObserver(hermes), WithObserver(bureaucracy))
+
+	result, err := handler.HandleRequest(context.Background(), events.CloudWatchEvent{
+		ID:         "form-1729-b",
+		Source:     "aws.rds",
+		DetailType: "RDS DB Instance Event",
+		Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "planet-express-writer"}`),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, OutcomeSkipped, result.Outcome)
+	assert.Equal(t, []*Result{result}, hermes.results)
+	assert.Equal(t, []*Result{result}, bureaucracy.results)
+}
+
+// lockCheckingObserver records whether the handler was free and the deadline it was given while observing.
+type lockCheckingObserver struct {
+	handler  *Handler
+	free     bool
+	deadline time.Time
+}
+
+// Observe records whether the handler lock can be taken and the deadline of ctx.
+func (o *lockCheckingObserver) Observe(ctx context.Context, _ *Result) {
+	if o.handler.mu.TryLock() {
+		o.free = true
+		o.handler.mu.Unlock()
+	}
+
+	o.deadline, _ = ctx.Deadline()
+}
+
+// TestHandler_ObserversAfterInvocation checks that observers run without holding up the handler and have to be done
+// deadlineMargin before the invocation deadline. Hermes may only file his report once the delivery is over.
+func TestHandler_ObserversAfterInvocation(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	hermes := &lockCheckingObserver{}
+	handler := NewHandler(logrus.New(), &mockRDS{}, &mockSTS{}, WithObserver(hermes))
+	hermes.handler = handler
+
+	deadline := time.Now().Add(time.Minute)
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	_, err := handler.HandleRequest(ctx, events.CloudWatchEvent{
+		ID:         "form-1729-c",
+		Source:     "aws.rds",
+		DetailType: "RDS DB Instance Event",
+		Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "planet-express-writer"}`),
+	})
+	require.NoError(t, err)
+
+	assert.True(t, hermes.free)
+	assert.Equal(t, deadline.Add(-deadlineMargin), hermes.deadline)
+}
@@ -0,0 +1,483 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Option customizes a Handler created by NewHandler.
+type Option func(*Handler)
+
+// WithRecorder sets the metrics recorder used by the handler.
+func WithRecorder(recorder Recorder) Option {
+	return func(h *Handler) {
+		h.recorder = recorder
+	}
+}
+
+// WithTagVerification enables reading tags back after they are applied.
+// The read is attempted up to attempts times, waiting delay between attempts.
+func WithTagVerification(attempts int, delay time.Duration) Option {
+	return func(h *Handler) {
+		h.verifyAttempts = attempts
+		h.verifyDelay = delay
+	}
+}
+
+// WithIdempotencyStore enables skipping of events whose ID was already processed.
+func WithIdempotencyStore(store IdempotencyStore) Option {
+	return func(h *Handler) {
+		h.idempotency = store
+	}
+}
+
+// WithMaxEventAge treats events older than maxAge as stale and handles them according to mode.
+func WithMaxEventAge(maxAge time.Duration, mode StaleEventMode) Option {
+	return func(h *Handler) {
+		h.maxEventAge = maxAge
+		h.staleEventMode = mode
+	}
+}
+
+// WithAllowedAccounts only accepts events from the given AWS account IDs.
+func WithAllowedAccounts(accountIDs ...string) Option {
+	return func(h *Handler) {
+		h.allowedAccounts = stringSet(accountIDs)
+	}
+}
+
+// WithAllowedRegions only accepts events from the given AWS regions.
+func WithAllowedRegions(regions ...string) Option {
+	return func(h *Handler) {
+		h.allowedRegions = stringSet(regions)
+	}
+}
+
+// WithInheritedTagKeys propagates changes of the given cluster tag keys to the replicas of the cluster.
+func WithInheritedTagKeys(keys ...string) Option {
+	return func(h *Handler) {
+		h.inheritedTagKeys = stringSet(keys)
+	}
+}
+
+// WithCustomEndpoints adds new replicas to the static members of the named custom endpoints of the cluster.
+func WithCustomEndpoints(endpointIDs ...string) Option {
+	return func(h *Handler) {
+		h.customEndpoints = stringSet(endpointIDs)
+	}
+}
+
+// WithCustomEndpointTagRule adds new replicas to the static members of the custom endpoints of the cluster
+// carrying the tag of rule.
+func WithCustomEndpointTagRule(rule EndpointTagRule) Option {
+	return func(h *Handler) {
+		h.endpointTagRule = &rule
+	}
+}
+
+// WithAlarms creates alarms from the templates for each new replica and deletes them when the replica is deleted.
+func WithAlarms(client CloudWatchAPI, templates ...AlarmTemplate) Option {
+	return func(h *Handler) {
+		h.cloudwatch = client
+		h.alarmTemplates = templates
+	}
+}
+
+// WithLogGroups tags the log export groups of new replicas like the replicas themselves. A retention in days
+// is set on the groups unless it is zero.
+func WithLogGroups(client CloudWatchLogsAPI, retentionDays int64) Option {
+	return func(h *Handler) {
+		h.logs = client
+		h.logRetention = retentionDays
+	}
+}
+
+// WithScalableTargetTagging tags the Application Auto Scaling scalable target of the cluster at startup and
+// during sweeps, see Handler.TagScalableTargetOnStart.
+func WithScalableTargetTagging(client ApplicationAutoScalingAPI) Option {
+	return func(h *Handler) {
+		h.autoscaling = client
+	}
+}
+
+// WithDomainEvents publishes a "Replica Tagged" event to the named event bus after tags are added to a replica.
+// The cause of the latest scaling activity of the cluster is read through activities unless it is nil.
+func WithDomainEvents(client EventBridgeAPI, bus string, activities ApplicationAutoScalingAPI) Option {
+	return func(h *Handler) {
+		h.eventBridge = client
+		h.eventBusName = bus
+		h.scalingActivities = activities
+	}
+}
+
+// WithAuditSink writes an audit record of every result to sink.
+func WithAuditSink(sink AuditSink) Option {
+	return func(h *Handler) {
+		h.auditSink = sink
+	}
+}
+
+// WithReplicaStore records the creation of new replicas in store, so their lifetime is reported on deletion.
+func WithReplicaStore(store ReplicaStore) Option {
+	return func(h *Handler) {
+		h.replicaStore = store
+	}
+}
+
+// WithInstanceSettings modifies new replicas after tagging where they differ from settings. In dry-run mode
+// the differences are only logged and reported.
+func WithInstanceSettings(settings InstanceSettings, dryRun bool) Option {
+	return func(h *Handler) {
+		h.instanceSettings = &settings
+		h.settingsDryRun = dryRun
+	}
+}
+
+// WithPromotionTier keeps autoscaled replicas at the promotion tier, new replicas are modified after tagging
+// and sweeps modify replicas that are out of policy. In dry-run mode the differences are only logged and reported.
+func WithPromotionTier(tier int64, dryRun bool) Option {
+	return func(h *Handler) {
+		h.promotionTier = &tier
+		h.settingsDryRun = dryRun
+	}
+}
+
+// WithInstanceSettingsWait sets how long a new replica may take to become available before it is modified.
+func WithInstanceSettingsWait(wait time.Duration) Option {
+	return func(h *Handler) {
+		h.settingsWait = wait
+	}
+}
+
+// WithCatchUpLookback recovers creation events of the last lookback at startup, see Handler.CatchUpOnStart.
+func WithCatchUpLookback(lookback time.Duration) Option {
+	return func(h *Handler) {
+		h.catchUpLookback = lookback
+	}
+}
+
+// OptionsFromEnv builds handler options from the optional environment variables.
+// AWS clients needed by the enabled features are created from sess.
+func OptionsFromEnv(sess client.ConfigProvider) ([]Option, error) {
+	var opts []Option
+
+	if raw := os.Getenv("ALLOWED_ACCOUNT_IDS"); raw != "" {
+		opts = append(opts, WithAllowedAccounts(splitList(raw)...))
+	}
+
+	if raw := os.Getenv("ALLOWED_REGIONS"); raw != "" {
+		opts = append(opts, WithAllowedRegions(splitList(raw)...))
+	}
+
+	if raw := os.Getenv("INHERITED_TAG_KEYS"); raw != "" {
+		opts = append(opts, WithInheritedTagKeys(splitList(raw)...))
+	}
+
+	if raw := os.Getenv("CUSTOM_ENDPOINTS"); raw != "" {
+		opts = append(opts, WithCustomEndpoints(splitList(raw)...))
+	}
+
+	if raw := os.Getenv("CUSTOM_ENDPOINT_TAG"); raw != "" {
+		rule, err := ParseEndpointTagRule(raw)
+		if err != nil {
+			return nil, fmt.Errorf("CUSTOM_ENDPOINT_TAG: %w", err)
+		}
+
+		opts = append(opts, WithCustomEndpointTagRule(rule))
+	}
+
+	if raw := os.Getenv("ALARM_TEMPLATES"); raw != "" {
+		templates, err := ParseAlarmTemplates(raw)
+		if err != nil {
+			return nil, fmt.Errorf("ALARM_TEMPLATES: %w", err)
+		}
+
+		if len(templates) > 0 {
+			opts = append(opts, WithAlarms(cloudwatch.New(sess), templates...))
+		}
+	}
+
+	settingsOpts, err := instanceSettingsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, settingsOpts...)
+
+	if namespace := os.Getenv("METRICS_NAMESPACE"); namespace != "" {
+		opts = append(opts, WithRecorder(NewEMFRecorder(os.Stdout, namespace)))
+	}
+
+	if raw := os.Getenv("VERIFY_TAGS_ATTEMPTS"); raw != "" {
+		attempts, err := strconv.Atoi(raw)
+		if err != nil || attempts < 0 {
+			return nil, fmt.Errorf("VERIFY_TAGS_ATTEMPTS must be a non-negative integer, got %q", raw)
+		}
+
+		delay := time.Second
+
+		if rawDelay := os.Getenv("VERIFY_TAGS_DELAY"); rawDelay != "" {
+			delay, err = time.ParseDuration(rawDelay)
+			if err != nil {
+				return nil, fmt.Errorf("VERIFY_TAGS_DELAY must be a duration: %w", err)
+			}
+		}
+
+		opts = append(opts, WithTagVerification(attempts, delay))
+	}
+
+	if raw := os.Getenv("MAX_EVENT_AGE"); raw != "" {
+		maxAge, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("MAX_EVENT_AGE must be a duration: %w", err)
+		}
+
+		mode := StaleEventIgnore
+
+		if rawMode := os.Getenv("STALE_EVENT_MODE"); rawMode != "" {
+			mode, err = ParseStaleEventMode(rawMode)
+			if err != nil {
+				return nil, fmt.Errorf("STALE_EVENT_MODE: %w", err)
+			}
+		}
+
+		opts = append(opts, WithMaxEventAge(maxAge, mode))
+	}
+
+	if raw := os.Getenv("CATCH_UP_LOOKBACK"); raw != "" {
+		lookback, err := time.ParseDuration(raw)
+		if err != nil || lookback < 0 || lookback > maxCatchUpLookback {
+			return nil, fmt.Errorf("CATCH_UP_LOOKBACK must be a duration up to %s, got %q", maxCatchUpLookback, raw)
+		}
+
+		opts = append(opts, WithCatchUpLookback(lookback))
+	}
+
+	if table := os.Getenv("IDEMPOTENCY_TABLE"); table != "" {
+		ttl := 24 * time.Hour
+
+		if raw := os.Getenv("IDEMPOTENCY_TTL"); raw != "" {
+			var err error
+
+			ttl, err = time.ParseDuration(raw)
+			if err != nil {
+				return nil, fmt.Errorf("IDEMPOTENCY_TTL must be a duration: %w", err)
+			}
+		}
+
+		opts = append(opts, WithIdempotencyStore(NewDynamoDBIdempotencyStore(dynamodb.New(sess), table, ttl)))
+	}
+
+	logOpts, err := logGroupsFromEnv(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, logOpts...)
+
+	if raw := os.Getenv("TAG_SCALABLE_TARGET"); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("TAG_SCALABLE_TARGET must be true or false, got %q", raw)
+		}
+
+		if enabled {
+			opts = append(opts, WithScalableTargetTagging(applicationautoscaling.New(sess)))
+		}
+	}
+
+	if bus := os.Getenv("EVENT_BUS_NAME"); bus != "" {
+		opts = append(opts, WithDomainEvents(eventbridge.New(sess), bus, applicationautoscaling.New(sess)))
+	}
+
+	auditOpts, err := auditFromEnv(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, auditOpts...)
+
+	if table := os.Getenv("REPLICA_TABLE"); table != "" {
+		opts = append(opts, WithReplicaStore(NewDynamoDBReplicaStore(dynamodb.New(sess), table)))
+	}
+
+	return opts, nil
+}
+
+// splitList splits a comma-separated list, entries are trimmed and empty ones dropped.
+func splitList(raw string) []string {
+	var values []string
+
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// instanceSettingsFromEnv builds the options modifying replicas, the dry-run mode and the wait for an available
+// replica are shared by the instance settings and the enforced promotion tier.
+func instanceSettingsFromEnv() ([]Option, error) {
+	var (
+		opts     []Option
+		settings *InstanceSettings
+		tier     *int64
+		dryRun   bool
+	)
+
+	if raw := os.Getenv("INSTANCE_SETTINGS"); raw != "" {
+		parsed, err := ParseInstanceSettings(raw)
+		if err != nil {
+			return nil, fmt.Errorf("INSTANCE_SETTINGS: %w", err)
+		}
+
+		settings = &parsed
+	}
+
+	if raw := os.Getenv("ENFORCE_PROMOTION_TIER"); raw != "" {
+		enforce, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("ENFORCE_PROMOTION_TIER must be true or false, got %q", raw)
+		}
+
+		if enforce {
+			tier = aws.Int64(defaultPromotionTier)
+		}
+	}
+
+	if raw := os.Getenv("PROMOTION_TIER"); raw != "" {
+		if tier == nil {
+			return nil, errors.New("PROMOTION_TIER requires ENFORCE_PROMOTION_TIER")
+		}
+
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 || parsed > 15 {
+			return nil, fmt.Errorf("PROMOTION_TIER must be an integer between 0 and 15, got %q", raw)
+		}
+
+		tier = &parsed
+	}
+
+	if settings == nil && tier == nil {
+		return nil, nil
+	}
+
+	if settings != nil && tier != nil && settings.PromotionTier != nil && *settings.PromotionTier != *tier {
+		return nil, fmt.Errorf("INSTANCE_SETTINGS promotion_tier %d conflicts with PROMOTION_TIER %d", *settings.PromotionTier, *tier)
+	}
+
+	if raw := os.Getenv("INSTANCE_SETTINGS_DRY_RUN"); raw != "" {
+		var err error
+
+		dryRun, err = strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("INSTANCE_SETTINGS_DRY_RUN must be true or false, got %q", raw)
+		}
+	}
+
+	if settings != nil {
+		opts = append(opts, WithInstanceSettings(*settings, dryRun))
+	}
+
+	if tier != nil {
+		opts = append(opts, WithPromotionTier(*tier, dryRun))
+	}
+
+	if raw := os.Getenv("INSTANCE_SETTINGS_WAIT"); raw != "" {
+		wait, err := time.ParseDuration(raw)
+		if err != nil || wait < 0 {
+			return nil, fmt.Errorf("INSTANCE_SETTINGS_WAIT must be a non-negative duration, got %q", raw)
+		}
+
+		opts = append(opts, WithInstanceSettingsWait(wait))
+	}
+
+	return opts, nil
+}
+
+// logGroupsFromEnv builds the option tagging log export groups, a retention requires tagging to be enabled.
+func logGroupsFromEnv(sess client.ConfigProvider) ([]Option, error) {
+	enabled := false
+
+	if raw := os.Getenv("TAG_LOG_GROUPS"); raw != "" {
+		var err error
+
+		enabled, err = strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("TAG_LOG_GROUPS must be true or false, got %q", raw)
+		}
+	}
+
+	var retention int64
+
+	if raw := os.Getenv("LOG_GROUP_RETENTION_DAYS"); raw != "" && raw != "0" {
+		var err error
+
+		retention, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || !ValidLogRetention(retention) {
+			return nil, fmt.Errorf("LOG_GROUP_RETENTION_DAYS must be one of %v, got %q", logRetentionDays, raw)
+		}
+
+		if !enabled {
+			return nil, errors.New("LOG_GROUP_RETENTION_DAYS requires TAG_LOG_GROUPS")
+		}
+	}
+
+	if !enabled {
+		return nil, nil
+	}
+
+	return []Option{WithLogGroups(cloudwatchlogs.New(sess), retention)}, nil
+}
+
+// auditFromEnv builds the option writing audit records to the sink named by AUDIT_SINK.
+func auditFromEnv(sess client.ConfigProvider) ([]Option, error) {
+	var sink AuditSink
+
+	switch kind := os.Getenv("AUDIT_SINK"); kind {
+	case "":
+		return nil, nil
+	case "stdout":
+		sink = NewWriterAuditSink(os.Stdout)
+	case "file":
+		path := os.Getenv("AUDIT_FILE")
+		if path == "" {
+			return nil, errors.New("AUDIT_SINK file requires AUDIT_FILE")
+		}
+
+		sink = NewFileAuditSink(path)
+	case "s3":
+		bucket := os.Getenv("AUDIT_BUCKET")
+		if bucket == "" {
+			return nil, errors.New("AUDIT_SINK s3 requires AUDIT_BUCKET")
+		}
+
+		sink = NewS3AuditSink(s3.New(sess), bucket, os.Getenv("AUDIT_PREFIX"))
+	case "dynamodb":
+		table := os.Getenv("AUDIT_TABLE")
+		if table == "" {
+			return nil, errors.New("AUDIT_SINK dynamodb requires AUDIT_TABLE")
+		}
+
+		sink = NewDynamoDBAuditSink(dynamodb.New(sess), table)
+	default:
+		return nil, fmt.Errorf("AUDIT_SINK must be stdout, file, s3 or dynamodb, got %q", kind)
+	}
+
+	return []Option{WithAuditSink(sink)}, nil
+}
@@ -0,0 +1,248 @@
+package metrics
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOptionsFromEnv verifies parsing of optional environment configuration.
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		envVars       map[string]string
+		wantErr       bool
+		wantAttempts  int
+		wantDelay     time.Duration
+		wantDryRun    bool
+		wantTier      *int64
+		wantAudit     AuditSink
+		wantAccounts  map[string]bool
+		wantRegions   map[string]bool
+		wantInherited map[string]bool
+		wantEndpoints map[string]bool
+	}{
+		{
+			name: "nothing configured",
+		},
+		{
+			name: "verification with custom delay",
+			envVars: map[string]string{
+				"VERIFY_TAGS_ATTEMPTS": "4",
+				"VERIFY_TAGS_DELAY":    "250ms",
+			},
+			wantAttempts: 4,
+			wantDelay:    250 * time.Millisecond,
+		},
+		{
+			name: "verification with default delay",
+			envVars: map[string]string{
+				"VERIFY_TAGS_ATTEMPTS": "2",
+			},
+			wantAttempts: 2,
+			wantDelay:    time.Second,
+		},
+		{
+			name: "invalid attempts",
+			envVars: map[string]string{
+				"VERIFY_TAGS_ATTEMPTS": "many",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid delay",
+			envVars: map[string]string{
+				"VERIFY_TAGS_ATTEMPTS": "2",
+				"VERIFY_TAGS_DELAY":    "a while",
+			},
+			wantErr: true,
+		},
+		{
+			name: "instance settings in dry-run mode",
+			envVars: map[string]string{
+				"INSTANCE_SETTINGS":         `{"promotion_tier": 15}`,
+				"INSTANCE_SETTINGS_DRY_RUN": "true",
+			},
+			wantDryRun: true,
+		},
+		{
+			name: "invalid instance settings",
+			envVars: map[string]string{
+				"INSTANCE_SETTINGS": `{"promotion_tier": "lowest"}`,
+			},
+			wantErr: true,
+		},
+		{
+			name: "promotion tier enforced with the default tier",
+			envVars: map[string]string{
+				"ENFORCE_PROMOTION_TIER": "true",
+			},
+			wantTier: aws.Int64(15),
+		},
+		{
+			name: "promotion tier enforced with a configured tier",
+			envVars: map[string]string{
+				"ENFORCE_PROMOTION_TIER":    "true",
+				"PROMOTION_TIER":            "12",
+				"INSTANCE_SETTINGS_DRY_RUN": "true",
+			},
+			wantDryRun: true,
+			wantTier:   aws.Int64(12),
+		},
+		{
+			name: "promotion tier without enforcement",
+			envVars: map[string]string{
+				"PROMOTION_TIER": "12",
+			},
+			wantErr: true,
+		},
+		{
+			name: "promotion tier with enforcement disabled",
+			envVars: map[string]string{
+				"ENFORCE_PROMOTION_TIER": "false",
+				"PROMOTION_TIER":         "12",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid promotion tier",
+			envVars: map[string]string{
+				"ENFORCE_PROMOTION_TIER": "true",
+				"PROMOTION_TIER":         "16",
+			},
+			wantErr: true,
+		},
+		{
+			name: "promotion tier conflicting with instance settings",
+			envVars: map[string]string{
+				"INSTANCE_SETTINGS":      `{"promotion_tier": 1}`,
+				"ENFORCE_PROMOTION_TIER": "true",
+			},
+			wantErr: true,
+		},
+		{
+			name: "log group retention without tagging",
+			envVars: map[string]string{
+				"LOG_GROUP_RETENTION_DAYS": "30",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid log group retention",
+			envVars: map[string]string{
+				"TAG_LOG_GROUPS":           "true",
+				"LOG_GROUP_RETENTION_DAYS": "42",
+			},
+			wantErr: true,
+		},
+		{
+			name: "audit records in the function logs",
+			envVars: map[string]string{
+				"AUDIT_SINK": "stdout",
+			},
+			wantAudit: NewWriterAuditSink(os.Stdout),
+		},
+		{
+			name: "audit records in a local file",
+			envVars: map[string]string{
+				"AUDIT_SINK": "file",
+				"AUDIT_FILE": "/tmp/hermes-ledger.jsonl",
+			},
+			wantAudit: NewFileAuditSink("/tmp/hermes-ledger.jsonl"),
+		},
+		{
+			name: "audit bucket missing",
+			envVars: map[string]string{
+				"AUDIT_SINK": "s3",
+			},
+			wantErr: true,
+		},
+		{
+			name: "audit table missing",
+			envVars: map[string]string{
+				"AUDIT_SINK": "dynamodb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown audit sink",
+			envVars: map[string]string{
+				"AUDIT_SINK": "central-bureaucracy",
+			},
+			wantErr: true,
+		},
+		{
+			name: "allowed origins with spaces",
+			envVars: map[string]string{
+				"ALLOWED_ACCOUNT_IDS": "123, 456",
+				"ALLOWED_REGIONS":     " us-east-1 ,, eu-west-1 ",
+			},
+			wantAccounts: map[string]bool{"123": true, "456": true},
+			wantRegions:  map[string]bool{"us-east-1": true, "eu-west-1": true},
+		},
+		{
+			name: "inherited tag keys with spaces",
+			envVars: map[string]string{
+				"INHERITED_TAG_KEYS": "Team, CostCenter,",
+			},
+			wantInherited: map[string]bool{"Team": true, "CostCenter": true},
+		},
+		{
+			name: "custom endpoints with spaces",
+			envVars: map[string]string{
+				"CUSTOM_ENDPOINTS": "reporting, , analytics ",
+			},
+			wantEndpoints: map[string]bool{"reporting": true, "analytics": true},
+		},
+		{
+			name: "invalid endpoint tag rule",
+			envVars: map[string]string{
+				"CUSTOM_ENDPOINT_TAG": "analytics",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"METRICS_NAMESPACE", "VERIFY_TAGS_ATTEMPTS", "VERIFY_TAGS_DELAY",
+				"INSTANCE_SETTINGS", "INSTANCE_SETTINGS_DRY_RUN", "ENFORCE_PROMOTION_TIER", "PROMOTION_TIER", "CUSTOM_ENDPOINT_TAG",
+				"TAG_LOG_GROUPS", "LOG_GROUP_RETENTION_DAYS", "AUDIT_SINK", "AUDIT_FILE", "AUDIT_BUCKET", "AUDIT_TABLE",
+				"ALLOWED_ACCOUNT_IDS", "ALLOWED_REGIONS", "INHERITED_TAG_KEYS", "CUSTOM_ENDPOINTS"} {
+				t.Setenv(k, tt.envVars[k])
+			}
+
+			opts, err := OptionsFromEnv(nil)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			handler := NewHandler(nil, &mockRDS{}, &mockSTS{}, opts...)
+			assert.Equal(t, tt.wantAttempts, handler.verifyAttempts)
+			assert.Equal(t, tt.wantDelay, handler.verifyDelay)
+			assert.Equal(t, tt.wantDryRun, handler.settingsDryRun)
+			assert.Equal(t, tt.wantTier, handler.promotionTier)
+			assert.Equal(t, tt.wantAudit, handler.auditSink)
+
+			if tt.wantAccounts != nil || tt.wantRegions != nil {
+				assert.Equal(t, tt.wantAccounts, handler.allowedAccounts)
+				assert.Equal(t, tt.wantRegions, handler.allowedRegions)
+			}
+
+			if tt.wantInherited != nil {
+				assert.Equal(t, tt.wantInherited, handler.inheritedTagKeys)
+			}
+
+			if tt.wantEndpoints != nil {
+				assert.Equal(t, tt.wantEndpoints, handler.customEndpoints)
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/sirupsen/logrus"
+)
+
+// Cursor is the position of the poller in the RDS event stream.
+type Cursor struct {
+	// Time is the date of the newest processed event.
+	Time time.Time `json:"time"`
+	// Seen holds the keys of processed events dated exactly Time, DescribeEvents returns them again.
+	Seen []string `json:"seen,omitempty"`
+}
+
+// seen reports whether the event with the given date and key was already processed.
+func (c Cursor) seen(date time.Time, key string) bool {
+	if date.Before(c.Time) {
+		return true
+	}
+
+	return date.Equal(c.Time) && containsString(c.Seen, key)
+}
+
+// advance moves the cursor past the processed event with the given date and key.
+func (c Cursor) advance(date time.Time, key string) Cursor {
+	if date.After(c.Time) {
+		return Cursor{Time: date, Seen: []string{key}}
+	}
+
+	return Cursor{Time: c.Time, Seen: append(append([]string(nil), c.Seen...), key)}
+}
+
+// CursorStore persists the poller cursor across restarts.
+type CursorStore interface {
+	// Load returns the saved cursor and false when none was saved yet.
+	Load() (Cursor, bool, error)
+	Save(Cursor) error
+}
+
+// MemoryCursorStore keeps the cursor in memory, it is lost on restart.
+type MemoryCursorStore struct {
+	mu     sync.Mutex
+	cursor *Cursor
+}
+
+// Load returns the cursor saved last.
+func (s *MemoryCursorStore) Load() (Cursor, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cursor == nil {
+		return Cursor{}, false, nil
+	}
+
+	return *s.cursor, true, nil
+}
+
+// Save keeps the cursor.
+func (s *MemoryCursorStore) Save(cursor Cursor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cursor = &cursor
+
+	return nil
+}
+
+// FileCursorStore keeps the cursor in a JSON file.
+type FileCursorStore struct {
+	path string
+}
+
+// NewFileCursorStore creates a FileCursorStore writing to path.
+func NewFileCursorStore(path string) *FileCursorStore {
+	return &FileCursorStore{path: path}
+}
+
+// Load reads the cursor from the file, a missing file means no cursor was saved yet.
+func (s *FileCursorStore) Load() (Cursor, bool, error) {
+	raw, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Cursor{}, false, nil
+	}
+
+	if err != nil {
+		return Cursor{}, false, fmt.Errorf("failed to read cursor: %w", err)
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return Cursor{}, false, fmt.Errorf("failed to decode cursor %s: %w", s.path, err)
+	}
+
+	return cursor, true, nil
+}
+
+// Save writes the cursor to a temporary file and renames it, so a crash never leaves a partial cursor.
+func (s *FileCursorStore) Save(cursor Cursor) error {
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save cursor: %w", err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save cursor: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save cursor: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save cursor: %w", err)
+	}
+
+	return nil
+}
+
+// DefaultPollMaxAttempts is how many polls try an event before the poller gives up on it.
+const DefaultPollMaxAttempts = 3
+
+// Poller feeds RDS instance creation events found with DescribeEvents to the handler, for accounts
+// where no EventBridge rule delivers them.
+type Poller struct {
+	logger      logrus.FieldLogger
+	handler     *Handler
+	cursor      CursorStore
+	interval    time.Duration
+	maxAttempts int
+	isLeader    func() bool
+	onLeading   func(context.Context)
+
+	// failures counts the failed attempts per event key, so a failing event does not block the ones after it forever.
+	failures map[string]int
+
+	mu       sync.Mutex
+	polled   bool
+	pollErr  error
+	lastPoll time.Time
+}
+
+// NewPoller creates a Poller polling every interval and keeping its position in cursor.
+func NewPoller(logger logrus.FieldLogger, handler *Handler, cursor CursorStore, interval time.Duration) *Poller {
+	return &Poller{
+		logger:      logger,
+		handler:     handler,
+		cursor:      cursor,
+		interval:    interval,
+		maxAttempts: DefaultPollMaxAttempts,
+		isLeader:    func() bool { return true },
+		failures:    make(map[string]int),
+	}
+}
+
+// NewPollerFromEnv creates a Poller configured by POLL_INTERVAL (default 1m), POLL_MAX_ATTEMPTS (default 3),
+// and CURSOR_FILE or LEASE_TABLE.
+// The cursor is kept in the LEASE_TABLE DynamoDB table shared by all replicas when it is set, in CURSOR_FILE
+// otherwise, and in memory when neither is set.
+func NewPollerFromEnv(logger logrus.FieldLogger, handler *Handler, sess client.ConfigProvider) (*Poller, error) {
+	interval := time.Minute
+
+	if raw := os.Getenv("POLL_INTERVAL"); raw != "" {
+		var err error
+
+		interval, err = time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("POLL_INTERVAL must be a positive duration, got %q", raw)
+		}
+	}
+
+	maxAttempts := DefaultPollMaxAttempts
+
+	if raw := os.Getenv("POLL_MAX_ATTEMPTS"); raw != "" {
+		var err error
+
+		maxAttempts, err = strconv.Atoi(raw)
+		if err != nil || maxAttempts < 1 {
+			return nil, fmt.Errorf("POLL_MAX_ATTEMPTS must be a positive integer, got %q", raw)
+		}
+	}
+
+	path, table := os.Getenv("CURSOR_FILE"), os.Getenv("LEASE_TABLE")
+
+	var cursor CursorStore = &MemoryCursorStore{}
+
+	switch {
+	case path != "" && table != "":
+		return nil, errors.New("CURSOR_FILE and LEASE_TABLE cannot both be set, the cursor is kept in LEASE_TABLE")
+	case table != "":
+		holder, err := leaseHolderFromEnv()
+		if err != nil {
+			return nil, err
+		}
+
+		cursor = NewDynamoDBCursorStore(dynamodb.New(sess), table, "cursor/"+os.Getenv("RDS_CLUSTER_IDENTIFIER")).
+			FencedBy(leaseIDFromEnv(), holder)
+	case path != "":
+		cursor = NewFileCursorStore(path)
+	}
+
+	poller := NewPoller(logger, handler, cursor, interval)
+	poller.maxAttempts = maxAttempts
+
+	return poller, nil
+}
+
+// OnlyWhenLeader makes the poller skip polls while isLeader reports false, for deployments
+// running several replicas.
+func (p *Poller) OnlyWhenLeader(isLeader func() bool) {
+	p.isLeader = isLeader
+}
+
+// OnLeading runs fn before the first poll of every term as leader, without leader election before the first
+// poll only. It is meant for work only the leader does, such as the catch-up.
+func (p *Poller) OnLeading(fn func(context.Context)) {
+	p.onLeading = fn
+}
+
+// Run polls until ctx is cancelled. An event being processed is finished before Run returns.
+func (p *Poller) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.logger.Printf("Polling RDS events every %s", p.interval)
+
+	following, leading := false, false
+
+	for {
+		switch {
+		case !p.isLeader():
+			if !following {
+				p.logger.Printf("Not the leader, polling paused")
+			}
+
+			following, leading = true, false
+		default:
+			if following {
+				p.logger.Printf("Became the leader, polling resumed")
+			}
+
+			if !leading && p.onLeading != nil {
+				p.onLeading(ctx)
+			}
+
+			following, leading = false, true
+
+			if _, err := p.Poll(ctx); err != nil {
+				p.logger.Printf("Error polling RDS events: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			p.logger.Printf("Stopped polling RDS events")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll processes the creation events since the cursor once and returns the results. The cursor only
+// moves past events that were processed, a failed event is retried on the next polls until it failed
+// maxAttempts times, then it is given up on and recorded as failed.
+func (p *Poller) Poll(ctx context.Context) ([]*Result, error) {
+	results, err := p.poll(ctx)
+
+	p.mu.Lock()
+	p.polled, p.pollErr, p.lastPoll = true, err, p.handler.now()
+	p.mu.Unlock()
+
+	return results, err
+}
+
+// Ready returns nil once the last poll succeeded, and the reason otherwise. Followers are always ready.
+func (p *Poller) Ready() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case !p.isLeader():
+		return nil
+	case !p.polled:
+		return errors.New("no poll has completed yet")
+	case p.pollErr != nil:
+		return fmt.Errorf("last poll at %s failed: %w", p.lastPoll.Format(time.RFC3339), p.pollErr)
+	default:
+		return nil
+	}
+}
+
+// poll runs a single pass over the events since the cursor.
+func (p *Poller) poll(ctx context.Context) ([]*Result, error) {
+	cursor, ok, err := p.cursor.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	// A new cursor starts now, past events are left to the catch-up.
+	if !ok {
+		cursor = Cursor{Time: p.handler.now()}
+		if err := p.cursor.Save(cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	list, err := p.handler.describeInstanceEvents(cursor.Time, rdsEventCategoryCreation, rdsEventCategoryDeletion)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*Result
+
+	for _, e := range list {
+		// A replica that lost the lease leaves the remaining events to the new leader.
+		if ctx.Err() != nil || !p.isLeader() {
+			break
+		}
+
+		date, key := aws.TimeValue(e.Date), rdsEventKey(e)
+		if cursor.seen(date, key) {
+			continue
+		}
+
+		if event, ok := cloudWatchEventFromRDS(e); ok {
+			handle := p.handler.HandleRequest
+			if rdsEventIDs[aws.StringValue(e.Message)] == rdsEventInstanceDeleted {
+				handle = p.handler.HandleInstanceDeleted
+			}
+
+			result, err := handle(ctx, event)
+			if err != nil && !errors.Is(err, ErrEventRejected) {
+				p.failures[key]++
+				if p.failures[key] < p.maxAttempts {
+					return results, err
+				}
+
+				p.handler.recorder.Inc(MetricPolledEventAbandoned)
+				p.logger.Printf("Giving up on event %s after %d attempts: %v", key, p.failures[key], err)
+			}
+
+			delete(p.failures, key)
+
+			results = append(results, result)
+		}
+
+		cursor = cursor.advance(date, key)
+		if err := p.cursor.Save(cursor); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
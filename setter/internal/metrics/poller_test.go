@@ -0,0 +1,331 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// creationEvent returns a DescribeEvents creation event of the instance at date.
+func creationEvent(instanceID string, date time.Time) *rds.Event {
+	return &rds.Event{
+		Date:             aws.Time(date),
+		EventCategories:  aws.StringSlice([]string{"creation"}),
+		Message:          aws.String("DB instance created"),
+		SourceArn:        aws.String("arn:aws:rds:us-east-1:123456789012:db:" + instanceID),
+		SourceIdentifier: aws.String(instanceID),
+		SourceType:       aws.String("db-instance"),
+	}
+}
+
+// TestPoller_Poll checks that every creation event is tagged once across polls.
+// The crew keeps getting unfrozen, and each one must get a Planet Express badge exactly once.
+func TestPoller_Poll(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	start := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var (
+		stream    []*rds.Event
+		tagged    []string
+		failNext  bool
+		startTime time.Time
+	)
+
+	mock := &mockRDS{
+		describeEventsFunc: func(input *rds.DescribeEventsInput) (*rds.DescribeEventsOutput, error) {
+			startTime = aws.TimeValue(input.StartTime)
+			assert.Equal(t, "db-instance", aws.StringValue(input.SourceType))
+			assert.Equal(t, []string{"creation", "deletion"}, aws.StringValueSlice(input.EventCategories))
+
+			var list []*rds.Event
+
+			for _, e := range stream {
+				if !aws.TimeValue(e.Date).Before(startTime) {
+					list = append(list, e)
+				}
+			}
+
+			return &rds.DescribeEventsOutput{Events: list}, nil
+		},
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			return &rds.DescribeDBInstancesOutput{
+				DBInstances: []*rds.DBInstance{
+					{
+						DBClusterIdentifier: aws.String("planet-express"),
+						DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:" + aws.StringValue(input.DBInstanceIdentifier)),
+					},
+				},
+			}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			if failNext {
+				failNext = false
+				return nil, errors.New("slurm machine jammed")
+			}
+
+			tagged = append(tagged, aws.StringValue(input.ResourceName))
+
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+	}
+
+	handler := NewHandler(logrus.New(), mock, &mockSTS{})
+	handler.now = func() time.Time { return start }
+
+	cursor := &MemoryCursorStore{}
+	poller := NewPoller(logrus.New(), handler, cursor, time.Minute)
+
+	assert.Error(t, poller.Ready(), "not ready before the first poll")
+
+	// The first poll starts the cursor now.
+	results, err := poller.Poll(context.Background())
+	require.NoError(t, err)
+	assert.NoError(t, poller.Ready())
+	assert.Empty(t, results)
+	assert.Equal(t, start, startTime)
+
+	// Fry and Leela are created at the same second as an unrelated event.
+	stream = []*rds.Event{
+		creationEvent("application-autoscaling-leela", start.Add(time.Minute)),
+		creationEvent("application-autoscaling-fry", start.Add(time.Minute)),
+		{Date: aws.Time(start.Add(time.Minute)), Message: aws.String("Backing up DB instance")},
+	}
+
+	tagged = nil
+	failNext = false
+
+	_, err = poller.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, tagged, 2)
+
+	// The same events come back because they are dated at the cursor, nothing is tagged twice.
+	tagged = nil
+
+	_, err = poller.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, tagged)
+	assert.Equal(t, start.Add(time.Minute), startTime)
+
+	// A failing event stops the poll and is retried next time.
+	stream = append(stream, creationEvent("application-autoscaling-bender", start.Add(2*time.Minute)))
+	failNext = true
+
+	_, err = poller.Poll(context.Background())
+	require.Error(t, err)
+	assert.Empty(t, tagged)
+	assert.Error(t, poller.Ready())
+
+	results, err = poller.Poll(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, OutcomeTagged, results[0].Outcome)
+	assert.Equal(t, []string{"arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-bender"}, tagged)
+
+	// Deletions are polled along with creations and go to the deletion handler.
+	gone := creationEvent("application-autoscaling-leela", start.Add(3*time.Minute))
+	gone.EventCategories = aws.StringSlice([]string{"deletion"})
+	gone.Message = aws.String("DB instance deleted")
+	stream = append(stream, gone)
+	tagged = nil
+
+	results, err = poller.Poll(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, OutcomeRemoved, results[0].Outcome)
+	assert.Empty(t, tagged)
+}
+
+// TestPoller_OnlyWhenLeader checks that followers neither poll, run the startup work nor report unreadiness,
+// and that a leader losing the lease leaves the remaining events to the next one.
+// When Hermes is demoted, he stops stamping forms mid-pile.
+func TestPoller_OnlyWhenLeader(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	start := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+	leader := false
+
+	var tagged []string
+
+	mock := &mockRDS{
+		describeEventsFunc: func(input *rds.DescribeEventsInput) (*rds.DescribeEventsOutput, error) {
+			return &rds.DescribeEventsOutput{Events: []*rds.Event{
+				creationEvent("application-autoscaling-fry", start.Add(time.Minute)),
+				creationEvent("application-autoscaling-leela", start.Add(2*time.Minute)),
+			}}, nil
+		},
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			return &rds.DescribeDBInstancesOutput{
+				DBInstances: []*rds.DBInstance{
+					{
+						DBClusterIdentifier: aws.String("planet-express"),
+						DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:" + aws.StringValue(input.DBInstanceIdentifier)),
+					},
+				},
+			}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			tagged = append(tagged, aws.StringValue(input.ResourceName))
+
+			// The lease is lost while the first replica is tagged.
+			leader = false
+
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+	}
+
+	handler := NewHandler(logrus.New(), mock, &mockSTS{})
+	handler.now = func() time.Time { return start }
+
+	cursor := &MemoryCursorStore{}
+	require.NoError(t, cursor.Save(Cursor{Time: start}))
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	started := 0
+
+	poller := NewPoller(logger, handler, cursor, time.Minute)
+	poller.OnlyWhenLeader(func() bool { return leader })
+	poller.OnLeading(func(context.Context) { started++ })
+
+	assert.NoError(t, poller.Ready(), "followers are ready without polling")
+
+	// A follower stops at once without polling.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, poller.Run(ctx))
+	assert.Empty(t, tagged)
+	assert.Zero(t, started, "followers do not catch up")
+
+	leader = true
+
+	results, err := poller.Poll(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, []string{"arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"}, tagged)
+
+	saved, _, err := cursor.Load()
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(time.Minute), saved.Time, "the next leader continues after the last tagged event")
+
+	// The startup work runs once the lease is held, before the first poll.
+	leader = true
+
+	require.NoError(t, poller.Run(ctx))
+	assert.Equal(t, 1, started)
+}
+
+// TestPoller_PollFailures checks that an event failing on every poll does not block the events after it.
+// Zoidberg's badge never prints, so after a few tries the Professor hands out the others anyway.
+func TestPoller_PollFailures(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	start := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var tagged []string
+
+	mock := &mockRDS{
+		describeEventsFunc: func(input *rds.DescribeEventsInput) (*rds.DescribeEventsOutput, error) {
+			return &rds.DescribeEventsOutput{Events: []*rds.Event{
+				creationEvent("application-autoscaling-kif", start.Add(time.Minute)),
+				creationEvent("application-autoscaling-zoidberg", start.Add(2*time.Minute)),
+				creationEvent("application-autoscaling-fry", start.Add(3*time.Minute)),
+			}}, nil
+		},
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			id := aws.StringValue(input.DBInstanceIdentifier)
+			if id == "application-autoscaling-kif" {
+				return nil, awserr.New(rds.ErrCodeDBInstanceNotFoundFault, "DBInstance not found", nil)
+			}
+
+			return &rds.DescribeDBInstancesOutput{
+				DBInstances: []*rds.DBInstance{
+					{
+						DBClusterIdentifier: aws.String("planet-express"),
+						DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:" + id),
+					},
+				},
+			}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			if strings.HasSuffix(aws.StringValue(input.ResourceName), "zoidberg") {
+				return nil, errors.New("badge printer out of ink")
+			}
+
+			tagged = append(tagged, aws.StringValue(input.ResourceName))
+
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+	}
+
+	recorder := &countingRecorder{}
+	handler := NewHandler(logrus.New(), mock, &mockSTS{}, WithRecorder(recorder))
+	handler.now = func() time.Time { return start }
+
+	cursor := &MemoryCursorStore{}
+	require.NoError(t, cursor.Save(Cursor{Time: start}))
+
+	poller := NewPoller(logrus.New(), handler, cursor, time.Minute)
+
+	// Kif was deleted before the poll, his event is skipped and Zoidberg's fails.
+	results, err := poller.Poll(context.Background())
+	require.Error(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, OutcomeSkipped, results[0].Outcome)
+
+	for attempt := 2; attempt < DefaultPollMaxAttempts; attempt++ {
+		results, err = poller.Poll(context.Background())
+		require.Error(t, err)
+		assert.Empty(t, results)
+	}
+
+	assert.Empty(t, tagged)
+
+	// The last attempt gives up on Zoidberg and moves on to Fry.
+	results, err = poller.Poll(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, OutcomeFailed, results[0].Outcome)
+	assert.Equal(t, OutcomeTagged, results[1].Outcome)
+	assert.Equal(t, []string{"arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"}, tagged)
+	assert.Equal(t, 1, recorder.counts[MetricPolledEventAbandoned])
+
+	saved, _, err := cursor.Load()
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(3*time.Minute), saved.Time)
+}
+
+// TestFileCursorStore checks that a saved cursor survives a restart.
+func TestFileCursorStore(t *testing.T) {
+	store := NewFileCursorStore(filepath.Join(t.TempDir(), "cursor.json"))
+
+	_, ok, err := store.Load()
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	want := Cursor{Time: time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC), Seen: []string{"rds-event/fry"}}
+	require.NoError(t, store.Save(want))
+
+	got, ok, err := NewFileCursorStore(store.path).Load()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// defaultPromotionTier is the lowest failover priority, replicas in it are promoted last.
+const defaultPromotionTier = 15
+
+// enforcePromotionTier checks the promotion tier of a replica found by a sweep and reports whether it is out of
+// policy. Replicas out of policy are modified when they are available, others are left to a later sweep.
+func (h *Handler) enforcePromotionTier(instance *rds.DBInstance, result *Result) (bool, error) {
+	if h.promotionTier == nil {
+		return false, nil
+	}
+
+	dbInstanceID := aws.StringValue(instance.DBInstanceIdentifier)
+	want := *h.promotionTier
+
+	current := aws.Int64Value(instance.PromotionTier)
+	if current == want {
+		return false, nil
+	}
+
+	result.SettingsChanged = map[string]string{"PromotionTier": fmt.Sprintf("%d -> %d", current, want)}
+	h.recorder.Inc(MetricPromotionTierOutOfPolicy)
+	h.logger.Printf("DB instance %s has promotion tier %d, expected %d", dbInstanceID, current, want)
+
+	if h.settingsDryRun {
+		result.SettingsDryRun = true
+		return true, nil
+	}
+
+	if status := aws.StringValue(instance.DBInstanceStatus); status != rdsInstanceStatusAvailable {
+		h.logger.Printf("DB instance %s is %s, leaving its promotion tier to a later sweep", dbInstanceID, status)
+		return true, nil
+	}
+
+	_, err := h.rds.ModifyDBInstance(&rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: aws.String(dbInstanceID),
+		ApplyImmediately:     aws.Bool(true),
+		PromotionTier:        aws.Int64(want),
+	})
+	if err != nil {
+		h.logger.Printf("Error modifying promotion tier of DB instance %s: %v", dbInstanceID, err)
+		return true, fmt.Errorf("failed to modify promotion tier of DB instance %s: %w", dbInstanceID, err)
+	}
+
+	h.recorder.Inc(MetricInstanceSettingsModified)
+	h.logger.Printf("Modified promotion tier of DB instance %s to %d", dbInstanceID, want)
+
+	return true, nil
+}
@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandler_EnforcePromotionTier covers sweeps keeping autoscaled replicas at the lowest failover priority.
+// Fry may join the crew, but he is never promoted to captain ahead of Leela.
+func TestHandler_EnforcePromotionTier(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	replica := func(id, status string, tier int64) *rds.DBInstance {
+		return &rds.DBInstance{
+			DBInstanceIdentifier: aws.String(id),
+			DBInstanceArn:        aws.String("arn:aws:rds:us-east-1:123456789012:db:" + id),
+			DBClusterIdentifier:  aws.String("planet-express"),
+			DBInstanceStatus:     aws.String(status),
+			PromotionTier:        aws.Int64(tier),
+			TagList:              rdsTags(map[string]string{"Owner": "professor-farnsworth"}),
+		}
+	}
+
+	instances := []*rds.DBInstance{
+		// The provisioned reader keeps its tier.
+		replica("planet-express-leela", "available", 0),
+		replica("application-autoscaling-fry", "available", 1),
+		replica("application-autoscaling-bender", "available", 15),
+		replica("application-autoscaling-nibbler", "modifying", 1),
+	}
+
+	tests := []struct {
+		name            string
+		dryRun          bool
+		tagErr          error
+		modifyErr       error
+		wantModified    []string
+		wantOutOfPolicy []string
+		wantUnchanged   int
+		wantFailed      int
+	}{
+		{
+			name:            "available replicas out of policy are modified",
+			wantModified:    []string{"application-autoscaling-fry"},
+			wantOutOfPolicy: []string{"application-autoscaling-fry", "application-autoscaling-nibbler"},
+			wantUnchanged:   3,
+		},
+		{
+			name:            "dry run only reports replicas out of policy",
+			dryRun:          true,
+			wantOutOfPolicy: []string{"application-autoscaling-fry", "application-autoscaling-nibbler"},
+			wantUnchanged:   3,
+		},
+		{
+			name:            "failed modification fails the replica",
+			modifyErr:       errors.New("Leela says no"),
+			wantModified:    []string{"application-autoscaling-fry"},
+			wantOutOfPolicy: []string{"application-autoscaling-fry", "application-autoscaling-nibbler"},
+			wantUnchanged:   2,
+			wantFailed:      1,
+		},
+		{
+			name:            "failed tagging still enforces the tier",
+			tagErr:          errors.New("Hermes lost the label maker"),
+			wantModified:    []string{"application-autoscaling-fry"},
+			wantOutOfPolicy: []string{"application-autoscaling-fry", "application-autoscaling-nibbler"},
+			wantUnchanged:   2,
+			wantFailed:      1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardLogs(t)
+
+			var modified []string
+
+			mock := &mockRDS{
+				describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+					if tt.tagErr == nil {
+						return &rds.DescribeDBInstancesOutput{DBInstances: instances}, nil
+					}
+
+					// Fry lost his tags, so the sweep has to write them again.
+					fry := *instances[1]
+					fry.TagList = nil
+
+					return &rds.DescribeDBInstancesOutput{
+						DBInstances: []*rds.DBInstance{instances[0], &fry, instances[2], instances[3]},
+					}, nil
+				},
+				addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+					return nil, tt.tagErr
+				},
+				modifyDBInstanceFunc: func(input *rds.ModifyDBInstanceInput) (*rds.ModifyDBInstanceOutput, error) {
+					assert.Equal(t, int64(15), aws.Int64Value(input.PromotionTier))
+					assert.True(t, aws.BoolValue(input.ApplyImmediately))
+					modified = append(modified, aws.StringValue(input.DBInstanceIdentifier))
+
+					return &rds.ModifyDBInstanceOutput{}, tt.modifyErr
+				},
+			}
+
+			recorder := &countingRecorder{}
+			handler := NewHandler(logrus.New(), mock, &mockSTS{}, WithRecorder(recorder), WithPromotionTier(15, tt.dryRun))
+
+			sweep, err := handler.Sweep(context.Background(), "")
+			if tt.wantFailed > 0 {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantModified, modified)
+			assert.Equal(t, tt.wantOutOfPolicy, sweep.OutOfPolicy)
+			assert.Equal(t, tt.wantUnchanged, sweep.Unchanged)
+			assert.Equal(t, tt.wantFailed, sweep.Failed)
+			assert.Equal(t, 2, recorder.counts[MetricPromotionTierOutOfPolicy])
+
+			require.Len(t, sweep.Results, 3)
+			assert.Equal(t, map[string]string{"PromotionTier": "1 -> 15"}, sweep.Results[0].SettingsChanged)
+			assert.Equal(t, tt.dryRun, sweep.Results[0].SettingsDryRun)
+			assert.Nil(t, sweep.Results[1].SettingsChanged)
+		})
+	}
+}
+
+// TestHandler_PromotionTierOnCreation checks that new replicas are moved to the enforced tier without other settings.
+func TestHandler_PromotionTierOnCreation(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	var modified *rds.ModifyDBInstanceInput
+
+	mock := &mockRDS{
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			return &rds.DescribeDBInstancesOutput{DBInstances: []*rds.DBInstance{{
+				DBClusterIdentifier:  aws.String("planet-express"),
+				DBInstanceArn:        aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+				DBInstanceIdentifier: aws.String("application-autoscaling-fry"),
+				DBInstanceStatus:     aws.String("available"),
+				MonitoringInterval:   aws.Int64(60),
+				PromotionTier:        aws.Int64(1),
+			}}}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+		modifyDBInstanceFunc: func(input *rds.ModifyDBInstanceInput) (*rds.ModifyDBInstanceOutput, error) {
+			modified = input
+			return &rds.ModifyDBInstanceOutput{}, nil
+		},
+	}
+
+	handler := NewHandler(logrus.New(), mock, &mockSTS{}, WithPromotionTier(15, false))
+
+	result, err := handler.HandleRequest(context.Background(), instanceEvent("RDS-EVENT-0005", "application-autoscaling-fry"))
+	require.NoError(t, err)
+
+	assert.Equal(t, OutcomeTagged, result.Outcome)
+	assert.Equal(t, map[string]string{"PromotionTier": "1 -> 15"}, result.SettingsChanged)
+	assert.Equal(t, &rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: aws.String("application-autoscaling-fry"),
+		ApplyImmediately:     aws.Bool(true),
+		PromotionTier:        aws.Int64(15),
+	}, modified)
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// inheritedKeys returns the inherited keys touched by the call, sorted.
+// Keys managed through TAGS are left out, the configured value always wins on replicas.
+func (h *Handler) inheritedKeys(call tagChangeCall, managed map[string]string) []string {
+	var keys []string
+
+	for _, key := range call.keys() {
+		if _, ok := managed[key]; h.inheritedTagKeys[key] && !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// propagateClusterTags pushes a change of inherited cluster tags to every autoscaled replica of the cluster.
+// Per replica results are recorded in result.Replicas.
+func (h *Handler) propagateClusterTags(detail CloudTrailDetail, call tagChangeCall, clusterID, expectedClusterID string,
+	managed map[string]string, result *Result) error {
+	caller := describeCaller(detail.UserIdentity)
+	result.ClusterIdentifier = clusterID
+
+	keys := h.inheritedKeys(call, managed)
+
+	switch {
+	case clusterID != expectedClusterID:
+		result.Reason = fmt.Sprintf("not cluster %s", expectedClusterID)
+	case len(h.inheritedTagKeys) == 0:
+		result.Reason = "no inherited tag keys configured"
+	case len(keys) == 0:
+		result.Outcome = OutcomeUnchanged
+		result.Reason = "no inherited tag changed"
+	}
+
+	if result.Reason != "" {
+		h.logger.Printf("Skipping %s on cluster %s by %s: %s", detail.EventName, clusterID, caller, result.Reason)
+		return nil
+	}
+
+	h.logger.Printf("Inherited tags %s on cluster %s changed by %s", strings.Join(keys, ", "), clusterID, caller)
+
+	// Later calls may have changed the tags again, so propagate the current cluster tags rather than the call.
+	clusterTags, err := h.listTags(call.ResourceName)
+	if err != nil {
+		return err
+	}
+
+	set := make(map[string]string)
+
+	var removed []string
+
+	for _, key := range keys {
+		if value, ok := clusterTags[key]; ok {
+			set[key] = value
+		} else {
+			removed = append(removed, key)
+		}
+	}
+
+	instances, err := h.listClusterInstances(clusterID)
+	if err != nil {
+		return err
+	}
+
+	var (
+		errs       []error
+		propagated int
+	)
+
+	result.Outcome = OutcomeUnchanged
+
+	for _, instance := range instances {
+		dbInstanceID := aws.StringValue(instance.DBInstanceIdentifier)
+		if !isAutoscaledReplica(dbInstanceID) {
+			continue
+		}
+
+		replica := &Result{
+			DBInstanceIdentifier: dbInstanceID,
+			DBInstanceArn:        aws.StringValue(instance.DBInstanceArn),
+			ClusterIdentifier:    clusterID,
+			Outcome:              OutcomeUnchanged,
+		}
+		result.Replicas = append(result.Replicas, replica)
+
+		if err := h.propagateToReplica(replica, tagListToMap(instance.TagList), set, removed); err != nil {
+			replica.Outcome = OutcomeFailed
+			replica.Error = err.Error()
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if replica.Outcome == OutcomePropagated {
+			propagated++
+		}
+	}
+
+	if propagated > 0 {
+		result.Outcome = OutcomePropagated
+	}
+
+	result.Reason = fmt.Sprintf("%s changed by %s, propagated to %d of %d replicas",
+		strings.Join(keys, ", "), caller, propagated, len(result.Replicas))
+	h.logger.Printf("Propagated tags of cluster %s: %s", clusterID, result.Reason)
+
+	return errors.Join(errs...)
+}
+
+// propagateToReplica writes the inherited tags in set and removes the removed keys on a single replica.
+func (h *Handler) propagateToReplica(result *Result, current, set map[string]string, removed []string) error {
+	writes := changedTags(set, current)
+
+	var removals []string
+
+	for _, key := range removed {
+		if _, ok := current[key]; ok {
+			removals = append(removals, key)
+		}
+	}
+
+	if len(writes) == 0 && len(removals) == 0 {
+		return nil
+	}
+
+	if len(writes) > 0 {
+		if err := h.applyTags(result.DBInstanceIdentifier, result.DBInstanceArn, writes, result); err != nil {
+			return err
+		}
+	}
+
+	if len(removals) > 0 {
+		if result.TagsBefore == nil {
+			result.TagsBefore = current
+		}
+
+		if err := h.removeTags(result.DBInstanceIdentifier, result.DBInstanceArn, removals); err != nil {
+			return err
+		}
+
+		// Any tags read back after the write above still held the removed keys.
+		h.observeTagsAfter(result.DBInstanceIdentifier, result.DBInstanceArn, result)
+	}
+
+	result.Outcome = OutcomePropagated
+
+	return nil
+}
+
+// removeTags removes the tag keys from an RDS instance.
+func (h *Handler) removeTags(dbInstanceID, arn string, keys []string) error {
+	_, err := h.rds.RemoveTagsFromResource(&rds.RemoveTagsFromResourceInput{
+		ResourceName: aws.String(arn),
+		TagKeys:      aws.StringSlice(keys),
+	})
+	if err != nil {
+		h.logger.Printf("Error removing tags from DB instance %s: %v", dbInstanceID, err)
+		return err
+	}
+
+	h.logger.Printf("Removed tags %s from DB instance %s", strings.Join(keys, ", "), dbInstanceID)
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandler_PropagateClusterTags covers pushing inherited cluster tag changes to existing replicas.
+// Mom moves the Planet Express cluster to a new cost center and every crew member has to follow.
+func TestHandler_PropagateClusterTags(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	const (
+		mom        = `{"type": "IAMUser", "arn": "arn:aws:iam::123456789012:user/mom"}`
+		clusterArn = "arn:aws:rds:us-east-1:123456789012:cluster:planet-express"
+	)
+
+	tests := []struct {
+		name         string
+		eventName    string
+		parameters   string
+		inherited    []string
+		clusterTags  map[string]string
+		wantOutcome  Outcome
+		wantApplied  map[string]map[string]string
+		wantRemoved  map[string][]string
+		wantReplicas int
+	}{
+		{
+			name:        "changed value is overwritten on all replicas",
+			eventName:   "AddTagsToResource",
+			parameters:  `{"resourceName": "` + clusterArn + `", "tags": [{"key": "CostCenter", "value": "momcorp"}]}`,
+			inherited:   []string{"CostCenter"},
+			clusterTags: map[string]string{"CostCenter": "momcorp"},
+			wantOutcome: OutcomePropagated,
+			wantApplied: map[string]map[string]string{
+				"application-autoscaling-fry":   {"CostCenter": "momcorp"},
+				"application-autoscaling-leela": {"CostCenter": "momcorp"},
+			},
+			wantReplicas: 2,
+		},
+		{
+			name:        "removed key is removed from replicas",
+			eventName:   "RemoveTagsFromResource",
+			parameters:  `{"resourceName": "` + clusterArn + `", "tagKeys": ["CostCenter"]}`,
+			inherited:   []string{"CostCenter"},
+			wantOutcome: OutcomePropagated,
+			wantRemoved: map[string][]string{
+				"application-autoscaling-fry": {"CostCenter"},
+			},
+			wantReplicas: 2,
+		},
+		{
+			name:        "key not inherited",
+			eventName:   "AddTagsToResource",
+			parameters:  `{"resourceName": "` + clusterArn + `", "tags": [{"key": "Slogan", "value": "our-crew-is-replaceable"}]}`,
+			inherited:   []string{"CostCenter"},
+			wantOutcome: OutcomeUnchanged,
+		},
+		{
+			name:        "managed key is not inherited",
+			eventName:   "AddTagsToResource",
+			parameters:  `{"resourceName": "` + clusterArn + `", "tags": [{"key": "Owner", "value": "mom"}]}`,
+			inherited:   []string{"Owner"},
+			wantOutcome: OutcomeUnchanged,
+		},
+		{
+			name:        "no inherited keys configured",
+			eventName:   "AddTagsToResource",
+			parameters:  `{"resourceName": "` + clusterArn + `", "tags": [{"key": "CostCenter", "value": "momcorp"}]}`,
+			wantOutcome: OutcomeSkipped,
+		},
+		{
+			name:        "another cluster",
+			eventName:   "AddTagsToResource",
+			parameters:  `{"resourceName": "arn:aws:rds:us-east-1:123456789012:cluster:momcorp", "tags": [{"key": "CostCenter", "value": "momcorp"}]}`,
+			inherited:   []string{"CostCenter"},
+			wantOutcome: OutcomeSkipped,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardLogs(t)
+
+			applied := make(map[string]map[string]string)
+			removed := make(map[string][]string)
+
+			mock := &mockRDS{
+				listTagsForResourceFunc: func(input *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+					require.Equal(t, clusterArn, aws.StringValue(input.ResourceName))
+					return &rds.ListTagsForResourceOutput{TagList: rdsTags(tt.clusterTags)}, nil
+				},
+				describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+					return &rds.DescribeDBInstancesOutput{
+						DBInstances: []*rds.DBInstance{
+							{
+								DBInstanceIdentifier: aws.String("application-autoscaling-fry"),
+								DBInstanceArn:        aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+								TagList:              rdsTags(map[string]string{"CostCenter": "delivery"}),
+							},
+							{
+								DBInstanceIdentifier: aws.String("application-autoscaling-leela"),
+								DBInstanceArn:        aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-leela"),
+							},
+							{
+								DBInstanceIdentifier: aws.String("planet-express-writer"),
+								DBInstanceArn:        aws.String("arn:aws:rds:us-east-1:123456789012:db:planet-express-writer"),
+							},
+						},
+					}, nil
+				},
+				addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+					applied[instanceFromArn(aws.StringValue(input.ResourceName))] = tagListToMap(input.Tags)
+					return &rds.AddTagsToResourceOutput{}, nil
+				},
+				removeTagsFromResourceFunc: func(input *rds.RemoveTagsFromResourceInput) (*rds.RemoveTagsFromResourceOutput, error) {
+					removed[instanceFromArn(aws.StringValue(input.ResourceName))] = aws.StringValueSlice(input.TagKeys)
+					return &rds.RemoveTagsFromResourceOutput{}, nil
+				},
+			}
+
+			handler := NewHandler(logrus.New(), mock, &mockSTS{}, WithInheritedTagKeys(tt.inherited...))
+
+			result, err := handler.HandleTagChangeCall(context.Background(), tagChangeEvent(tt.eventName, mom, tt.parameters))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantOutcome, result.Outcome)
+			assert.Len(t, result.Replicas, tt.wantReplicas)
+
+			if tt.wantApplied == nil {
+				tt.wantApplied = map[string]map[string]string{}
+			}
+
+			if tt.wantRemoved == nil {
+				tt.wantRemoved = map[string][]string{}
+			}
+
+			assert.Equal(t, tt.wantApplied, applied)
+			assert.Equal(t, tt.wantRemoved, removed)
+		})
+	}
+}
+
+// instanceFromArn returns the DB instance identifier of an instance ARN.
+func instanceFromArn(arn string) string {
+	return arn[len("arn:aws:rds:us-east-1:123456789012:db:"):]
+}
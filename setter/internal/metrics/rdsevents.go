@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// DescribeEvents categories of instance creation and deletion events.
+const (
+	rdsEventCategoryCreation = "creation"
+	rdsEventCategoryDeletion = "deletion"
+)
+
+// rdsEventIDs maps the messages of events returned by DescribeEvents, which carry no event ID,
+// to the ID EventBridge reports for them.
+var rdsEventIDs = map[string]string{
+	"DB instance created": rdsEventInstanceCreated,
+	"DB instance deleted": rdsEventInstanceDeleted,
+}
+
+// describeInstanceEvents lists the DB instance events in the given categories since start, oldest first.
+func (h *Handler) describeInstanceEvents(start time.Time, categories ...string) ([]*rds.Event, error) {
+	input := &rds.DescribeEventsInput{
+		SourceType:      aws.String(rds.SourceTypeDbInstance),
+		StartTime:       aws.Time(start),
+		EventCategories: aws.StringSlice(categories),
+	}
+
+	var list []*rds.Event
+
+	for {
+		output, err := h.rds.DescribeEvents(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe RDS events since %s: %w", start.Format(time.RFC3339), err)
+		}
+
+		list = append(list, output.Events...)
+
+		if aws.StringValue(output.Marker) == "" {
+			break
+		}
+
+		input.Marker = output.Marker
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return aws.TimeValue(list[i].Date).Before(aws.TimeValue(list[j].Date))
+	})
+
+	return list, nil
+}
+
+// rdsEventKey identifies an event returned by DescribeEvents, it is also used as the event ID.
+func rdsEventKey(e *rds.Event) string {
+	return fmt.Sprintf("rds-event/%s/%s/%s", aws.StringValue(e.SourceIdentifier),
+		aws.TimeValue(e.Date).UTC().Format(time.RFC3339Nano), aws.StringValue(e.Message))
+}
+
+// cloudWatchEventFromRDS converts an event returned by DescribeEvents into the EventBridge shape, so that
+// validation and tagging are shared with the EventBridge path. The account and region are those of the
+// source ARN. It reports false for events without a known event ID.
+func cloudWatchEventFromRDS(e *rds.Event) (events.CloudWatchEvent, bool) {
+	eventID, ok := rdsEventIDs[aws.StringValue(e.Message)]
+	if !ok {
+		return events.CloudWatchEvent{}, false
+	}
+
+	sourceArn := aws.StringValue(e.SourceArn)
+
+	var accountID, region string
+
+	if parsed, err := arn.Parse(sourceArn); err == nil {
+		accountID, region = parsed.AccountID, parsed.Region
+	}
+
+	detail, err := json.Marshal(EventDetail{
+		EventCategories:  aws.StringValueSlice(e.EventCategories),
+		SourceType:       rdsSourceTypeInstance,
+		SourceArn:        sourceArn,
+		Date:             aws.TimeValue(e.Date),
+		Message:          aws.StringValue(e.Message),
+		SourceIdentifier: aws.StringValue(e.SourceIdentifier),
+		EventID:          eventID,
+	})
+	if err != nil {
+		return events.CloudWatchEvent{}, false
+	}
+
+	return events.CloudWatchEvent{
+		ID:         rdsEventKey(e),
+		Source:     rdsEventSource,
+		DetailType: rdsInstanceEventDetailType,
+		AccountID:  accountID,
+		Region:     region,
+		Time:       aws.TimeValue(e.Date),
+		Resources:  []string{sourceArn},
+		Detail:     detail,
+	}, true
+}
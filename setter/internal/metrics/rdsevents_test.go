@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCloudWatchEventFromRDS checks the conversion of DescribeEvents results into the EventBridge shape.
+func TestCloudWatchEventFromRDS(t *testing.T) {
+	date := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	event, ok := cloudWatchEventFromRDS(&rds.Event{
+		Date:             aws.Time(date),
+		EventCategories:  aws.StringSlice([]string{"creation"}),
+		Message:          aws.String("DB instance created"),
+		SourceArn:        aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+		SourceIdentifier: aws.String("application-autoscaling-fry"),
+		SourceType:       aws.String("db-instance"),
+	})
+	require.True(t, ok)
+
+	assert.Equal(t, "aws.rds", event.Source)
+	assert.Equal(t, "RDS DB Instance Event", event.DetailType)
+	assert.Equal(t, "123456789012", event.AccountID)
+	assert.Equal(t, "us-east-1", event.Region)
+	assert.Equal(t, date, event.Time)
+
+	var detail EventDetail
+	require.NoError(t, json.Unmarshal(event.Detail, &detail))
+	assert.Equal(t, "RDS-EVENT-0005", detail.EventID)
+	assert.Equal(t, "DB_INSTANCE", detail.SourceType)
+	assert.Equal(t, "application-autoscaling-fry", detail.SourceIdentifier)
+
+	_, ok = cloudWatchEventFromRDS(&rds.Event{Message: aws.String("Recovery of the DB instance is complete.")})
+	assert.False(t, ok, "events without a known ID are not converted")
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEMFRecorder_Inc verifies the Embedded Metric Format document layout.
+func TestEMFRecorder_Inc(t *testing.T) {
+	var buf bytes.Buffer
+
+	recorder := NewEMFRecorder(&buf, "PlanetExpress")
+	recorder.now = func() time.Time {
+		return time.UnixMilli(3000000000000)
+	}
+
+	recorder.Inc(MetricTagVerificationMismatch)
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+
+	assert.Equal(t, float64(1), doc[MetricTagVerificationMismatch])
+
+	meta, ok := doc["_aws"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, float64(3000000000000), meta["Timestamp"])
+
+	directives, ok := meta["CloudWatchMetrics"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, directives, 1)
+
+	directive, ok := directives[0].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "PlanetExpress", directive["Namespace"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"Name": MetricTagVerificationMismatch, "Unit": "Count"}}, directive["Metrics"])
+}
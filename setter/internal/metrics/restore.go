@@ -0,0 +1,236 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// API calls that change tags of RDS resources.
+const (
+	addTagsCall    = "AddTagsToResource"
+	removeTagsCall = "RemoveTagsFromResource"
+)
+
+// tagChangeCall holds the request parameters of an AddTagsToResource or RemoveTagsFromResource call.
+type tagChangeCall struct {
+	ResourceName string `json:"resourceName"`
+	Tags         []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"tags"`
+	TagKeys []string `json:"tagKeys"`
+}
+
+// changedKeys returns the managed keys the call removed or set to a value other than the managed one, sorted.
+func (c tagChangeCall) changedKeys(eventName string, managed map[string]string) []string {
+	var keys []string
+
+	switch eventName {
+	case addTagsCall:
+		for _, tag := range c.Tags {
+			if want, ok := managed[tag.Key]; ok && tag.Value != want {
+				keys = append(keys, tag.Key)
+			}
+		}
+	case removeTagsCall:
+		for _, key := range c.TagKeys {
+			if _, ok := managed[key]; ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// keys returns the tag keys added, changed or removed by the call.
+func (c tagChangeCall) keys() []string {
+	keys := append([]string(nil), c.TagKeys...)
+	for _, tag := range c.Tags {
+		keys = append(keys, tag.Key)
+	}
+
+	return keys
+}
+
+// HandleTagChangeCall restores managed tags that someone removed from or changed on an autoscaled replica,
+// and propagates changes of inherited tags on the cluster to its replicas.
+func (h *Handler) HandleTagChangeCall(ctx context.Context, event events.CloudWatchEvent) (*Result, error) {
+	return h.process(ctx, event, h.handleTagChangeCall)
+}
+
+// handleTagChangeCall handles a single tag change call and records the decision in result.
+func (h *Handler) handleTagChangeCall(event events.CloudWatchEvent, result *Result) error {
+	expectedClusterID, tagsMap, err := h.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	detail, err := h.decodeCloudTrailEvent(event, addTagsCall, removeTagsCall)
+	if err != nil {
+		if errors.Is(err, ErrEventRejected) {
+			result.Outcome = OutcomeRejected
+			result.Reason = err.Error()
+		}
+
+		return err
+	}
+
+	var call tagChangeCall
+	if err := json.Unmarshal(detail.RequestParameters, &call); err != nil {
+		return fmt.Errorf("failed to decode %s request parameters: %w", detail.EventName, err)
+	}
+
+	caller := describeCaller(detail.UserIdentity)
+	result.Message = fmt.Sprintf("%s on %s called by %s", detail.EventName, call.ResourceName, caller)
+	result.Outcome = OutcomeSkipped
+
+	resource, err := arn.Parse(call.ResourceName)
+
+	// The resource comes from the payload, only resources in the account and region of the event are touched.
+	if err == nil && resource.Service == "rds" {
+		if reason := resourceArnMismatch(event, call.ResourceName, resource.Resource); reason != "" {
+			err := h.rejectEvent(event, reason)
+			result.Outcome = OutcomeRejected
+			result.Reason = err.Error()
+
+			return err
+		}
+	}
+
+	switch {
+	case err != nil || resource.Service != "rds":
+		result.Reason = fmt.Sprintf("resource %q is not an RDS resource", call.ResourceName)
+	case detail.ErrorCode != "":
+		result.Reason = fmt.Sprintf("call failed with %s", detail.ErrorCode)
+	case strings.HasPrefix(resource.Resource, "db:"):
+		return h.restoreInstanceTags(detail, call, strings.TrimPrefix(resource.Resource, "db:"), expectedClusterID, tagsMap, result)
+	case strings.HasPrefix(resource.Resource, "cluster:"):
+		return h.propagateClusterTags(detail, call, strings.TrimPrefix(resource.Resource, "cluster:"), expectedClusterID, tagsMap, result)
+	default:
+		result.Reason = fmt.Sprintf("resource %q is not a DB instance or cluster", call.ResourceName)
+	}
+
+	h.logger.Printf("Skipping %s on %s by %s: %s", detail.EventName, call.ResourceName, caller, result.Reason)
+
+	return nil
+}
+
+// restoreInstanceTags puts back the managed tags the call removed from or changed on an autoscaled replica.
+func (h *Handler) restoreInstanceTags(detail CloudTrailDetail, call tagChangeCall, dbInstanceID, expectedClusterID string,
+	tagsMap map[string]string, result *Result) error {
+	caller := describeCaller(detail.UserIdentity)
+	result.DBInstanceIdentifier = dbInstanceID
+	result.DBInstanceArn = call.ResourceName
+
+	changed := call.changedKeys(detail.EventName, tagsMap)
+
+	switch {
+	case !isAutoscaledReplica(dbInstanceID):
+		result.Reason = "not an autoscaled replica"
+	case len(changed) == 0:
+		result.Outcome = OutcomeUnchanged
+		result.Reason = "no managed tag changed"
+	default:
+		own, err := h.isOwnCall(detail.UserIdentity)
+		if err != nil {
+			return err
+		}
+
+		if own {
+			result.Reason = "tags changed by this function"
+		}
+	}
+
+	if result.Reason != "" {
+		h.logger.Printf("Skipping %s on DB instance %s by %s: %s", detail.EventName, dbInstanceID, caller, result.Reason)
+		return nil
+	}
+
+	h.logger.Printf("Managed tags %s on DB instance %s changed by %s (%s, principal %s, account %s)",
+		strings.Join(changed, ", "), dbInstanceID, caller, detail.UserIdentity.Type,
+		detail.UserIdentity.PrincipalID, detail.UserIdentity.AccountID)
+
+	clusterID, err := h.getClusterIdentifier(dbInstanceID)
+	if err != nil {
+		return err
+	}
+
+	result.ClusterIdentifier = clusterID
+
+	if clusterID != expectedClusterID {
+		result.Reason = fmt.Sprintf("not a member of cluster %s", expectedClusterID)
+		return nil
+	}
+
+	// The tags may have changed again since the call, so restore from their current state.
+	current, err := h.listTags(call.ResourceName)
+	if err != nil {
+		return err
+	}
+
+	restore := changedTags(tagsMap, current)
+	if len(restore) == 0 {
+		result.Outcome = OutcomeUnchanged
+		result.Reason = "managed tags already restored"
+
+		return nil
+	}
+
+	result.Outcome = OutcomeRestored
+	result.Reason = fmt.Sprintf("%s changed by %s", strings.Join(changed, ", "), caller)
+
+	if err := h.applyTags(dbInstanceID, call.ResourceName, restore, result); err != nil {
+		return err
+	}
+
+	h.recorder.Inc(MetricManagedTagsRestored)
+
+	return nil
+}
+
+// isOwnCall reports whether the call was made with the role this function runs as.
+// The role is looked up once and cached.
+func (h *Handler) isOwnCall(identity UserIdentity) (bool, error) {
+	if h.ownRole == "" {
+		output, err := h.sts.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+		if err != nil {
+			return false, fmt.Errorf("failed to get caller identity: %w", err)
+		}
+
+		h.ownRole = assumedRoleName(aws.StringValue(output.Arn))
+	}
+
+	role := identity.SessionContext.SessionIssuer.UserName
+	if role == "" {
+		role = assumedRoleName(identity.ARN)
+	}
+
+	return role != "" && role == h.ownRole, nil
+}
+
+// assumedRoleName returns the role name of an assumed-role session ARN, or the ARN itself for other principals.
+func assumedRoleName(principalArn string) string {
+	parsed, err := arn.Parse(principalArn)
+	if err != nil {
+		return principalArn
+	}
+
+	parts := strings.Split(parsed.Resource, "/")
+	if len(parts) >= 2 && parts[0] == "assumed-role" {
+		return parts[1]
+	}
+
+	return principalArn
+}
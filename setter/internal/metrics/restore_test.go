@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tagChangeEvent builds a CloudTrail tag change event for the given caller and request parameters.
+func tagChangeEvent(eventName, identity, parameters string) events.CloudWatchEvent {
+	raw, _ := json.Marshal(map[string]interface{}{
+		"eventName":         eventName,
+		"eventSource":       "rds.amazonaws.com",
+		"userIdentity":      json.RawMessage(identity),
+		"requestParameters": json.RawMessage(parameters),
+	})
+
+	return events.CloudWatchEvent{
+		ID:         "bender-was-here",
+		Source:     "aws.rds",
+		DetailType: "AWS API Call via CloudTrail",
+		AccountID:  "123456789012",
+		Region:     "us-east-1",
+		Detail:     raw,
+	}
+}
+
+// TestHandler_HandleTagChangeCall covers restoring managed tags after manual changes.
+// Bender keeps relabelling the crew quarters and the Professor keeps putting the labels back.
+func TestHandler_HandleTagChangeCall(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth","CostCenter":"delivery"}`)
+
+	const (
+		bender   = `{"type": "IAMUser", "arn": "arn:aws:iam::123456789012:user/bender", "principalId": "BENDER"}`
+		function = `{"type": "AssumedRole", "arn": "arn:aws:sts::123456789012:assumed-role/ro_set_tags/ro_set_tags_planet-express",
+			"sessionContext": {"sessionIssuer": {"userName": "ro_set_tags"}}}`
+		fryArn = "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"
+	)
+
+	tests := []struct {
+		name        string
+		event       events.CloudWatchEvent
+		cluster     string
+		currentTags map[string]string
+		wantOutcome Outcome
+		wantApplied map[string]string
+	}{
+		{
+			name: "removed managed tag is restored",
+			event: tagChangeEvent("RemoveTagsFromResource", bender,
+				`{"resourceName": "`+fryArn+`", "tagKeys": ["Owner", "Nickname"]}`),
+			currentTags: map[string]string{"CostCenter": "delivery"},
+			wantOutcome: OutcomeRestored,
+			wantApplied: map[string]string{"Owner": "professor-farnsworth"},
+		},
+		{
+			name: "changed managed tag is restored",
+			event: tagChangeEvent("AddTagsToResource", bender,
+				`{"resourceName": "`+fryArn+`", "tags": [{"key": "CostCenter", "value": "bending"}]}`),
+			currentTags: map[string]string{"Owner": "professor-farnsworth", "CostCenter": "bending"},
+			wantOutcome: OutcomeRestored,
+			wantApplied: map[string]string{"CostCenter": "delivery"},
+		},
+		{
+			name: "tag already changed back",
+			event: tagChangeEvent("AddTagsToResource", bender,
+				`{"resourceName": "`+fryArn+`", "tags": [{"key": "CostCenter", "value": "bending"}]}`),
+			currentTags: map[string]string{"Owner": "professor-farnsworth", "CostCenter": "delivery"},
+			wantOutcome: OutcomeUnchanged,
+		},
+		{
+			name: "unmanaged tag",
+			event: tagChangeEvent("AddTagsToResource", bender,
+				`{"resourceName": "`+fryArn+`", "tags": [{"key": "Nickname", "value": "meatbag"}]}`),
+			wantOutcome: OutcomeUnchanged,
+		},
+		{
+			name: "change made by this function",
+			event: tagChangeEvent("AddTagsToResource", function,
+				`{"resourceName": "`+fryArn+`", "tags": [{"key": "CostCenter", "value": "bending"}]}`),
+			wantOutcome: OutcomeSkipped,
+		},
+		{
+			name: "provisioned instance",
+			event: tagChangeEvent("RemoveTagsFromResource", bender,
+				`{"resourceName": "arn:aws:rds:us-east-1:123456789012:db:planet-express-writer", "tagKeys": ["Owner"]}`),
+			wantOutcome: OutcomeSkipped,
+		},
+		{
+			name: "resource in another account",
+			event: tagChangeEvent("RemoveTagsFromResource", bender,
+				`{"resourceName": "arn:aws:rds:us-east-1:666666666666:db:application-autoscaling-fry", "tagKeys": ["Owner"]}`),
+			wantOutcome: OutcomeRejected,
+		},
+		{
+			name: "replica of another cluster",
+			event: tagChangeEvent("RemoveTagsFromResource", bender,
+				`{"resourceName": "`+fryArn+`", "tagKeys": ["Owner"]}`),
+			cluster:     "nimbus",
+			wantOutcome: OutcomeSkipped,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardLogs(t)
+
+			cluster := tt.cluster
+			if cluster == "" {
+				cluster = "planet-express"
+			}
+
+			var applied map[string]string
+
+			mock := &mockRDS{
+				describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+					return &rds.DescribeDBInstancesOutput{
+						DBInstances: []*rds.DBInstance{
+							{
+								DBClusterIdentifier: aws.String(cluster),
+								DBInstanceArn:       aws.String(fryArn),
+							},
+						},
+					}, nil
+				},
+				listTagsForResourceFunc: func(input *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+					return &rds.ListTagsForResourceOutput{TagList: rdsTags(tt.currentTags)}, nil
+				},
+				addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+					applied = tagListToMap(input.Tags)
+					return &rds.AddTagsToResourceOutput{}, nil
+				},
+			}
+			stsMock := &mockSTS{
+				getCallerIdentityFunc: func(input *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+					return &sts.GetCallerIdentityOutput{
+						Account: aws.String("123456789012"),
+						Arn:     aws.String("arn:aws:sts::123456789012:assumed-role/ro_set_tags/ro_set_tags_planet-express"),
+					}, nil
+				},
+			}
+
+			recorder := &countingRecorder{}
+			handler := NewHandler(logrus.New(), mock, stsMock, WithRecorder(recorder))
+
+			result, err := handler.HandleTagChangeCall(context.Background(), tt.event)
+			if tt.wantOutcome == OutcomeRejected {
+				assert.ErrorIs(t, err, ErrEventRejected)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantOutcome, result.Outcome)
+			assert.Equal(t, tt.wantApplied, applied)
+
+			if tt.wantOutcome == OutcomeRestored {
+				assert.Equal(t, 1, recorder.counts[MetricManagedTagsRestored])
+				assert.Contains(t, result.Reason, "user/bender")
+			}
+		})
+	}
+}
+
+// TestAssumedRoleName checks role name extraction from session ARNs.
+func TestAssumedRoleName(t *testing.T) {
+	assert.Equal(t, "ro_set_tags", assumedRoleName("arn:aws:sts::123456789012:assumed-role/ro_set_tags/session"))
+	assert.Equal(t, "arn:aws:iam::123456789012:user/bender", assumedRoleName("arn:aws:iam::123456789012:user/bender"))
+}
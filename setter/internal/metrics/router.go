@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/sirupsen/logrus"
+)
+
+// RouteHandler processes a raw event payload selected by a Route.
+type RouteHandler func(ctx context.Context, payload json.RawMessage) (interface{}, error)
+
+// Route selects events for a handler. Empty fields match any value, and when several routes
+// match, the one with the most fields set wins, ties go to the route registered first.
+type Route struct {
+	// Name identifies the route in logs.
+	Name string
+	// Source matches the EventBridge source, for example aws.rds.
+	Source string
+	// DetailType matches the EventBridge detail-type.
+	DetailType string
+	// EventID matches the RDS event ID in the detail, for example RDS-EVENT-0005.
+	EventID string
+	// EventName matches the API call name of CloudTrail events, for example CreateDBInstance.
+	EventName string
+	// Handler processes the matching events.
+	Handler RouteHandler
+}
+
+// envelope holds the event fields used for routing.
+type envelope struct {
+	Source     string `json:"source"`
+	DetailType string `json:"detail-type"`
+	Detail     struct {
+		EventID   string `json:"EventID"`
+		EventName string `json:"eventName"`
+	} `json:"detail"`
+	// Records is set when the payload is a batch delivered by SQS or SNS, the
+	// case-insensitive match covers both eventSource and EventSource.
+	Records []struct {
+		EventSource string `json:"eventSource"`
+	} `json:"Records"`
+}
+
+// matches reports whether every field set on the route equals the envelope field.
+func (r Route) matches(env envelope) bool {
+	return matchField(r.Source, env.Source) &&
+		matchField(r.DetailType, env.DetailType) &&
+		matchField(r.EventID, env.Detail.EventID) &&
+		matchField(r.EventName, env.Detail.EventName)
+}
+
+// specificity counts the fields set on the route.
+func (r Route) specificity() int {
+	n := 0
+
+	for _, field := range []string{r.Source, r.DetailType, r.EventID, r.EventName} {
+		if field != "" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// matchField treats an empty route field as a wildcard.
+func matchField(want, got string) bool {
+	return want == "" || want == got
+}
+
+// Router dispatches raw Lambda payloads to the registered route handlers.
+type Router struct {
+	logger logrus.FieldLogger
+	routes []Route
+}
+
+// NewRouter creates a Router without any routes.
+func NewRouter(logger logrus.FieldLogger) *Router {
+	return &Router{logger: logger}
+}
+
+// Register adds a route, it can be used to plug in handlers for additional event types.
+func (r *Router) Register(route Route) {
+	r.routes = append(r.routes, route)
+}
+
+// route returns the most specific route matching the envelope.
+func (r *Router) route(env envelope) (Route, bool) {
+	var (
+		best  Route
+		found bool
+	)
+
+	for _, route := range r.routes {
+		if route.matches(env) && (!found || route.specificity() > best.specificity()) {
+			best = route
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// Handle routes a raw event payload. Events without a matching route are logged and acknowledged.
+// SQS batches and SNS notifications are detected and handled by HandleSQS and HandleSNS.
+func (r *Router) Handle(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var env envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		r.logger.Printf("Error unmarshalling event envelope: %v", err)
+		return nil, fmt.Errorf("failed to decode event: %w", err)
+	}
+
+	// Batches from SQS wrap the events in their message bodies.
+	if len(env.Records) > 0 && env.Records[0].EventSource == sqsEventSource {
+		var batch events.SQSEvent
+		if err := json.Unmarshal(payload, &batch); err != nil {
+			return nil, fmt.Errorf("failed to decode SQS batch: %w", err)
+		}
+
+		return r.HandleSQS(ctx, batch)
+	}
+
+	// Notifications from SNS carry the RDS event in their message.
+	if len(env.Records) > 0 && env.Records[0].EventSource == snsEventSource {
+		var notifications events.SNSEvent
+		if err := json.Unmarshal(payload, &notifications); err != nil {
+			return nil, fmt.Errorf("failed to decode SNS notifications: %w", err)
+		}
+
+		return r.HandleSNS(ctx, notifications)
+	}
+
+	fields := logrus.Fields{
+		"source":      env.Source,
+		"detail_type": env.DetailType,
+	}
+
+	route, ok := r.route(env)
+	if !ok {
+		r.logger.WithFields(fields).Printf("No handler registered for event. Ignoring.")
+
+		return &Result{
+			Outcome: OutcomeIgnored,
+			Reason:  fmt.Sprintf("no handler for source %q and detail-type %q", env.Source, env.DetailType),
+		}, nil
+	}
+
+	r.logger.WithFields(fields).Debugf("Routing event to %s", route.Name)
+
+	return route.Handler(ctx, payload)
+}
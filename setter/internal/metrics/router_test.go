@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRouter_Handle verifies route matching, precedence and the fallback for unknown events.
+// Every route answers with the name of the Planet Express crew member on duty.
+func TestRouter_Handle(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	router := NewRouter(logger)
+
+	crew := func(name string) RouteHandler {
+		return func(context.Context, json.RawMessage) (interface{}, error) {
+			return name, nil
+		}
+	}
+
+	router.Register(Route{Name: "any-rds", Source: "aws.rds", Handler: crew("hermes")})
+	router.Register(Route{Name: "instance", Source: "aws.rds", DetailType: "RDS DB Instance Event", Handler: crew("leela")})
+	router.Register(Route{Name: "created", Source: "aws.rds", DetailType: "RDS DB Instance Event", EventID: "RDS-EVENT-0005", Handler: crew("fry")})
+	router.Register(Route{Name: "create-call", DetailType: "AWS API Call via CloudTrail", EventName: "CreateDBInstance", Handler: crew("bender")})
+	router.Register(Route{Name: "late-instance", Source: "aws.rds", DetailType: "RDS DB Instance Event", Handler: crew("zoidberg")})
+
+	tests := []struct {
+		name    string
+		payload string
+		want    interface{}
+	}{
+		{
+			name:    "most specific route wins",
+			payload: `{"source": "aws.rds", "detail-type": "RDS DB Instance Event", "detail": {"EventID": "RDS-EVENT-0005"}}`,
+			want:    "fry",
+		},
+		{
+			name:    "first registered route wins a tie",
+			payload: `{"source": "aws.rds", "detail-type": "RDS DB Instance Event", "detail": {"EventID": "RDS-EVENT-0003"}}`,
+			want:    "leela",
+		},
+		{
+			name:    "source only route",
+			payload: `{"source": "aws.rds", "detail-type": "RDS DB Snapshot Event", "detail": {}}`,
+			want:    "hermes",
+		},
+		{
+			name:    "cloudtrail event name",
+			payload: `{"source": "aws.rds", "detail-type": "AWS API Call via CloudTrail", "detail": {"eventName": "CreateDBInstance"}}`,
+			want:    "bender",
+		},
+		{
+			name:    "unknown event is acknowledged",
+			payload: `{"source": "mom.corp", "detail-type": "Evil Plan", "detail": {}}`,
+			want: &Result{
+				Outcome: OutcomeIgnored,
+				Reason:  `no handler for source "mom.corp" and detail-type "Evil Plan"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := router.Handle(context.Background(), json.RawMessage(tt.payload))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("malformed payload", func(t *testing.T) {
+		_, err := router.Handle(context.Background(), json.RawMessage(`slurm`))
+		assert.Error(t, err)
+	})
+}
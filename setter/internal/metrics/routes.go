@@ -0,0 +1,226 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Sources and detail types of the events routed to the handler.
+const (
+	// ManualEventSource is the source of requests sent by operators, directly or through EventBridge.
+	ManualEventSource = "rds-tag-setter"
+	// SweepRequestDetailType is the detail-type of a manual request to reconcile a cluster.
+	SweepRequestDetailType = "Sweep Request"
+
+	rdsClusterEventDetailType = "RDS DB Cluster Event"
+	scheduledEventSource      = "aws.events"
+	scheduledEventDetailType  = "Scheduled Event"
+	rdsSourceTypeCluster      = "CLUSTER"
+)
+
+// clusterSweepEvents are the RDS cluster event IDs after which replicas may lack their tags.
+var clusterSweepEvents = map[string]bool{
+	// Failover completed, the members of the cluster changed roles.
+	"RDS-EVENT-0071": true,
+	// DB cluster created, for instance restored from a snapshot under the configured identifier.
+	"RDS-EVENT-0170": true,
+}
+
+// SweepRequest is the detail of a manual sweep request, an empty cluster means the configured one.
+type SweepRequest struct {
+	ClusterIdentifier string `json:"cluster_identifier"`
+}
+
+// RegisterRoutes registers the handler for RDS instance and cluster events, CloudTrail API calls, scheduled sweeps
+// and manual sweep and catch-up requests.
+func (h *Handler) RegisterRoutes(r *Router) {
+	r.Register(Route{
+		Name:       "rds-instance-created",
+		Source:     rdsEventSource,
+		DetailType: rdsInstanceEventDetailType,
+		EventID:    rdsEventInstanceCreated,
+		Handler:    h.routeInstanceCreated,
+	})
+	r.Register(Route{
+		Name:       "rds-instance-deleted",
+		Source:     rdsEventSource,
+		DetailType: rdsInstanceEventDetailType,
+		EventID:    rdsEventInstanceDeleted,
+		Handler:    h.routeInstanceDeleted,
+	})
+	r.Register(Route{
+		Name:       "rds-instance-create-call",
+		Source:     rdsEventSource,
+		DetailType: cloudTrailDetailType,
+		EventName:  "CreateDBInstance",
+		Handler:    h.routeCreateDBInstanceCall,
+	})
+	r.Register(Route{
+		Name:       "rds-add-tags-call",
+		Source:     rdsEventSource,
+		DetailType: cloudTrailDetailType,
+		EventName:  addTagsCall,
+		Handler:    h.routeTagChangeCall,
+	})
+	r.Register(Route{
+		Name:       "rds-remove-tags-call",
+		Source:     rdsEventSource,
+		DetailType: cloudTrailDetailType,
+		EventName:  removeTagsCall,
+		Handler:    h.routeTagChangeCall,
+	})
+	r.Register(Route{
+		Name:       "rds-cluster-event",
+		Source:     rdsEventSource,
+		DetailType: rdsClusterEventDetailType,
+		Handler:    h.routeClusterEvent,
+	})
+	r.Register(Route{
+		Name:       "scheduled-sweep",
+		Source:     scheduledEventSource,
+		DetailType: scheduledEventDetailType,
+		Handler:    h.routeScheduledSweep,
+	})
+	r.Register(Route{
+		Name:       "manual-sweep",
+		Source:     ManualEventSource,
+		DetailType: SweepRequestDetailType,
+		Handler:    h.routeManualSweep,
+	})
+	r.Register(Route{
+		Name:       "catch-up",
+		Source:     ManualEventSource,
+		DetailType: CatchUpRequestDetailType,
+		Handler:    h.routeCatchUp,
+	})
+}
+
+// routeInstanceCreated tags the replica of an RDS instance creation event.
+func (h *Handler) routeInstanceCreated(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var event events.CloudWatchEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode RDS instance event: %w", err)
+	}
+
+	return h.HandleRequest(ctx, event)
+}
+
+// routeInstanceDeleted removes the replica of an RDS instance deletion event from custom endpoints.
+func (h *Handler) routeInstanceDeleted(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var event events.CloudWatchEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode RDS instance event: %w", err)
+	}
+
+	return h.HandleInstanceDeleted(ctx, event)
+}
+
+// routeClusterEvent sweeps the configured cluster when one of its events can leave replicas untagged, such as a
+// completed failover. Other events and clusters are ignored, events from a foreign origin are rejected.
+func (h *Handler) routeClusterEvent(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var event events.CloudWatchEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode RDS cluster event: %w", err)
+	}
+
+	var detail EventDetail
+	if err := json.Unmarshal(event.Detail, &detail); err != nil {
+		return nil, fmt.Errorf("failed to decode RDS cluster event detail: %w", err)
+	}
+
+	result := &Result{EventID: event.ID, RDSEventID: detail.EventID, Message: detail.Message}
+
+	if reason := h.clusterEventMismatch(event, detail); reason != "" {
+		result.Outcome = OutcomeRejected
+		result.Reason = reason
+
+		return result, h.rejectEvent(event, reason)
+	}
+
+	expectedClusterID, _, err := h.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case detail.SourceIdentifier != expectedClusterID:
+		result.Outcome = OutcomeIgnored
+		result.Reason = fmt.Sprintf("event for cluster %s, expected %s", detail.SourceIdentifier, expectedClusterID)
+
+		return result, nil
+	case !clusterSweepEvents[detail.EventID]:
+		result.Outcome = OutcomeIgnored
+		result.Reason = fmt.Sprintf("cluster event %s does not affect replica tags", detail.EventID)
+
+		return result, nil
+	}
+
+	return h.Sweep(ctx, expectedClusterID)
+}
+
+// routeScheduledSweep sweeps the configured cluster on an EventBridge schedule.
+func (h *Handler) routeScheduledSweep(ctx context.Context, _ json.RawMessage) (interface{}, error) {
+	return h.Sweep(ctx, "")
+}
+
+// routeManualSweep sweeps the cluster named in a manual sweep request.
+func (h *Handler) routeManualSweep(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var event struct {
+		Detail SweepRequest `json:"detail"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode sweep request: %w", err)
+	}
+
+	return h.Sweep(ctx, event.Detail.ClusterIdentifier)
+}
+
+// routeCreateDBInstanceCall tags the replica of a CloudTrail CreateDBInstance event.
+func (h *Handler) routeCreateDBInstanceCall(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var event events.CloudWatchEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode CloudTrail event: %w", err)
+	}
+
+	return h.HandleCreateDBInstanceCall(ctx, event)
+}
+
+// routeTagChangeCall restores managed tags after a CloudTrail AddTagsToResource or RemoveTagsFromResource event.
+func (h *Handler) routeTagChangeCall(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var event events.CloudWatchEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode CloudTrail event: %w", err)
+	}
+
+	return h.HandleTagChangeCall(ctx, event)
+}
+
+// routeCatchUp recovers missed creation events over the lookback of a catch-up request.
+func (h *Handler) routeCatchUp(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var event struct {
+		Detail CatchUpRequest `json:"detail"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode catch-up request: %w", err)
+	}
+
+	lookback := h.catchUpLookback
+	if lookback <= 0 {
+		lookback = 24 * time.Hour
+	}
+
+	if event.Detail.Lookback != "" {
+		var err error
+
+		lookback, err = time.ParseDuration(event.Detail.Lookback)
+		if err != nil || lookback <= 0 || lookback > maxCatchUpLookback {
+			return nil, fmt.Errorf("lookback must be a duration up to %s, got %q", maxCatchUpLookback, event.Detail.Lookback)
+		}
+	}
+
+	return h.CatchUp(ctx, lookback)
+}
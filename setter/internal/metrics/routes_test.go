@@ -0,0 +1,243 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandler_RegisterRoutes checks that each built-in route reaches the right part of the handler.
+func TestHandler_RegisterRoutes(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	mock := &mockRDS{
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			if len(input.Filters) > 0 {
+				// Sweep listing of the cluster members.
+				return &rds.DescribeDBInstancesOutput{}, nil
+			}
+
+			return &rds.DescribeDBInstancesOutput{
+				DBInstances: []*rds.DBInstance{
+					{
+						DBClusterIdentifier: aws.String("planet-express"),
+						DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+					},
+				},
+			}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+	}
+
+	logger := logrus.New()
+	router := NewRouter(logger)
+	NewHandler(logger, mock, &mockSTS{}).RegisterRoutes(router)
+
+	tests := []struct {
+		name    string
+		payload string
+		check   func(t *testing.T, got interface{})
+	}{
+		{
+			name: "instance created",
+			payload: `{"id": "good-news", "source": "aws.rds", "detail-type": "RDS DB Instance Event", "account": "123456789012", "region": "us-east-1",
+				"detail": {"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-fry",
+				"SourceArn": "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"}}`,
+			check: func(t *testing.T, got interface{}) {
+				result, ok := got.(*Result)
+				require.True(t, ok)
+				assert.Equal(t, OutcomeTagged, result.Outcome)
+			},
+		},
+		{
+			name: "instance create call by autoscaling",
+			payload: `{"id": "hypnotoad", "source": "aws.rds", "detail-type": "AWS API Call via CloudTrail", "account": "123456789012", "region": "us-east-1",
+				"detail": {"eventName": "CreateDBInstance", "eventSource": "rds.amazonaws.com",
+				"userIdentity": {"invokedBy": "application-autoscaling.amazonaws.com"},
+				"requestParameters": {"dBInstanceIdentifier": "application-autoscaling-fry", "dBClusterIdentifier": "planet-express"}}}`,
+			check: func(t *testing.T, got interface{}) {
+				result, ok := got.(*Result)
+				require.True(t, ok)
+				assert.Equal(t, OutcomeTagged, result.Outcome)
+				assert.Equal(t, "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry", result.DBInstanceArn)
+			},
+		},
+		{
+			name: "instance deleted",
+			payload: `{"id": "bad-news", "source": "aws.rds", "detail-type": "RDS DB Instance Event", "account": "123456789012", "region": "us-east-1",
+				"detail": {"EventID": "RDS-EVENT-0003", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-fry",
+				"SourceArn": "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"}}`,
+			check: func(t *testing.T, got interface{}) {
+				result, ok := got.(*Result)
+				require.True(t, ok)
+				assert.Equal(t, OutcomeRemoved, result.Outcome)
+				assert.Equal(t, "replica deleted", result.Reason)
+			},
+		},
+		{
+			name:    "other instance event is ignored",
+			payload: `{"source": "aws.rds", "detail-type": "RDS DB Instance Event", "detail": {"EventID": "RDS-EVENT-0006"}}`,
+			check: func(t *testing.T, got interface{}) {
+				result, ok := got.(*Result)
+				require.True(t, ok)
+				assert.Equal(t, OutcomeIgnored, result.Outcome)
+			},
+		},
+		{
+			name:    "event of the configured cluster triggers a sweep",
+			payload: `{"source": "aws.rds", "detail-type": "RDS DB Cluster Event", "detail": {"EventID": "RDS-EVENT-0071", "SourceType": "CLUSTER", "SourceIdentifier": "planet-express"}}`,
+			check: func(t *testing.T, got interface{}) {
+				sweep, ok := got.(*SweepResult)
+				require.True(t, ok)
+				assert.Equal(t, "planet-express", sweep.ClusterIdentifier)
+			},
+		},
+		{
+			name:    "event of another cluster is ignored",
+			payload: `{"source": "aws.rds", "detail-type": "RDS DB Cluster Event", "detail": {"EventID": "RDS-EVENT-0071", "SourceType": "CLUSTER", "SourceIdentifier": "momcorp"}}`,
+			check: func(t *testing.T, got interface{}) {
+				result, ok := got.(*Result)
+				require.True(t, ok)
+				assert.Equal(t, OutcomeIgnored, result.Outcome)
+			},
+		},
+		{
+			name:    "scheduled sweep",
+			payload: `{"source": "aws.events", "detail-type": "Scheduled Event", "detail": {}}`,
+			check: func(t *testing.T, got interface{}) {
+				sweep, ok := got.(*SweepResult)
+				require.True(t, ok)
+				assert.Equal(t, "planet-express", sweep.ClusterIdentifier)
+			},
+		},
+		{
+			name:    "manual sweep",
+			payload: `{"source": "rds-tag-setter", "detail-type": "Sweep Request", "detail": {"cluster_identifier": "planet-express"}}`,
+			check: func(t *testing.T, got interface{}) {
+				sweep, ok := got.(*SweepResult)
+				require.True(t, ok)
+				assert.Equal(t, "planet-express", sweep.ClusterIdentifier)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := router.Handle(context.Background(), json.RawMessage(tt.payload))
+			require.NoError(t, err)
+			tt.check(t, got)
+		})
+	}
+
+	t.Run("manual sweep of a foreign cluster", func(t *testing.T) {
+		_, err := router.Handle(context.Background(), json.RawMessage(
+			`{"source": "rds-tag-setter", "detail-type": "Sweep Request", "detail": {"cluster_identifier": "momcorp"}}`))
+		assert.Error(t, err)
+	})
+}
+
+// TestHandler_RouteClusterEvent checks that cluster events are validated and only sweep when they can affect
+// replica tags. Mom's clusters in other accounts get no say over Planet Express.
+func TestHandler_RouteClusterEvent(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	clusterEvent := func(account, region, sourceType, eventID string) string {
+		return `{"id": "cluster-news", "source": "aws.rds", "detail-type": "RDS DB Cluster Event", "account": "` + account +
+			`", "region": "` + region + `", "detail": {"EventID": "` + eventID + `", "SourceType": "` + sourceType +
+			`", "SourceIdentifier": "planet-express"}}`
+	}
+
+	tests := []struct {
+		name        string
+		payload     string
+		wantSweep   bool
+		wantOutcome Outcome
+		wantErr     error
+	}{
+		{
+			name:      "failover completed",
+			payload:   clusterEvent("123456789012", "us-east-1", "CLUSTER", "RDS-EVENT-0071"),
+			wantSweep: true,
+		},
+		{
+			name:      "cluster created",
+			payload:   clusterEvent("123456789012", "us-east-1", "CLUSTER", "RDS-EVENT-0170"),
+			wantSweep: true,
+		},
+		{
+			name:        "event not affecting replica tags",
+			payload:     clusterEvent("123456789012", "us-east-1", "CLUSTER", "RDS-EVENT-0173"),
+			wantOutcome: OutcomeIgnored,
+		},
+		{
+			name:        "account not allowed",
+			payload:     clusterEvent("999999999999", "us-east-1", "CLUSTER", "RDS-EVENT-0071"),
+			wantOutcome: OutcomeRejected,
+			wantErr:     ErrEventRejected,
+		},
+		{
+			name:        "region not allowed",
+			payload:     clusterEvent("123456789012", "eu-west-1", "CLUSTER", "RDS-EVENT-0071"),
+			wantOutcome: OutcomeRejected,
+			wantErr:     ErrEventRejected,
+		},
+		{
+			name:        "wrong source type",
+			payload:     clusterEvent("123456789012", "us-east-1", "DB_INSTANCE", "RDS-EVENT-0071"),
+			wantOutcome: OutcomeRejected,
+			wantErr:     ErrEventRejected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardLogs(t)
+
+			swept := false
+
+			mock := &mockRDS{
+				describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+					swept = true
+					return &rds.DescribeDBInstancesOutput{}, nil
+				},
+			}
+
+			recorder := &countingRecorder{}
+			handler := NewHandler(logrus.New(), mock, &mockSTS{}, WithRecorder(recorder),
+				WithAllowedAccounts("123456789012"), WithAllowedRegions("us-east-1"))
+
+			got, err := handler.routeClusterEvent(context.Background(), json.RawMessage(tt.payload))
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Equal(t, 1, recorder.counts[MetricEventRejected])
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantSweep, swept)
+
+			if tt.wantSweep {
+				_, ok := got.(*SweepResult)
+				assert.True(t, ok)
+
+				return
+			}
+
+			result, ok := got.(*Result)
+			require.True(t, ok)
+			assert.Equal(t, tt.wantOutcome, result.Outcome)
+			assert.Equal(t, "cluster-news", result.EventID)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+)
+
+// ScalableTargetResult is the decision taken for the Application Auto Scaling scalable target of the cluster.
+type ScalableTargetResult struct {
+	ResourceARN string            `json:"resource_arn,omitempty"`
+	Outcome     Outcome           `json:"outcome"`
+	Reason      string            `json:"reason,omitempty"`
+	TagsApplied map[string]string `json:"tags_applied,omitempty"`
+}
+
+// TagScalableTargetOnStart tags the scalable target of the configured cluster at startup, it does nothing
+// unless scalable target tagging is enabled.
+func (h *Handler) TagScalableTargetOnStart(ctx context.Context) (*ScalableTargetResult, error) {
+	if h.autoscaling == nil {
+		return nil, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.logger = loggerFromContext(ctx)
+	h.requestID = requestIDFromContext(ctx)
+	h.deadline, _ = ctx.Deadline()
+
+	clusterID, tagsMap, err := h.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return h.tagScalableTarget(clusterID, tagsMap)
+}
+
+// tagScalableTarget writes the tags that are missing or differ to the read replica scalable target of the
+// cluster. Only scalable targets can be tagged, the scaling policies attached to them cannot.
+func (h *Handler) tagScalableTarget(clusterID string, tagsMap map[string]string) (*ScalableTargetResult, error) {
+	result := &ScalableTargetResult{Outcome: OutcomeSkipped}
+
+	output, err := h.autoscaling.DescribeScalableTargets(&applicationautoscaling.DescribeScalableTargetsInput{
+		ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceRds),
+		ScalableDimension: aws.String(applicationautoscaling.ScalableDimensionRdsClusterReadReplicaCount),
+		ResourceIds:       aws.StringSlice([]string{"cluster:" + clusterID}),
+	})
+	if err != nil {
+		result.Outcome = OutcomeFailed
+		h.logger.Printf("Error describing scalable target of cluster %s: %v", clusterID, err)
+		return result, fmt.Errorf("failed to describe scalable target of cluster %s: %w", clusterID, err)
+	}
+
+	if len(output.ScalableTargets) == 0 {
+		result.Reason = "no scalable target registered"
+		h.logger.Printf("Cluster %s has no scalable target. Skipping.", clusterID)
+
+		return result, nil
+	}
+
+	arn := aws.StringValue(output.ScalableTargets[0].ScalableTargetARN)
+	result.ResourceARN = arn
+
+	tags, err := h.autoscaling.ListTagsForResource(&applicationautoscaling.ListTagsForResourceInput{
+		ResourceARN: aws.String(arn),
+	})
+	if err != nil {
+		result.Outcome = OutcomeFailed
+		h.logger.Printf("Error reading tags of scalable target %s: %v", arn, err)
+		return result, fmt.Errorf("failed to list tags of scalable target %s: %w", arn, err)
+	}
+
+	changes := changedTags(tagsMap, aws.StringValueMap(tags.Tags))
+	if len(changes) == 0 {
+		result.Outcome = OutcomeUnchanged
+		h.logger.Printf("All tags already present on scalable target %s. Skipping.", arn)
+
+		return result, nil
+	}
+
+	_, err = h.autoscaling.TagResource(&applicationautoscaling.TagResourceInput{
+		ResourceARN: aws.String(arn),
+		Tags:        aws.StringMap(changes),
+	})
+	if err != nil {
+		result.Outcome = OutcomeFailed
+		h.logger.Printf("Error tagging scalable target %s: %v", arn, err)
+
+		return result, fmt.Errorf("failed to tag scalable target %s: %w", arn, err)
+	}
+
+	result.Outcome = OutcomeTagged
+	result.TagsApplied = changes
+	h.logger.Printf("Tagged scalable target %s with %d tags", arn, len(changes))
+
+	return result, nil
+}
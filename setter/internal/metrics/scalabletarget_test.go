@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandler_TagScalableTarget covers tagging the read replica scalable target of the cluster.
+// The Professor's crew hiring machine gets the company badge too.
+func TestHandler_TagScalableTarget(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth","Purpose":"delivery-company"}`)
+
+	const targetARN = "arn:aws:application-autoscaling:us-east-1:123456789012:scalable-target/0ec5f00d"
+
+	tests := []struct {
+		name        string
+		registered  bool
+		tags        map[string]string
+		tagErr      error
+		wantOutcome Outcome
+		wantTagged  map[string]string
+		wantErr     bool
+	}{
+		{
+			name:        "untagged target",
+			registered:  true,
+			wantOutcome: OutcomeTagged,
+			wantTagged:  map[string]string{"Owner": "professor-farnsworth", "Purpose": "delivery-company"},
+		},
+		{
+			name:        "only differences are written",
+			registered:  true,
+			tags:        map[string]string{"Owner": "bender", "Purpose": "delivery-company"},
+			wantOutcome: OutcomeTagged,
+			wantTagged:  map[string]string{"Owner": "professor-farnsworth"},
+		},
+		{
+			name:        "tags already present",
+			registered:  true,
+			tags:        map[string]string{"Owner": "professor-farnsworth", "Purpose": "delivery-company"},
+			wantOutcome: OutcomeUnchanged,
+		},
+		{
+			name:        "no scalable target",
+			wantOutcome: OutcomeSkipped,
+		},
+		{
+			name:        "tagging fails",
+			registered:  true,
+			tagErr:      errors.New("the hiring machine is out of badges"),
+			wantOutcome: OutcomeFailed,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardLogs(t)
+
+			var tagged map[string]string
+
+			mock := &mockApplicationAutoScaling{
+				describeScalableTargetsFunc: func(input *applicationautoscaling.DescribeScalableTargetsInput) (*applicationautoscaling.DescribeScalableTargetsOutput, error) {
+					assert.Equal(t, "rds", aws.StringValue(input.ServiceNamespace))
+					assert.Equal(t, "rds:cluster:ReadReplicaCount", aws.StringValue(input.ScalableDimension))
+					assert.Equal(t, []string{"cluster:planet-express"}, aws.StringValueSlice(input.ResourceIds))
+
+					if !tt.registered {
+						return &applicationautoscaling.DescribeScalableTargetsOutput{}, nil
+					}
+
+					return &applicationautoscaling.DescribeScalableTargetsOutput{
+						ScalableTargets: []*applicationautoscaling.ScalableTarget{{ScalableTargetARN: aws.String(targetARN)}},
+					}, nil
+				},
+				listTagsForResourceFunc: func(input *applicationautoscaling.ListTagsForResourceInput) (*applicationautoscaling.ListTagsForResourceOutput, error) {
+					assert.Equal(t, targetARN, aws.StringValue(input.ResourceARN))
+					return &applicationautoscaling.ListTagsForResourceOutput{Tags: aws.StringMap(tt.tags)}, nil
+				},
+				tagResourceFunc: func(input *applicationautoscaling.TagResourceInput) (*applicationautoscaling.TagResourceOutput, error) {
+					if tt.tagErr != nil {
+						return nil, tt.tagErr
+					}
+
+					tagged = aws.StringValueMap(input.Tags)
+
+					return &applicationautoscaling.TagResourceOutput{}, nil
+				},
+			}
+
+			handler := NewHandler(logrus.New(), &mockRDS{}, &mockSTS{}, WithScalableTargetTagging(mock))
+
+			result, err := handler.TagScalableTargetOnStart(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.NotNil(t, result)
+			assert.Equal(t, tt.wantOutcome, result.Outcome)
+			assert.Equal(t, tt.wantTagged, tagged)
+			assert.Equal(t, tt.wantTagged, result.TagsApplied)
+		})
+	}
+}
+
+// TestHandler_TagScalableTargetInSweep checks that sweeps include the scalable target.
+func TestHandler_TagScalableTargetInSweep(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	rdsMock := &mockRDS{
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			return &rds.DescribeDBInstancesOutput{}, nil
+		},
+	}
+	scalingMock := &mockApplicationAutoScaling{
+		describeScalableTargetsFunc: func(input *applicationautoscaling.DescribeScalableTargetsInput) (*applicationautoscaling.DescribeScalableTargetsOutput, error) {
+			return nil, errors.New("the scheduling office is closed")
+		},
+	}
+
+	sweep, err := NewHandler(logrus.New(), rdsMock, &mockSTS{}, WithScalableTargetTagging(scalingMock)).Sweep(context.Background(), "")
+	assert.Error(t, err)
+	require.NotNil(t, sweep.ScalableTarget)
+	assert.Equal(t, OutcomeFailed, sweep.ScalableTarget.Outcome)
+
+	result, err := NewHandler(logrus.New(), rdsMock, &mockSTS{}).TagScalableTargetOnStart(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, result, "nothing is tagged unless enabled")
+}
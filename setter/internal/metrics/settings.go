@@ -0,0 +1,227 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// rdsInstanceStatusAvailable is the status in which a DB instance accepts modifications.
+const rdsInstanceStatusAvailable = "available"
+
+// defaultSettingsWait bounds the wait for an available instance, the invocation deadline can cut it shorter.
+const defaultSettingsWait = 20 * time.Second
+
+// InstanceSettings are the settings autoscaled replicas should have, unset fields are left as the replica
+// copied them from the cluster.
+type InstanceSettings struct {
+	PerformanceInsightsRetentionPeriod *int64  `json:"performance_insights_retention_period,omitempty"`
+	MonitoringInterval                 *int64  `json:"monitoring_interval,omitempty"`
+	MonitoringRoleArn                  *string `json:"monitoring_role_arn,omitempty"`
+	PromotionTier                      *int64  `json:"promotion_tier,omitempty"`
+	CACertificateIdentifier            *string `json:"ca_certificate_identifier,omitempty"`
+}
+
+// ParseInstanceSettings decodes and validates desired instance settings given as JSON.
+func ParseInstanceSettings(raw string) (InstanceSettings, error) {
+	var settings InstanceSettings
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&settings); err != nil {
+		return InstanceSettings{}, fmt.Errorf("failed to decode instance settings: %w", err)
+	}
+
+	if err := settings.validate(); err != nil {
+		return InstanceSettings{}, err
+	}
+
+	return settings, nil
+}
+
+// validate rejects values that ModifyDBInstance would refuse.
+func (s InstanceSettings) validate() error {
+	if s.PerformanceInsightsRetentionPeriod != nil {
+		days := *s.PerformanceInsightsRetentionPeriod
+		if days != 7 && days != 731 && (days < 31 || days > 713 || days%31 != 0) {
+			return fmt.Errorf("performance_insights_retention_period must be 7, 731 or a multiple of 31 up to 713, got %d", days)
+		}
+	}
+
+	if s.MonitoringInterval != nil {
+		switch interval := *s.MonitoringInterval; interval {
+		case 0, 1, 5, 10, 15, 30, 60:
+			if interval > 0 && aws.StringValue(s.MonitoringRoleArn) == "" {
+				return errors.New("monitoring_role_arn is required when monitoring_interval is not 0")
+			}
+		default:
+			return fmt.Errorf("monitoring_interval must be one of 0, 1, 5, 10, 15, 30 or 60, got %d", interval)
+		}
+	}
+
+	if s.PromotionTier != nil && (*s.PromotionTier < 0 || *s.PromotionTier > 15) {
+		return fmt.Errorf("promotion_tier must be between 0 and 15, got %d", *s.PromotionTier)
+	}
+
+	return nil
+}
+
+// diff returns the modification bringing the instance to the desired settings, and the changed settings
+// with their current and desired values. The modification is nil when the instance has the settings already.
+func (s InstanceSettings) diff(instance *rds.DBInstance) (*rds.ModifyDBInstanceInput, map[string]string) {
+	input := &rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: instance.DBInstanceIdentifier,
+		ApplyImmediately:     aws.Bool(true),
+	}
+	changes := make(map[string]string)
+
+	if want := s.PerformanceInsightsRetentionPeriod; want != nil {
+		enabled := aws.BoolValue(instance.PerformanceInsightsEnabled)
+		if current := aws.Int64Value(instance.PerformanceInsightsRetentionPeriod); !enabled || current != *want {
+			input.EnablePerformanceInsights = aws.Bool(true)
+			input.PerformanceInsightsRetentionPeriod = want
+			changes["PerformanceInsightsRetentionPeriod"] = retentionChange(enabled, current, *want)
+		}
+	}
+
+	if want := s.MonitoringInterval; want != nil {
+		if current := aws.Int64Value(instance.MonitoringInterval); current != *want {
+			input.MonitoringInterval = want
+			if *want > 0 {
+				input.MonitoringRoleArn = s.MonitoringRoleArn
+			}
+
+			changes["MonitoringInterval"] = fmt.Sprintf("%d -> %d", current, *want)
+		}
+	}
+
+	if want := s.PromotionTier; want != nil {
+		if current := aws.Int64Value(instance.PromotionTier); current != *want {
+			input.PromotionTier = want
+			changes["PromotionTier"] = fmt.Sprintf("%d -> %d", current, *want)
+		}
+	}
+
+	if want := s.CACertificateIdentifier; want != nil {
+		if current := aws.StringValue(instance.CACertificateIdentifier); current != *want {
+			input.CACertificateIdentifier = want
+			changes["CACertificateIdentifier"] = fmt.Sprintf("%s -> %s", current, *want)
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	return input, changes
+}
+
+// retentionChange formats the change of the Performance Insights retention, which only applies while it is enabled.
+func retentionChange(enabled bool, current, want int64) string {
+	if !enabled {
+		return fmt.Sprintf("disabled -> %d", want)
+	}
+
+	return fmt.Sprintf("%d -> %d", current, want)
+}
+
+// desiredSettings returns the settings new replicas are modified to, including the enforced promotion tier.
+func (h *Handler) desiredSettings() *InstanceSettings {
+	if h.promotionTier == nil {
+		return h.instanceSettings
+	}
+
+	var settings InstanceSettings
+	if h.instanceSettings != nil {
+		settings = *h.instanceSettings
+	}
+
+	settings.PromotionTier = h.promotionTier
+
+	return &settings
+}
+
+// applyInstanceSettings modifies the replica where it differs from the desired settings, once it is available.
+// In dry-run mode the differences are only logged and reported.
+func (h *Handler) applyInstanceSettings(dbInstanceID string, result *Result) error {
+	settings := h.desiredSettings()
+	if settings == nil {
+		return nil
+	}
+
+	instance, err := h.waitForAvailable(dbInstanceID)
+	if err != nil {
+		h.logger.Printf("Error waiting for DB instance %s to become available: %v", dbInstanceID, err)
+		return err
+	}
+
+	input, changes := settings.diff(instance)
+	if input == nil {
+		return nil
+	}
+
+	result.SettingsChanged = changes
+
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	if h.settingsDryRun {
+		result.SettingsDryRun = true
+		h.logger.Printf("Dry run, would modify DB instance %s: %v", dbInstanceID, keys)
+
+		return nil
+	}
+
+	if _, err := h.rds.ModifyDBInstance(input); err != nil {
+		h.logger.Printf("Error modifying DB instance %s: %v", dbInstanceID, err)
+		return fmt.Errorf("failed to modify DB instance %s: %w", dbInstanceID, err)
+	}
+
+	h.recorder.Inc(MetricInstanceSettingsModified)
+	h.logger.Printf("Modified DB instance %s: %v", dbInstanceID, keys)
+
+	return nil
+}
+
+// waitForAvailable describes the instance until its status is available, for up to settingsWait.
+func (h *Handler) waitForAvailable(dbInstanceID string) (*rds.DBInstance, error) {
+	for waited := time.Duration(0); ; waited += h.resourceWaitDelay {
+		output, err := h.rds.DescribeDBInstances(&rds.DescribeDBInstancesInput{
+			DBInstanceIdentifier: aws.String(dbInstanceID),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe DB instance %s: %w", dbInstanceID, err)
+		}
+
+		if len(output.DBInstances) == 0 {
+			return nil, fmt.Errorf("DB instance %s not found", dbInstanceID)
+		}
+
+		instance := output.DBInstances[0]
+
+		status := aws.StringValue(instance.DBInstanceStatus)
+		if status == rdsInstanceStatusAvailable {
+			return instance, nil
+		}
+
+		if waited+h.resourceWaitDelay > h.settingsWait {
+			return nil, fmt.Errorf("DB instance %s is still %s after %s", dbInstanceID, status, waited)
+		}
+
+		h.logger.Printf("DB instance %s is %s, waiting %s for it to become available", dbInstanceID, status, h.resourceWaitDelay)
+		if err := h.wait(h.resourceWaitDelay); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseInstanceSettings checks decoding and validation of desired instance settings.
+func TestParseInstanceSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    InstanceSettings
+		wantErr bool
+	}{
+		{
+			name: "all settings",
+			raw: `{"performance_insights_retention_period": 31, "monitoring_interval": 60,
+				"monitoring_role_arn": "arn:aws:iam::123456789012:role/rds-monitoring", "promotion_tier": 15,
+				"ca_certificate_identifier": "rds-ca-rsa2048-g1"}`,
+			want: InstanceSettings{
+				PerformanceInsightsRetentionPeriod: aws.Int64(31),
+				MonitoringInterval:                 aws.Int64(60),
+				MonitoringRoleArn:                  aws.String("arn:aws:iam::123456789012:role/rds-monitoring"),
+				PromotionTier:                      aws.Int64(15),
+				CACertificateIdentifier:            aws.String("rds-ca-rsa2048-g1"),
+			},
+		},
+		{
+			name: "monitoring disabled without role",
+			raw:  `{"monitoring_interval": 0}`,
+			want: InstanceSettings{MonitoringInterval: aws.Int64(0)},
+		},
+		{
+			name:    "unknown setting",
+			raw:     `{"instance_class": "db.r6g.large"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid retention",
+			raw:     `{"performance_insights_retention_period": 30}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid monitoring interval",
+			raw:     `{"monitoring_interval": 20, "monitoring_role_arn": "arn:aws:iam::123456789012:role/rds-monitoring"}`,
+			wantErr: true,
+		},
+		{
+			name:    "monitoring without role",
+			raw:     `{"monitoring_interval": 60}`,
+			wantErr: true,
+		},
+		{
+			name:    "promotion tier out of range",
+			raw:     `{"promotion_tier": 16}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseInstanceSettings(tt.raw)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestHandler_ApplyInstanceSettings covers modifying new replicas to the desired settings after tagging.
+// Every new crew member gets the standard Planet Express uniform, whatever they showed up wearing.
+func TestHandler_ApplyInstanceSettings(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	settings := InstanceSettings{
+		PerformanceInsightsRetentionPeriod: aws.Int64(31),
+		MonitoringInterval:                 aws.Int64(60),
+		MonitoringRoleArn:                  aws.String("arn:aws:iam::123456789012:role/rds-monitoring"),
+		PromotionTier:                      aws.Int64(15),
+		CACertificateIdentifier:            aws.String("rds-ca-rsa2048-g1"),
+	}
+
+	compliant := &rds.DBInstance{
+		DBClusterIdentifier:                aws.String("planet-express"),
+		DBInstanceArn:                      aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+		DBInstanceIdentifier:               aws.String("application-autoscaling-fry"),
+		DBInstanceStatus:                   aws.String("available"),
+		PerformanceInsightsEnabled:         aws.Bool(true),
+		PerformanceInsightsRetentionPeriod: aws.Int64(31),
+		MonitoringInterval:                 aws.Int64(60),
+		PromotionTier:                      aws.Int64(15),
+		CACertificateIdentifier:            aws.String("rds-ca-rsa2048-g1"),
+	}
+
+	tests := []struct {
+		name        string
+		dryRun      bool
+		instance    func(i *rds.DBInstance)
+		creating    int
+		wantOutcome Outcome
+		wantChanged map[string]string
+		wantModify  *rds.ModifyDBInstanceInput
+	}{
+		{
+			name:        "replica has the settings already",
+			wantOutcome: OutcomeTagged,
+		},
+		{
+			name: "only differences are modified",
+			instance: func(i *rds.DBInstance) {
+				i.PromotionTier = aws.Int64(1)
+				i.PerformanceInsightsEnabled = aws.Bool(false)
+			},
+			wantOutcome: OutcomeTagged,
+			wantChanged: map[string]string{
+				"PromotionTier":                      "1 -> 15",
+				"PerformanceInsightsRetentionPeriod": "disabled -> 31",
+			},
+			wantModify: &rds.ModifyDBInstanceInput{
+				DBInstanceIdentifier:               aws.String("application-autoscaling-fry"),
+				ApplyImmediately:                   aws.Bool(true),
+				EnablePerformanceInsights:          aws.Bool(true),
+				PerformanceInsightsRetentionPeriod: aws.Int64(31),
+				PromotionTier:                      aws.Int64(15),
+			},
+		},
+		{
+			name: "monitoring is enabled with the role",
+			instance: func(i *rds.DBInstance) {
+				i.MonitoringInterval = aws.Int64(0)
+			},
+			wantOutcome: OutcomeTagged,
+			wantChanged: map[string]string{"MonitoringInterval": "0 -> 60"},
+			wantModify: &rds.ModifyDBInstanceInput{
+				DBInstanceIdentifier: aws.String("application-autoscaling-fry"),
+				ApplyImmediately:     aws.Bool(true),
+				MonitoringInterval:   aws.Int64(60),
+				MonitoringRoleArn:    aws.String("arn:aws:iam::123456789012:role/rds-monitoring"),
+			},
+		},
+		{
+			name: "dry run only reports differences",
+			instance: func(i *rds.DBInstance) {
+				i.CACertificateIdentifier = aws.String("rds-ca-2019")
+			},
+			dryRun:      true,
+			wantOutcome: OutcomeTagged,
+			wantChanged: map[string]string{"CACertificateIdentifier": "rds-ca-2019 -> rds-ca-rsa2048-g1"},
+		},
+		{
+			name: "modification waits until the replica is available",
+			instance: func(i *rds.DBInstance) {
+				i.PromotionTier = aws.Int64(1)
+			},
+			creating:    3,
+			wantOutcome: OutcomeTagged,
+			wantChanged: map[string]string{"PromotionTier": "1 -> 15"},
+			wantModify: &rds.ModifyDBInstanceInput{
+				DBInstanceIdentifier: aws.String("application-autoscaling-fry"),
+				ApplyImmediately:     aws.Bool(true),
+				PromotionTier:        aws.Int64(15),
+			},
+		},
+		{
+			name: "replica never becomes available",
+			instance: func(i *rds.DBInstance) {
+				i.PromotionTier = aws.Int64(1)
+			},
+			creating:    100,
+			wantOutcome: OutcomeFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardLogs(t)
+
+			instance := *compliant
+			if tt.instance != nil {
+				tt.instance(&instance)
+			}
+
+			var (
+				describes int
+				modified  *rds.ModifyDBInstanceInput
+			)
+
+			mock := &mockRDS{
+				describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+					describes++
+
+					current := instance
+					if describes <= tt.creating {
+						current.DBInstanceStatus = aws.String("configuring-enhanced-monitoring")
+					}
+
+					return &rds.DescribeDBInstancesOutput{DBInstances: []*rds.DBInstance{&current}}, nil
+				},
+				addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+					return &rds.AddTagsToResourceOutput{}, nil
+				},
+				modifyDBInstanceFunc: func(input *rds.ModifyDBInstanceInput) (*rds.ModifyDBInstanceOutput, error) {
+					modified = input
+					return &rds.ModifyDBInstanceOutput{}, nil
+				},
+			}
+
+			recorder := &countingRecorder{}
+			handler := NewHandler(logrus.New(), mock, &mockSTS{}, WithRecorder(recorder), WithInstanceSettings(settings, tt.dryRun))
+			handler.sleep = func(time.Duration) {}
+
+			result, err := handler.HandleRequest(context.Background(), instanceEvent("RDS-EVENT-0005", "application-autoscaling-fry"))
+			if tt.wantOutcome == OutcomeFailed {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantOutcome, result.Outcome)
+			assert.Equal(t, tt.wantChanged, result.SettingsChanged)
+			assert.Equal(t, tt.dryRun, result.SettingsDryRun)
+			assert.Equal(t, tt.wantModify, modified)
+
+			if tt.wantModify != nil {
+				assert.Equal(t, 1, recorder.counts[MetricInstanceSettingsModified])
+			}
+		})
+	}
+}
+
+// TestHandler_ApplyInstanceSettings_DeadlineNear verifies the wait for an available replica ends before the
+// invocation deadline and releases the event, so Leela's retry is not dropped as a duplicate.
+func TestHandler_ApplyInstanceSettings_DeadlineNear(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	available := false
+
+	mock := &mockRDS{
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			status := "creating"
+			if available {
+				status = "available"
+			}
+
+			return &rds.DescribeDBInstancesOutput{DBInstances: []*rds.DBInstance{{
+				DBClusterIdentifier:  aws.String("planet-express"),
+				DBInstanceArn:        aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-leela"),
+				DBInstanceIdentifier: aws.String("application-autoscaling-leela"),
+				DBInstanceStatus:     aws.String(status),
+				PromotionTier:        aws.Int64(1),
+			}}}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+		modifyDBInstanceFunc: func(input *rds.ModifyDBInstanceInput) (*rds.ModifyDBInstanceOutput, error) {
+			return &rds.ModifyDBInstanceOutput{}, nil
+		},
+	}
+
+	handler := NewHandler(logrus.New(), mock, &mockSTS{},
+		WithInstanceSettings(InstanceSettings{PromotionTier: aws.Int64(15)}, false),
+		WithIdempotencyStore(NewMemoryIdempotencyStore(time.Hour)))
+
+	now := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+	slept := time.Duration(0)
+	handler.now = func() time.Time { return now }
+	handler.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+
+	event := instanceEvent("RDS-EVENT-0005", "application-autoscaling-leela")
+
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(15*time.Second))
+	defer cancel()
+
+	result, err := handler.HandleRequest(ctx, event)
+	require.ErrorIs(t, err, ErrDeadlineNear)
+	assert.Equal(t, OutcomeFailed, result.Outcome)
+	assert.LessOrEqual(t, slept, 10*time.Second)
+
+	available = true
+
+	result, err = handler.HandleRequest(context.Background(), event)
+	require.NoError(t, err)
+	assert.Equal(t, OutcomeTagged, result.Outcome)
+	assert.Equal(t, map[string]string{"PromotionTier": "1 -> 15"}, result.SettingsChanged)
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/arn"
+)
+
+// snsEventSource is the event source of records delivered by SNS.
+const snsEventSource = "aws:sns"
+
+// snsEventTimeLayout is the UTC timestamp format of RDS notifications sent to SNS.
+const snsEventTimeLayout = "2006-01-02 15:04:05.000"
+
+// SNSNotification is an RDS event notification as published to SNS by an RDS event subscription.
+type SNSNotification struct {
+	EventSource    string `json:"Event Source"`
+	EventTime      string `json:"Event Time"`
+	IdentifierLink string `json:"Identifier Link"`
+	SourceID       string `json:"Source ID"`
+	SourceARN      string `json:"Source ARN"`
+	// EventID is a documentation URL ending with the event ID, for example ...USER_Events.html#RDS-EVENT-0005.
+	EventID      string `json:"Event ID"`
+	EventMessage string `json:"Event Message"`
+}
+
+// snsSourceTypes maps the SNS event source to the EventBridge detail-type and source type.
+var snsSourceTypes = map[string]struct {
+	detailType string
+	sourceType string
+}{
+	"db-instance": {detailType: rdsInstanceEventDetailType, sourceType: rdsSourceTypeInstance},
+	"db-cluster":  {detailType: rdsClusterEventDetailType, sourceType: rdsSourceTypeCluster},
+}
+
+// normalizeSNSRecord converts an RDS notification delivered by SNS into the EventBridge event shape,
+// so that routing, validation and tagging are shared with the EventBridge path. The account and
+// region of the event are those of the topic the notification was published to.
+func normalizeSNSRecord(record events.SNSEventRecord) (events.CloudWatchEvent, error) {
+	var notification SNSNotification
+	if err := json.Unmarshal([]byte(record.SNS.Message), &notification); err != nil {
+		return events.CloudWatchEvent{}, fmt.Errorf("failed to decode RDS notification: %w", err)
+	}
+
+	types, ok := snsSourceTypes[notification.EventSource]
+	if !ok {
+		return events.CloudWatchEvent{}, fmt.Errorf("unsupported RDS notification source %q", notification.EventSource)
+	}
+
+	topic, err := arn.Parse(record.SNS.TopicArn)
+	if err != nil {
+		return events.CloudWatchEvent{}, fmt.Errorf("malformed topic ARN %q: %w", record.SNS.TopicArn, err)
+	}
+
+	var eventTime time.Time
+
+	if notification.EventTime != "" {
+		eventTime, err = time.Parse(snsEventTimeLayout, notification.EventTime)
+		if err != nil {
+			return events.CloudWatchEvent{}, fmt.Errorf("malformed event time %q: %w", notification.EventTime, err)
+		}
+	}
+
+	eventID := notification.EventID
+	if i := strings.LastIndex(eventID, "#"); i >= 0 {
+		eventID = eventID[i+1:]
+	}
+
+	detail, err := json.Marshal(EventDetail{
+		SourceType:       types.sourceType,
+		SourceArn:        notification.SourceARN,
+		Date:             eventTime,
+		Message:          notification.EventMessage,
+		SourceIdentifier: notification.SourceID,
+		EventID:          eventID,
+	})
+	if err != nil {
+		return events.CloudWatchEvent{}, err
+	}
+
+	return events.CloudWatchEvent{
+		ID:         record.SNS.MessageID,
+		Source:     rdsEventSource,
+		DetailType: types.detailType,
+		AccountID:  topic.AccountID,
+		Region:     topic.Region,
+		Time:       eventTime,
+		Resources:  []string{notification.SourceARN},
+		Detail:     detail,
+	}, nil
+}
+
+// HandleSNS processes RDS event notifications delivered through SNS. Each notification is
+// normalized to the EventBridge event shape and routed like a direct invocation.
+func (r *Router) HandleSNS(ctx context.Context, event events.SNSEvent) ([]interface{}, error) {
+	var (
+		results []interface{}
+		errs    []error
+	)
+
+	for _, record := range event.Records {
+		normalized, err := normalizeSNSRecord(record)
+		if err != nil {
+			r.logger.WithField("message_id", record.SNS.MessageID).Printf("Error normalizing SNS notification: %v", err)
+			errs = append(errs, err)
+
+			continue
+		}
+
+		payload, err := json.Marshal(normalized)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		result, err := r.Handle(ctx, payload)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, errors.Join(errs...)
+}
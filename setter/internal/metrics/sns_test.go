@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// snsRecord wraps an RDS notification message the way SNS delivers it to Lambda.
+func snsRecord(message string) events.SNSEventRecord {
+	return events.SNSEventRecord{
+		EventSource: "aws:sns",
+		SNS: events.SNSEntity{
+			MessageID: "slurms-mckenzie",
+			TopicArn:  "arn:aws:sns:us-east-1:123456789012:rds-events",
+			Message:   message,
+		},
+	}
+}
+
+// TestNormalizeSNSRecord verifies the conversion of SNS notifications into the EventBridge shape.
+func TestNormalizeSNSRecord(t *testing.T) {
+	tests := []struct {
+		name       string
+		message    string
+		wantType   string
+		wantDetail EventDetail
+		wantErr    bool
+	}{
+		{
+			name: "instance created",
+			message: `{
+				"Event Source": "db-instance",
+				"Event Time": "3000-01-01 12:30:45.123",
+				"Identifier Link": "https://console.aws.amazon.com/rds/home?region=us-east-1#dbinstance:id=application-autoscaling-fry",
+				"Source ID": "application-autoscaling-fry",
+				"Source ARN": "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry",
+				"Event ID": "http://docs.amazonwebservices.com/AmazonRDS/latest/UserGuide/USER_Events.html#RDS-EVENT-0005",
+				"Event Message": "DB instance created"
+			}`,
+			wantType: "RDS DB Instance Event",
+			wantDetail: EventDetail{
+				SourceType:       "DB_INSTANCE",
+				SourceArn:        "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry",
+				Date:             time.Date(3000, 1, 1, 12, 30, 45, 123000000, time.UTC),
+				Message:          "DB instance created",
+				SourceIdentifier: "application-autoscaling-fry",
+				EventID:          "RDS-EVENT-0005",
+			},
+		},
+		{
+			name: "cluster event",
+			message: `{
+				"Event Source": "db-cluster",
+				"Event Time": "3000-01-01 12:30:45.123",
+				"Source ID": "planet-express",
+				"Event ID": "http://docs.amazonwebservices.com/AmazonRDS/latest/UserGuide/USER_Events.html#RDS-EVENT-0071",
+				"Event Message": "A failover for the DB cluster has completed."
+			}`,
+			wantType: "RDS DB Cluster Event",
+			wantDetail: EventDetail{
+				SourceType:       "CLUSTER",
+				Date:             time.Date(3000, 1, 1, 12, 30, 45, 123000000, time.UTC),
+				Message:          "A failover for the DB cluster has completed.",
+				SourceIdentifier: "planet-express",
+				EventID:          "RDS-EVENT-0071",
+			},
+		},
+		{
+			name:    "snapshot notification",
+			message: `{"Event Source": "db-snapshot", "Source ID": "nixon-head-jar"}`,
+			wantErr: true,
+		},
+		{
+			name:    "not an RDS notification",
+			message: `Good news, everyone!`,
+			wantErr: true,
+		},
+		{
+			name:    "malformed event time",
+			message: `{"Event Source": "db-instance", "Event Time": "the year 3000"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := normalizeSNSRecord(snsRecord(tt.message))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			assert.Equal(t, "slurms-mckenzie", event.ID)
+			assert.Equal(t, "aws.rds", event.Source)
+			assert.Equal(t, tt.wantType, event.DetailType)
+			assert.Equal(t, "123456789012", event.AccountID)
+			assert.Equal(t, "us-east-1", event.Region)
+			assert.Equal(t, tt.wantDetail.Date, event.Time)
+
+			var detail EventDetail
+			require.NoError(t, json.Unmarshal(event.Detail, &detail))
+			assert.Equal(t, tt.wantDetail, detail)
+		})
+	}
+}
+
+// TestRouter_HandleSNS checks that an SNS notification is tagged through the same path as EventBridge events.
+func TestRouter_HandleSNS(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	var taggedArn string
+
+	mock := &mockRDS{
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			return &rds.DescribeDBInstancesOutput{
+				DBInstances: []*rds.DBInstance{
+					{
+						DBClusterIdentifier: aws.String("planet-express"),
+						DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+					},
+				},
+			}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			taggedArn = aws.StringValue(input.ResourceName)
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+	}
+
+	logger := logrus.New()
+	router := NewRouter(logger)
+	NewHandler(logger, mock, &mockSTS{}, WithAllowedAccounts("123456789012")).RegisterRoutes(router)
+
+	payload, err := json.Marshal(events.SNSEvent{
+		Records: []events.SNSEventRecord{
+			snsRecord(`{
+				"Event Source": "db-instance",
+				"Event Time": "3000-01-01 12:30:45.123",
+				"Source ID": "application-autoscaling-fry",
+				"Source ARN": "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry",
+				"Event ID": "http://docs.amazonwebservices.com/AmazonRDS/latest/UserGuide/USER_Events.html#RDS-EVENT-0005",
+				"Event Message": "DB instance created"
+			}`),
+		},
+	})
+	require.NoError(t, err)
+
+	got, err := router.Handle(context.Background(), payload)
+	require.NoError(t, err)
+
+	results, ok := got.([]interface{})
+	require.True(t, ok)
+	require.Len(t, results, 1)
+
+	result, ok := results[0].(*Result)
+	require.True(t, ok)
+	assert.Equal(t, OutcomeTagged, result.Outcome)
+	assert.Equal(t, "slurms-mckenzie", result.EventID)
+	assert.Equal(t, "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry", taggedArn)
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// sqsEventSource is the event source of records in an SQS batch.
+const sqsEventSource = "aws:sqs"
+
+// HandleSQS processes EventBridge events buffered in SQS. Each message body holds one event,
+// which is routed like a direct invocation. Only the failed messages are reported back, so
+// SQS retries them and eventually moves them to the dead-letter queue.
+func (r *Router) HandleSQS(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	var response events.SQSEventResponse
+
+	for _, message := range event.Records {
+		if _, err := r.Handle(ctx, json.RawMessage(message.Body)); err != nil {
+			r.logger.WithField("message_id", message.MessageId).Printf("Error processing SQS message: %v", err)
+
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+		}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRouter_HandleSQS checks that only failed messages of a batch are reported for retry.
+// Hermes files every delivery receipt, and rejects the ones with bureaucratic errors.
+func TestRouter_HandleSQS(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	var delivered []string
+
+	router := NewRouter(logger)
+	router.Register(Route{
+		Name:   "delivery",
+		Source: "planet.express",
+		Handler: func(_ context.Context, payload json.RawMessage) (interface{}, error) {
+			var event events.CloudWatchEvent
+			if err := json.Unmarshal(payload, &event); err != nil {
+				return nil, err
+			}
+
+			if event.DetailType == "Form 27B/6 Missing" {
+				return nil, fmt.Errorf("form 27B/6 missing")
+			}
+
+			delivered = append(delivered, event.ID)
+
+			return &Result{Outcome: OutcomeTagged}, nil
+		},
+	})
+
+	batch := events.SQSEvent{
+		Records: []events.SQSMessage{
+			{MessageId: "msg-1", EventSource: "aws:sqs", Body: `{"id": "event-1", "source": "planet.express", "detail-type": "Delivery"}`},
+			{MessageId: "msg-2", EventSource: "aws:sqs", Body: `{"id": "event-2", "source": "planet.express", "detail-type": "Form 27B/6 Missing"}`},
+			{MessageId: "msg-3", EventSource: "aws:sqs", Body: `not an event`},
+			{MessageId: "msg-4", EventSource: "aws:sqs", Body: `{"id": "event-4", "source": "mom.corp", "detail-type": "Evil Plan"}`},
+			{MessageId: "msg-5", EventSource: "aws:sqs", Body: `{"id": "event-5", "source": "planet.express", "detail-type": "Delivery"}`},
+		},
+	}
+
+	want := events.SQSEventResponse{
+		BatchItemFailures: []events.SQSBatchItemFailure{
+			{ItemIdentifier: "msg-2"},
+			{ItemIdentifier: "msg-3"},
+		},
+	}
+
+	response, err := router.HandleSQS(context.Background(), batch)
+	require.NoError(t, err)
+	assert.Equal(t, want, response)
+	assert.Equal(t, []string{"event-1", "event-5"}, delivered)
+
+	// The raw batch payload is detected by Handle as well.
+	delivered = nil
+
+	payload, err := json.Marshal(batch)
+	require.NoError(t, err)
+
+	got, err := router.Handle(context.Background(), payload)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.Equal(t, []string{"event-1", "event-5"}, delivered)
+}
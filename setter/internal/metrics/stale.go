@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// StaleEventMode selects how events older than the maximum event age are handled.
+type StaleEventMode string
+
+const (
+	// StaleEventIgnore drops stale events without touching the instance.
+	StaleEventIgnore StaleEventMode = "ignore"
+	// StaleEventReconcile adds only the tags missing on the instance and keeps existing values.
+	StaleEventReconcile StaleEventMode = "reconcile"
+)
+
+// ParseStaleEventMode validates a stale event mode name.
+func ParseStaleEventMode(raw string) (StaleEventMode, error) {
+	switch mode := StaleEventMode(raw); mode {
+	case StaleEventIgnore, StaleEventReconcile:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown stale event mode %q, expected %q or %q", raw, StaleEventIgnore, StaleEventReconcile)
+	}
+}
+
+// isStale reports whether the event is older than the configured maximum age.
+// Events without a timestamp, such as direct invocations, are never stale.
+func (h *Handler) isStale(event events.CloudWatchEvent) bool {
+	if h.maxEventAge <= 0 || event.Time.IsZero() {
+		return false
+	}
+
+	return h.now().Sub(event.Time) > h.maxEventAge
+}
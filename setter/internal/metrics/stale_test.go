@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandler_HandleRequestStaleEvents covers the ignore and reconcile modes for old events.
+// Each case is a delivery that took as long as one of Fry's naps in the cryo tube.
+func TestHandler_HandleRequestStaleEvents(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth","Purpose":"delivery-company"}`)
+
+	now := time.Date(3000, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		eventTime   time.Time
+		mode        StaleEventMode
+		currentTags map[string]string
+		wantOutcome Outcome
+		wantApplied map[string]string
+		wantCalls   bool
+	}{
+		{
+			name:        "fresh event is tagged",
+			eventTime:   now.Add(-time.Minute),
+			mode:        StaleEventIgnore,
+			wantOutcome: OutcomeTagged,
+			wantApplied: map[string]string{"Owner": "professor-farnsworth", "Purpose": "delivery-company"},
+			wantCalls:   true,
+		},
+		{
+			name:        "event without time is never stale",
+			mode:        StaleEventIgnore,
+			wantOutcome: OutcomeTagged,
+			wantApplied: map[string]string{"Owner": "professor-farnsworth", "Purpose": "delivery-company"},
+			wantCalls:   true,
+		},
+		{
+			name:        "stale event is ignored",
+			eventTime:   now.AddDate(-1000, 0, 0),
+			mode:        StaleEventIgnore,
+			wantOutcome: OutcomeStale,
+		},
+		{
+			name:        "stale event fills in missing tags only",
+			eventTime:   now.Add(-2 * time.Hour),
+			mode:        StaleEventReconcile,
+			currentTags: map[string]string{"Owner": "hubert"},
+			wantOutcome: OutcomeReconciled,
+			wantApplied: map[string]string{"Purpose": "delivery-company"},
+			wantCalls:   true,
+		},
+		{
+			name:        "stale event with all tags present",
+			eventTime:   now.Add(-2 * time.Hour),
+			mode:        StaleEventReconcile,
+			currentTags: map[string]string{"Owner": "hubert", "Purpose": "doomsday-devices"},
+			wantOutcome: OutcomeUnchanged,
+			wantCalls:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+
+			var applied map[string]string
+
+			mock := &mockRDS{
+				describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+					calls++
+
+					return &rds.DescribeDBInstancesOutput{
+						DBInstances: []*rds.DBInstance{
+							{
+								DBClusterIdentifier: aws.String("planet-express"),
+								DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+							},
+						},
+					}, nil
+				},
+				listTagsForResourceFunc: func(input *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+					return &rds.ListTagsForResourceOutput{TagList: rdsTags(tt.currentTags)}, nil
+				},
+				addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+					applied = make(map[string]string)
+					for _, tag := range input.Tags {
+						applied[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+					}
+
+					return &rds.AddTagsToResourceOutput{}, nil
+				},
+			}
+			stsMock := &mockSTS{
+				getCallerIdentityFunc: func(input *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+					return &sts.GetCallerIdentityOutput{Account: aws.String("123456789012")}, nil
+				},
+			}
+
+			discardLogs(t)
+
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+
+			handler := NewHandler(logger, mock, stsMock, WithMaxEventAge(time.Hour, tt.mode))
+			handler.now = func() time.Time { return now }
+
+			result, err := handler.HandleRequest(context.Background(), events.CloudWatchEvent{
+				Source:     "aws.rds",
+				DetailType: "RDS DB Instance Event",
+				Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-fry"}`),
+				Region:     "us-east-1",
+				Time:       tt.eventTime,
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantOutcome, result.Outcome)
+			assert.Equal(t, tt.wantApplied, applied)
+			assert.Equal(t, tt.wantApplied, result.TagsApplied)
+			assert.Equal(t, tt.wantCalls, calls > 0, "AWS should only be called for events that are processed")
+
+			// The tags read on the reconcile path are reported, and are the tags after when nothing is written.
+			if tt.wantOutcome == OutcomeReconciled || tt.wantOutcome == OutcomeUnchanged {
+				assert.Equal(t, tt.currentTags, result.TagsBefore)
+			}
+
+			if tt.wantOutcome == OutcomeUnchanged {
+				assert.Equal(t, tt.currentTags, result.TagsAfter)
+			}
+		})
+	}
+}
+
+// TestParseStaleEventMode verifies the accepted stale event mode names.
+func TestParseStaleEventMode(t *testing.T) {
+	mode, err := ParseStaleEventMode("reconcile")
+	require.NoError(t, err)
+	assert.Equal(t, StaleEventReconcile, mode)
+
+	_, err = ParseStaleEventMode("freeze")
+	assert.Error(t, err)
+}
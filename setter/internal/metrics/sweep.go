@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// ErrUnknownCluster is returned when a cluster other than the configured one is requested.
+var ErrUnknownCluster = errors.New("cluster is not managed by this function")
+
+// SweepResult summarizes a reconcile run over all autoscaled replicas of a cluster.
+type SweepResult struct {
+	ClusterIdentifier string    `json:"cluster_identifier"`
+	Results           []*Result `json:"results"`
+	Tagged            int       `json:"tagged"`
+	Unchanged         int       `json:"unchanged"`
+	Failed            int       `json:"failed"`
+	// OutOfPolicy lists the replicas whose promotion tier differed from the enforced one.
+	OutOfPolicy []string `json:"out_of_policy,omitempty"`
+	// ScalableTarget is the decision for the scalable target of the cluster when its tagging is enabled.
+	ScalableTarget *ScalableTargetResult `json:"scalable_target,omitempty"`
+}
+
+// listClusterInstances returns all DB instances that are members of the cluster.
+func (h *Handler) listClusterInstances(clusterID string) ([]*rds.DBInstance, error) {
+	input := &rds.DescribeDBInstancesInput{
+		Filters: []*rds.Filter{
+			{
+				Name:   aws.String("db-cluster-id"),
+				Values: []*string{aws.String(clusterID)},
+			},
+		},
+	}
+
+	var instances []*rds.DBInstance
+
+	for {
+		output, err := h.rds.DescribeDBInstances(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe DB instances of cluster %s: %w", clusterID, err)
+		}
+
+		instances = append(instances, output.DBInstances...)
+
+		if aws.StringValue(output.Marker) == "" {
+			return instances, nil
+		}
+
+		input.Marker = output.Marker
+	}
+}
+
+// Sweep reconciles tags on every autoscaled replica of the cluster, writing only tags that
+// are missing or have a different value, and enforces the promotion tier when configured.
+// The scalable target of the cluster is tagged the same way when enabled. Only the configured
+// cluster can be swept.
+func (h *Handler) Sweep(ctx context.Context, clusterID string) (*SweepResult, error) {
+	sweep, err := h.sweepLocked(ctx, clusterID)
+	if sweep != nil {
+		h.observe(ctx, sweep.Results...)
+	}
+
+	return sweep, err
+}
+
+// sweepLocked runs the sweep while holding h.mu and writes the audit records of its results.
+func (h *Handler) sweepLocked(ctx context.Context, clusterID string) (*SweepResult, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.logger = loggerFromContext(ctx)
+	h.requestID = requestIDFromContext(ctx)
+	h.deadline, _ = ctx.Deadline()
+
+	expectedClusterID, tagsMap, err := h.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if clusterID == "" {
+		clusterID = expectedClusterID
+	}
+
+	if clusterID != expectedClusterID {
+		return nil, fmt.Errorf("%w: %s, expected %s", ErrUnknownCluster, clusterID, expectedClusterID)
+	}
+
+	instances, err := h.listClusterInstances(clusterID)
+	if err != nil {
+		h.logger.Printf("Error listing instances of cluster %s: %v", clusterID, err)
+		return nil, err
+	}
+
+	sweep := &SweepResult{ClusterIdentifier: clusterID}
+
+	var errs []error
+
+	for _, instance := range instances {
+		dbInstanceID := aws.StringValue(instance.DBInstanceIdentifier)
+		if !isAutoscaledReplica(dbInstanceID) {
+			continue
+		}
+
+		result := &Result{
+			DBInstanceIdentifier: dbInstanceID,
+			DBInstanceArn:        aws.StringValue(instance.DBInstanceArn),
+			ClusterIdentifier:    clusterID,
+			Outcome:              OutcomeUnchanged,
+		}
+		sweep.Results = append(sweep.Results, result)
+
+		var tagErr error
+
+		changes := changedTags(tagsMap, tagListToMap(instance.TagList))
+		if len(changes) > 0 {
+			tagErr = h.applyTags(dbInstanceID, result.DBInstanceArn, changes, result)
+			if tagErr == nil {
+				result.Outcome = OutcomeTagged
+			}
+		}
+
+		// The tier is checked even when tagging failed, a replica at the wrong tier is reported and moved regardless.
+		outOfPolicy, tierErr := h.enforcePromotionTier(instance, result)
+		if outOfPolicy {
+			sweep.OutOfPolicy = append(sweep.OutOfPolicy, dbInstanceID)
+		}
+
+		switch err := errors.Join(tagErr, tierErr); {
+		case err != nil:
+			result.Outcome = OutcomeFailed
+			result.Error = err.Error()
+			sweep.Failed++
+			errs = append(errs, err)
+		case result.Outcome == OutcomeTagged:
+			sweep.Tagged++
+		default:
+			sweep.Unchanged++
+		}
+	}
+
+	if h.autoscaling != nil {
+		target, err := h.tagScalableTarget(clusterID, tagsMap)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		sweep.ScalableTarget = target
+	}
+
+	h.audit(sweep.Results...)
+	h.logger.Printf("Swept cluster %s: %d tagged, %d unchanged, %d failed, %d out of policy",
+		clusterID, sweep.Tagged, sweep.Unchanged, sweep.Failed, len(sweep.OutOfPolicy))
+
+	return sweep, errors.Join(errs...)
+}
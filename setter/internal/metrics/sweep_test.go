@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandler_Sweep reconciles a cluster whose members are spread over two result pages.
+func TestHandler_Sweep(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth","Purpose":"delivery-company"}`)
+
+	instance := func(id string, tags map[string]string) *rds.DBInstance {
+		return &rds.DBInstance{
+			DBInstanceIdentifier: aws.String(id),
+			DBInstanceArn:        aws.String("arn:aws:rds:us-east-1:123456789012:db:" + id),
+			DBClusterIdentifier:  aws.String("planet-express"),
+			TagList:              rdsTags(tags),
+		}
+	}
+
+	tagged := make(map[string]map[string]string)
+
+	mock := &mockRDS{
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			require.Len(t, input.Filters, 1)
+			assert.Equal(t, "db-cluster-id", aws.StringValue(input.Filters[0].Name))
+
+			if aws.StringValue(input.Marker) == "" {
+				return &rds.DescribeDBInstancesOutput{
+					DBInstances: []*rds.DBInstance{
+						// The provisioned writer is never touched.
+						instance("planet-express-writer", nil),
+						instance("application-autoscaling-fry", map[string]string{"Owner": "professor-farnsworth", "Purpose": "delivery-company"}),
+					},
+					Marker: aws.String("page-2"),
+				}, nil
+			}
+
+			return &rds.DescribeDBInstancesOutput{
+				DBInstances: []*rds.DBInstance{
+					instance("application-autoscaling-bender", map[string]string{"Owner": "bender"}),
+					instance("application-autoscaling-nibbler", nil),
+				},
+			}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			arn := aws.StringValue(input.ResourceName)
+			if arn == "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-nibbler" {
+				return nil, fmt.Errorf("nibbler ate the tags")
+			}
+
+			tagged[arn] = make(map[string]string)
+			for _, tag := range input.Tags {
+				tagged[arn][aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+	}
+
+	handler := NewHandler(logrus.New(), mock, &mockSTS{})
+
+	sweep, err := handler.Sweep(context.Background(), "")
+	assert.Error(t, err, "failed replicas should fail the sweep")
+
+	assert.Equal(t, "planet-express", sweep.ClusterIdentifier)
+	assert.Equal(t, 1, sweep.Tagged)
+	assert.Equal(t, 1, sweep.Unchanged)
+	assert.Equal(t, 1, sweep.Failed)
+	assert.Len(t, sweep.Results, 3)
+	assert.Equal(t, map[string]map[string]string{
+		"arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-bender": {
+			"Owner":   "professor-farnsworth",
+			"Purpose": "delivery-company",
+		},
+	}, tagged)
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrEventRejected is returned for events that do not come from RDS in an allowed account and region.
+var ErrEventRejected = errors.New("event rejected")
+
+// Values expected on RDS instance events delivered by EventBridge.
+const (
+	rdsEventSource             = "aws.rds"
+	rdsInstanceEventDetailType = "RDS DB Instance Event"
+	rdsEventInstanceCreated    = "RDS-EVENT-0005"
+	rdsEventInstanceDeleted    = "RDS-EVENT-0003"
+	rdsSourceTypeInstance      = "DB_INSTANCE"
+)
+
+// validateEvent checks that the event really is an RDS instance event with the given event ID from an
+// allowed account and region. The function can be invoked directly, so nothing in the payload is trusted.
+func (h *Handler) validateEvent(event events.CloudWatchEvent, detail EventDetail, eventID string) error {
+	var reason string
+
+	switch {
+	case event.Source != rdsEventSource:
+		reason = fmt.Sprintf("unexpected source %q", event.Source)
+	case event.DetailType != rdsInstanceEventDetailType:
+		reason = fmt.Sprintf("unexpected detail-type %q", event.DetailType)
+	case detail.EventID != eventID:
+		reason = fmt.Sprintf("unexpected event ID %q", detail.EventID)
+	case detail.SourceType != rdsSourceTypeInstance:
+		reason = fmt.Sprintf("unexpected source type %q", detail.SourceType)
+	default:
+		reason = h.originMismatch(event)
+		if reason == "" {
+			reason = h.sourceArnMismatch(event, detail)
+		}
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	return h.rejectEvent(event, reason)
+}
+
+// clusterEventMismatch explains why the event is not an RDS cluster event from an allowed account and region,
+// it returns an empty string when it is.
+func (h *Handler) clusterEventMismatch(event events.CloudWatchEvent, detail EventDetail) string {
+	switch {
+	case event.Source != rdsEventSource:
+		return fmt.Sprintf("unexpected source %q", event.Source)
+	case event.DetailType != rdsClusterEventDetailType:
+		return fmt.Sprintf("unexpected detail-type %q", event.DetailType)
+	case detail.SourceType != rdsSourceTypeCluster:
+		return fmt.Sprintf("unexpected source type %q", detail.SourceType)
+	default:
+		return h.originMismatch(event)
+	}
+}
+
+// originMismatch explains why the account or region of the event is not allowed,
+// it returns an empty string when both are allowed.
+func (h *Handler) originMismatch(event events.CloudWatchEvent) string {
+	switch {
+	case len(h.allowedAccounts) > 0 && !h.allowedAccounts[event.AccountID]:
+		return fmt.Sprintf("account %q is not allowed", event.AccountID)
+	case len(h.allowedRegions) > 0 && !h.allowedRegions[event.Region]:
+		return fmt.Sprintf("region %q is not allowed", event.Region)
+	default:
+		return ""
+	}
+}
+
+// rejectEvent records a rejected event with a security log entry and a metric.
+func (h *Handler) rejectEvent(event events.CloudWatchEvent, reason string) error {
+	h.recorder.Inc(MetricEventRejected)
+	h.logger.WithFields(logrus.Fields{
+		"security":    true,
+		"event_id":    event.ID,
+		"source":      event.Source,
+		"detail_type": event.DetailType,
+		"account":     event.AccountID,
+		"region":      event.Region,
+	}).Warnf("Rejected event: %s", reason)
+
+	return fmt.Errorf("%w: %s", ErrEventRejected, reason)
+}
+
+// sourceArnMismatch explains why the SourceArn cannot be used as the tagging target,
+// it returns an empty string when the ARN is absent or matches the rest of the event.
+func (h *Handler) sourceArnMismatch(event events.CloudWatchEvent, detail EventDetail) string {
+	if detail.SourceArn == "" {
+		return ""
+	}
+
+	return resourceArnMismatch(event, detail.SourceArn, "db:"+detail.SourceIdentifier)
+}
+
+// resourceArnMismatch explains why an ARN taken from the payload is not the RDS resource in the account and
+// region of the event, it returns an empty string when it is.
+func resourceArnMismatch(event events.CloudWatchEvent, resourceArn, resource string) string {
+	parsed, err := arn.Parse(resourceArn)
+	if err != nil {
+		return fmt.Sprintf("malformed ARN %q", resourceArn)
+	}
+
+	if parsed.Service != "rds" || parsed.Resource != resource {
+		return fmt.Sprintf("ARN %q does not match %q", resourceArn, resource)
+	}
+
+	if parsed.AccountID != event.AccountID || parsed.Region != event.Region {
+		return fmt.Sprintf("ARN %q does not match event account %q and region %q", resourceArn, event.AccountID, event.Region)
+	}
+
+	return ""
+}
+
+// stringSet turns a list of values into a set, empty values are dropped.
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+
+	for _, v := range values {
+		if v != "" {
+			set[v] = true
+		}
+	}
+
+	return set
+}
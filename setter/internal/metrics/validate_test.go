@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandler_HandleRequestValidation checks that forged or foreign events are rejected before any AWS call.
+// The Robot Devil tries every trick to get his tags onto Planet Express replicas.
+func TestHandler_HandleRequestValidation(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	validEvent := func() events.CloudWatchEvent {
+		return events.CloudWatchEvent{
+			ID:         "robot-hell",
+			Source:     "aws.rds",
+			DetailType: "RDS DB Instance Event",
+			AccountID:  "123456789012",
+			Region:     "us-east-1",
+			Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-fry"}`),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*events.CloudWatchEvent)
+	}{
+		{
+			name: "direct invocation without source",
+			mutate: func(e *events.CloudWatchEvent) {
+				e.Source = ""
+			},
+		},
+		{
+			name: "custom event source",
+			mutate: func(e *events.CloudWatchEvent) {
+				e.Source = "robot.devil"
+			},
+		},
+		{
+			name: "cluster event detail-type",
+			mutate: func(e *events.CloudWatchEvent) {
+				e.DetailType = "RDS DB Cluster Event"
+			},
+		},
+		{
+			name: "instance deleted event ID",
+			mutate: func(e *events.CloudWatchEvent) {
+				e.Detail = []byte(`{"EventID": "RDS-EVENT-0003", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-fry"}`)
+			},
+		},
+		{
+			name: "cluster source type",
+			mutate: func(e *events.CloudWatchEvent) {
+				e.Detail = []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "CLUSTER", "SourceIdentifier": "application-autoscaling-fry"}`)
+			},
+		},
+		{
+			name: "source ARN of another instance",
+			mutate: func(e *events.CloudWatchEvent) {
+				e.Detail = []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-fry",
+					"SourceArn": "arn:aws:rds:us-east-1:123456789012:db:provisioned-writer"}`)
+			},
+		},
+		{
+			name: "source ARN from another account",
+			mutate: func(e *events.CloudWatchEvent) {
+				e.Detail = []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-fry",
+					"SourceArn": "arn:aws:rds:us-east-1:666666666666:db:application-autoscaling-fry"}`)
+			},
+		},
+		{
+			name: "malformed source ARN",
+			mutate: func(e *events.CloudWatchEvent) {
+				e.Detail = []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-fry",
+					"SourceArn": "fry"}`)
+			},
+		},
+		{
+			name: "foreign account",
+			mutate: func(e *events.CloudWatchEvent) {
+				e.AccountID = "666666666666"
+			},
+		},
+		{
+			name: "foreign region",
+			mutate: func(e *events.CloudWatchEvent) {
+				e.Region = "eu-hell-1"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logBuf bytes.Buffer
+
+			logrus.SetOutput(&logBuf)
+			defer logrus.SetOutput(os.Stdout)
+
+			recorder := &countingRecorder{}
+
+			// Unconfigured mocks fail the test if the handler reaches AWS.
+			handler := NewHandler(logrus.New(), &mockRDS{}, &mockSTS{},
+				WithRecorder(recorder),
+				WithAllowedAccounts("123456789012"),
+				WithAllowedRegions("us-east-1", "us-west-2"),
+			)
+
+			event := validEvent()
+			tt.mutate(&event)
+
+			result, err := handler.HandleRequest(context.Background(), event)
+
+			assert.ErrorIs(t, err, ErrEventRejected)
+			assert.Equal(t, OutcomeRejected, result.Outcome)
+			assert.Equal(t, 1, recorder.counts[MetricEventRejected])
+			assert.Contains(t, logBuf.String(), "security=true")
+		})
+	}
+}
+
+// TestHandler_HandleRequestSourceArn checks that the event's SourceArn is tagged without asking STS for the account.
+func TestHandler_HandleRequestSourceArn(t *testing.T) {
+	discardLogs(t)
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	var taggedArn string
+
+	mock := &mockRDS{
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			return &rds.DescribeDBInstancesOutput{
+				DBInstances: []*rds.DBInstance{
+					{
+						DBClusterIdentifier: aws.String("planet-express"),
+						DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry"),
+					},
+				},
+			}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			taggedArn = aws.StringValue(input.ResourceName)
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+	}
+
+	// The unconfigured STS mock fails the invocation if the account is looked up.
+	handler := NewHandler(logrus.New(), mock, &mockSTS{})
+
+	result, err := handler.HandleRequest(context.Background(), events.CloudWatchEvent{
+		ID:         "good-news-everyone",
+		Source:     "aws.rds",
+		DetailType: "RDS DB Instance Event",
+		AccountID:  "123456789012",
+		Region:     "us-east-1",
+		Detail: []byte(`{
+			"EventCategories": ["creation"],
+			"SourceType": "DB_INSTANCE",
+			"SourceArn": "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry",
+			"Date": "3000-01-01T00:00:00.000Z",
+			"Message": "DB instance created",
+			"SourceIdentifier": "application-autoscaling-fry",
+			"EventID": "RDS-EVENT-0005"
+		}`),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-fry", taggedArn)
+	assert.Equal(t, OutcomeTagged, result.Outcome)
+	assert.Equal(t, "RDS-EVENT-0005", result.RDSEventID)
+	assert.Equal(t, "DB instance created", result.Message)
+	assert.Equal(t, taggedArn, result.DBInstanceArn)
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// ErrTagVerificationFailed is returned when applied tags do not read back with the expected values.
+var ErrTagVerificationFailed = errors.New("tag verification failed")
+
+// listTags reads the current tags of an RDS resource into a map.
+func (h *Handler) listTags(arn string) (map[string]string, error) {
+	output, err := h.rds.ListTagsForResource(&rds.ListTagsForResourceInput{
+		ResourceName: aws.String(arn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags for %s: %w", arn, err)
+	}
+
+	return tagListToMap(output.TagList), nil
+}
+
+// tagMismatches lists the expected keys whose actual value is missing or different, sorted by key.
+func tagMismatches(expected, actual map[string]string) []string {
+	var mismatches []string
+
+	for k, want := range expected {
+		got, ok := actual[k]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("%s: missing", k))
+			continue
+		}
+
+		if got != want {
+			mismatches = append(mismatches, fmt.Sprintf("%s: got %q, want %q", k, got, want))
+		}
+	}
+
+	sort.Strings(mismatches)
+
+	return mismatches
+}
+
+// verifyTags reads tags back from the resource until every expected key has the expected value and returns the
+// tags read last. Reads are retried to ride out eventual consistency of the tagging API.
+func (h *Handler) verifyTags(arn string, expected map[string]string) (map[string]string, error) {
+	var (
+		actual     map[string]string
+		lastErr    error
+		mismatches []string
+	)
+
+	for attempt := 1; attempt <= h.verifyAttempts; attempt++ {
+		if attempt > 1 {
+			if err := h.wait(h.verifyDelay); err != nil {
+				return actual, err
+			}
+		}
+
+		read, err := h.listTags(arn)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		actual, lastErr = read, nil
+
+		mismatches = tagMismatches(expected, actual)
+		if len(mismatches) == 0 {
+			return actual, nil
+		}
+
+		h.logger.Printf("Tags on %s not yet consistent (attempt %d/%d): %s",
+			arn, attempt, h.verifyAttempts, strings.Join(mismatches, ", "))
+	}
+
+	if lastErr != nil {
+		return actual, lastErr
+	}
+
+	h.recorder.Inc(MetricTagVerificationMismatch)
+
+	return actual, fmt.Errorf("%w for %s: %s", ErrTagVerificationFailed, arn, strings.Join(mismatches, ", "))
+}
+
+// observeTagsAfter reads the tags of the resource after a write for the audit trail. A failed read leaves them
+// out of the record rather than failing the write that already happened.
+func (h *Handler) observeTagsAfter(dbInstanceID, arn string, result *Result) {
+	if h.auditSink == nil {
+		return
+	}
+
+	after, err := h.listTags(arn)
+	if err != nil {
+		h.logger.Printf("Error reading tags of DB instance %s after writing them: %v", dbInstanceID, err)
+		return
+	}
+
+	result.TagsAfter = after
+}
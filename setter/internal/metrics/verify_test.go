@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingRecorder keeps metric counts in memory for assertions.
+type countingRecorder struct {
+	counts map[string]int
+}
+
+// Inc increments the in-memory counter for name.
+func (r *countingRecorder) Inc(name string) {
+	if r.counts == nil {
+		r.counts = make(map[string]int)
+	}
+
+	r.counts[name]++
+}
+
+// rdsTags converts a map into the RDS tag list shape.
+func rdsTags(tags map[string]string) []*rds.Tag {
+	list := make([]*rds.Tag, 0, len(tags))
+	for k, v := range tags {
+		list = append(list, &rds.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+
+	return list
+}
+
+// TestHandler_verifyTags covers read-after-write verification of applied tags.
+func TestHandler_verifyTags(t *testing.T) {
+	expected := map[string]string{
+		"Owner":   "professor-farnsworth",
+		"Purpose": "delivery-company",
+	}
+
+	tests := []struct {
+		name string
+		// responses are returned by ListTagsForResource in order, the last one repeats.
+		responses []map[string]string
+		// listErr is returned by every ListTagsForResource call when set.
+		listErr      error
+		attempts     int
+		wantErr      error
+		wantAnyErr   bool
+		wantCalls    int
+		wantMismatch int
+	}{
+		{
+			name:      "tags visible on first read",
+			responses: []map[string]string{expected},
+			attempts:  3,
+			wantCalls: 1,
+		},
+		{
+			name: "tags become visible after a retry",
+			responses: []map[string]string{
+				{},
+				{"Owner": "professor-farnsworth"},
+				expected,
+			},
+			attempts:  5,
+			wantCalls: 3,
+		},
+		{
+			name: "value never converges",
+			responses: []map[string]string{
+				{"Owner": "mom", "Purpose": "delivery-company"},
+			},
+			attempts:     3,
+			wantErr:      ErrTagVerificationFailed,
+			wantCalls:    3,
+			wantMismatch: 1,
+		},
+		{
+			name:       "list tags keeps failing",
+			listErr:    fmt.Errorf("slurm shortage"),
+			attempts:   2,
+			wantAnyErr: true,
+			wantCalls:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			mock := &mockRDS{
+				listTagsForResourceFunc: func(input *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+					calls++
+
+					assert.Equal(t, "arn:aws:rds:us-east-1:123456789012:db:fry", aws.StringValue(input.ResourceName))
+
+					if tt.listErr != nil {
+						return nil, tt.listErr
+					}
+
+					idx := calls - 1
+					if idx >= len(tt.responses) {
+						idx = len(tt.responses) - 1
+					}
+
+					return &rds.ListTagsForResourceOutput{TagList: rdsTags(tt.responses[idx])}, nil
+				},
+			}
+
+			recorder := &countingRecorder{}
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+
+			handler := NewHandler(logger, mock, &mockSTS{},
+				WithRecorder(recorder),
+				WithTagVerification(tt.attempts, time.Millisecond),
+			)
+			handler.sleep = func(time.Duration) {}
+
+			_, err := handler.verifyTags("arn:aws:rds:us-east-1:123456789012:db:fry", expected)
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantAnyErr:
+				assert.Error(t, err)
+				assert.NotErrorIs(t, err, ErrTagVerificationFailed)
+			default:
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantCalls, calls)
+			assert.Equal(t, tt.wantMismatch, recorder.counts[MetricTagVerificationMismatch])
+		})
+	}
+}
+
+// TestHandler_HandleRequestVerification checks that a verification mismatch fails the invocation.
+func TestHandler_HandleRequestVerification(t *testing.T) {
+	t.Setenv("RDS_CLUSTER_IDENTIFIER", "planet-express")
+	t.Setenv("TAGS", `{"Owner":"professor-farnsworth"}`)
+
+	mock := &mockRDS{
+		describeDBInstancesFunc: func(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+			return &rds.DescribeDBInstancesOutput{
+				DBInstances: []*rds.DBInstance{
+					{
+						DBClusterIdentifier: aws.String("planet-express"),
+						DBInstanceArn:       aws.String("arn:aws:rds:us-east-1:123456789012:db:application-autoscaling-kif"),
+					},
+				},
+			}, nil
+		},
+		addTagsToResourceFunc: func(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+			return &rds.AddTagsToResourceOutput{}, nil
+		},
+		listTagsForResourceFunc: func(input *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+			// Zapp Brannigan's fleet swallowed the tags.
+			return &rds.ListTagsForResourceOutput{}, nil
+		},
+	}
+	stsMock := &mockSTS{
+		getCallerIdentityFunc: func(input *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+			return &sts.GetCallerIdentityOutput{Account: aws.String("123456789012")}, nil
+		},
+	}
+
+	recorder := &countingRecorder{}
+	discardLogs(t)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	handler := NewHandler(logger, mock, stsMock, WithRecorder(recorder), WithTagVerification(2, 0))
+	handler.sleep = func(time.Duration) {}
+
+	_, err := handler.HandleRequest(context.Background(), events.CloudWatchEvent{
+		Source:     "aws.rds",
+		DetailType: "RDS DB Instance Event",
+		Detail:     []byte(`{"EventID": "RDS-EVENT-0005", "SourceType": "DB_INSTANCE", "SourceIdentifier": "application-autoscaling-kif"}`),
+		Region:     "us-east-1",
+	})
+
+	assert.True(t, errors.Is(err, ErrTagVerificationFailed))
+	assert.Equal(t, 1, recorder.counts[MetricTagVerificationMismatch])
+}
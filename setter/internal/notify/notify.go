@@ -0,0 +1,266 @@
+// Package notify posts handler results to webhooks such as Slack or PagerDuty.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"counter/internal/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultTimeout bounds a single delivery attempt.
+	DefaultTimeout = 5 * time.Second
+	// DefaultRetries is the number of attempts after the first failed one.
+	DefaultRetries = 2
+	// retryDelay is the wait before the first retry, it doubles with every further retry.
+	retryDelay = 500 * time.Millisecond
+)
+
+// knownOutcomes are the outcomes a webhook may filter on.
+var knownOutcomes = map[metrics.Outcome]bool{
+	metrics.OutcomeTagged:     true,
+	metrics.OutcomeSkipped:    true,
+	metrics.OutcomeDuplicate:  true,
+	metrics.OutcomeFailed:     true,
+	metrics.OutcomeStale:      true,
+	metrics.OutcomeReconciled: true,
+	metrics.OutcomeUnchanged:  true,
+	metrics.OutcomeRejected:   true,
+	metrics.OutcomeIgnored:    true,
+	metrics.OutcomeRestored:   true,
+	metrics.OutcomePropagated: true,
+	metrics.OutcomeRemoved:    true,
+}
+
+// Webhook is a URL results are posted to.
+type Webhook struct {
+	URL string `json:"url"`
+	// Outcomes are the outcomes posted to the webhook, all outcomes are posted when empty.
+	Outcomes []metrics.Outcome `json:"outcomes,omitempty"`
+	// Preset is the payload format, PresetJSON when empty. It is ignored when Template is set.
+	Preset Preset `json:"preset,omitempty"`
+	// Template is a text/template rendering the JSON payload from the result, see Payload.
+	Template string `json:"template,omitempty"`
+}
+
+// ParseWebhooks decodes and validates a JSON list of webhooks.
+func ParseWebhooks(raw string) ([]Webhook, error) {
+	var webhooks []Webhook
+
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&webhooks); err != nil {
+		return nil, fmt.Errorf("invalid webhooks: %w", err)
+	}
+
+	for i, webhook := range webhooks {
+		if !strings.HasPrefix(webhook.URL, "https://") && !strings.HasPrefix(webhook.URL, "http://") {
+			return nil, fmt.Errorf("webhook %d: url must be an http or https URL", i)
+		}
+
+		for _, outcome := range webhook.Outcomes {
+			if !knownOutcomes[outcome] {
+				return nil, fmt.Errorf("webhook %d: unknown outcome %q", i, outcome)
+			}
+		}
+
+		if _, err := newRenderer(webhook); err != nil {
+			return nil, fmt.Errorf("webhook %d: %w", i, err)
+		}
+	}
+
+	return webhooks, nil
+}
+
+// target is a webhook with its outcome filter and payload renderer.
+type target struct {
+	url      string
+	outcomes map[metrics.Outcome]bool
+	render   renderer
+}
+
+// Notifier posts results to webhooks, retrying failed deliveries. It is a metrics.Observer.
+// Deliveries end with the context passed to Observe, so a slow webhook cannot run past the invocation deadline.
+type Notifier struct {
+	logger  logrus.FieldLogger
+	client  *http.Client
+	targets []target
+	retries int
+	sleep   func(time.Duration)
+	now     func() time.Time
+}
+
+// NewNotifier creates a Notifier for webhooks. Each attempt may take up to timeout, failed deliveries are
+// attempted retries more times.
+func NewNotifier(logger logrus.FieldLogger, webhooks []Webhook, timeout time.Duration, retries int) (*Notifier, error) {
+	n := &Notifier{
+		logger:  logger,
+		client:  &http.Client{Timeout: timeout},
+		retries: retries,
+		sleep:   time.Sleep,
+		now:     time.Now,
+	}
+
+	for i, webhook := range webhooks {
+		render, err := newRenderer(webhook)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %d: %w", i, err)
+		}
+
+		outcomes := make(map[metrics.Outcome]bool, len(webhook.Outcomes))
+		for _, outcome := range webhook.Outcomes {
+			outcomes[outcome] = true
+		}
+
+		n.targets = append(n.targets, target{url: webhook.URL, outcomes: outcomes, render: render})
+	}
+
+	return n, nil
+}
+
+// FromEnv creates a Notifier for the webhooks in WEBHOOKS, with WEBHOOK_TIMEOUT and WEBHOOK_RETRIES.
+// It returns nil when no webhooks are configured.
+func FromEnv(logger logrus.FieldLogger) (*Notifier, error) {
+	raw := os.Getenv("WEBHOOKS")
+	if raw == "" {
+		return nil, nil
+	}
+
+	webhooks, err := ParseWebhooks(raw)
+	if err != nil {
+		return nil, fmt.Errorf("WEBHOOKS: %w", err)
+	}
+
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+
+	timeout := DefaultTimeout
+
+	if rawTimeout := os.Getenv("WEBHOOK_TIMEOUT"); rawTimeout != "" {
+		timeout, err = time.ParseDuration(rawTimeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("WEBHOOK_TIMEOUT must be a positive duration, got %q", rawTimeout)
+		}
+	}
+
+	retries := DefaultRetries
+
+	if rawRetries := os.Getenv("WEBHOOK_RETRIES"); rawRetries != "" {
+		retries, err = strconv.Atoi(rawRetries)
+		if err != nil || retries < 0 {
+			return nil, fmt.Errorf("WEBHOOK_RETRIES must be a non-negative integer, got %q", rawRetries)
+		}
+	}
+
+	return NewNotifier(logger, webhooks, timeout, retries)
+}
+
+// Observe posts the result to every webhook whose filter matches its outcome. Delivery failures are logged,
+// deliveries still running when ctx is done are given up on.
+func (n *Notifier) Observe(ctx context.Context, result *metrics.Result) {
+	for _, t := range n.targets {
+		if len(t.outcomes) > 0 && !t.outcomes[result.Outcome] {
+			continue
+		}
+
+		payload, err := t.render(result)
+		if err != nil {
+			n.logger.Printf("Error rendering webhook payload for %s: %v", redact(t.url), err)
+			continue
+		}
+
+		if err := n.deliver(ctx, t.url, payload); err != nil {
+			n.logger.Printf("Error notifying webhook %s of %s outcome: %v", redact(t.url), result.Outcome, err)
+		}
+	}
+}
+
+// deliver posts payload to webhookURL, retrying on connection errors, throttling and server errors. It stops
+// retrying when ctx is done or would be before the next attempt.
+func (n *Notifier) deliver(ctx context.Context, webhookURL string, payload []byte) error {
+	delay := retryDelay
+
+	var err error
+
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			deadline, ok := ctx.Deadline()
+			if ctx.Err() != nil || ok && n.now().Add(delay).After(deadline) {
+				return fmt.Errorf("giving up after %d attempts, the invocation deadline is near: %w", attempt, err)
+			}
+
+			n.sleep(delay)
+			delay *= 2
+		}
+
+		var retry bool
+
+		retry, err = n.post(ctx, webhookURL, payload)
+		if err == nil || !retry {
+			return err
+		}
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", n.retries+1, err)
+}
+
+// post sends a single request and reports whether a failure is worth retrying.
+func (n *Notifier) post(ctx context.Context, webhookURL string, payload []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return false, errors.New("invalid webhook request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// The URL may hold a secret token, the error repeats it.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+
+		return true, err
+	}
+
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	default:
+		return false, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+}
+
+// redact drops the path of webhookURL, webhook URLs of Slack and others carry their secret there.
+func redact(webhookURL string) string {
+	scheme, rest, ok := strings.Cut(webhookURL, "://")
+	if !ok {
+		return "webhook"
+	}
+
+	host, _, _ := strings.Cut(rest, "/")
+
+	return scheme + "://" + host + "/..."
+}
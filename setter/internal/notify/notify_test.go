@@ -0,0 +1,427 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"counter/internal/metrics"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseWebhooks checks decoding and validation of the webhook list.
+func TestParseWebhooks(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []Webhook
+		wantErr bool
+	}{
+		{
+			name: "slack for failures and json for everything",
+			raw: `[{"url": "https://hooks.slack.com/services/T0/B0/nibbler", "outcomes": ["failed"], "preset": "slack"},
+				{"url": "https://inventory.planetexpress.earth/hooks/replicas"}]`,
+			want: []Webhook{
+				{URL: "https://hooks.slack.com/services/T0/B0/nibbler", Outcomes: []metrics.Outcome{metrics.OutcomeFailed}, Preset: PresetSlack},
+				{URL: "https://inventory.planetexpress.earth/hooks/replicas"},
+			},
+		},
+		{
+			name: "custom template",
+			raw:  `[{"url": "https://events.pagerduty.com/v2/enqueue", "template": "{\"summary\": {{json .DBInstanceIdentifier}}}"}]`,
+			want: []Webhook{
+				{URL: "https://events.pagerduty.com/v2/enqueue", Template: `{"summary": {{json .DBInstanceIdentifier}}}`},
+			},
+		},
+		{
+			name:    "not a list",
+			raw:     `{"url": "https://hooks.slack.com/services/T0/B0/nibbler"}`,
+			wantErr: true,
+		},
+		{
+			name:    "missing url",
+			raw:     `[{"preset": "slack"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown outcome",
+			raw:     `[{"url": "https://hooks.slack.com/services/T0/B0/nibbler", "outcomes": ["exploded"]}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown preset",
+			raw:     `[{"url": "https://hooks.slack.com/services/T0/B0/nibbler", "preset": "hypnotoad"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "broken template",
+			raw:     `[{"url": "https://hooks.slack.com/services/T0/B0/nibbler", "template": "{{.Outcome"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			raw:     `[{"url": "https://hooks.slack.com/services/T0/B0/nibbler", "channel": "#planet-express"}]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWebhooks(tt.raw)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestFromEnv verifies the notifier configuration from the environment.
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name        string
+		envVars     map[string]string
+		wantNil     bool
+		wantErr     bool
+		wantTimeout time.Duration
+		wantRetries int
+	}{
+		{
+			name:    "nothing configured",
+			wantNil: true,
+		},
+		{
+			name:    "empty list",
+			envVars: map[string]string{"WEBHOOKS": "[]"},
+			wantNil: true,
+		},
+		{
+			name:        "defaults",
+			envVars:     map[string]string{"WEBHOOKS": `[{"url": "https://hooks.slack.com/services/T0/B0/nibbler"}]`},
+			wantTimeout: DefaultTimeout,
+			wantRetries: DefaultRetries,
+		},
+		{
+			name: "timeout and retries",
+			envVars: map[string]string{
+				"WEBHOOKS":        `[{"url": "https://hooks.slack.com/services/T0/B0/nibbler"}]`,
+				"WEBHOOK_TIMEOUT": "2s",
+				"WEBHOOK_RETRIES": "0",
+			},
+			wantTimeout: 2 * time.Second,
+		},
+		{
+			name: "invalid timeout",
+			envVars: map[string]string{
+				"WEBHOOKS":        `[{"url": "https://hooks.slack.com/services/T0/B0/nibbler"}]`,
+				"WEBHOOK_TIMEOUT": "until the heat death of the universe",
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative retries",
+			envVars: map[string]string{
+				"WEBHOOKS":        `[{"url": "https://hooks.slack.com/services/T0/B0/nibbler"}]`,
+				"WEBHOOK_RETRIES": "-1",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"WEBHOOKS", "WEBHOOK_TIMEOUT", "WEBHOOK_RETRIES"} {
+				t.Setenv(k, tt.envVars[k])
+			}
+
+			notifier, err := FromEnv(logrus.New())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			if tt.wantNil {
+				assert.Nil(t, notifier)
+				return
+			}
+
+			require.NotNil(t, notifier)
+			assert.Equal(t, tt.wantTimeout, notifier.client.Timeout)
+			assert.Equal(t, tt.wantRetries, notifier.retries)
+		})
+	}
+}
+
+// webhookServer is an httptest server answering with the given status codes in turn and recording the bodies.
+type webhookServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	bodies   [][]byte
+}
+
+// newWebhookServer starts a webhook server, the last status is repeated once the others are used up.
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	t.Helper()
+
+	s := &webhookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		s.bodies = append(s.bodies, body)
+
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status = s.statuses[0]
+			if len(s.statuses) > 1 {
+				s.statuses = s.statuses[1:]
+			}
+		}
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// requests returns the number of requests received.
+func (s *webhookServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.bodies)
+}
+
+// TestNotifier_Observe covers filtering, delivery and retries of webhook notifications.
+// Hermes files a report for every delivery, and keeps filing until the Central Bureaucracy stamps it.
+func TestNotifier_Observe(t *testing.T) {
+	failed := &metrics.Result{
+		EventID:              "slurm-application-autoscaling-fry",
+		DBInstanceIdentifier: "application-autoscaling-fry",
+		ClusterIdentifier:    "planet-express",
+		Outcome:              metrics.OutcomeFailed,
+		Error:                "AccessDenied: Zoidberg is not allowed in here",
+	}
+
+	tests := []struct {
+		name         string
+		outcomes     []metrics.Outcome
+		statuses     []int
+		retries      int
+		result       *metrics.Result
+		wantRequests int
+		wantSleeps   []time.Duration
+		wantLogged   bool
+	}{
+		{
+			name:         "delivered at once",
+			result:       failed,
+			wantRequests: 1,
+		},
+		{
+			name:     "outcome filtered out",
+			outcomes: []metrics.Outcome{metrics.OutcomeFailed},
+			result: &metrics.Result{
+				DBInstanceIdentifier: "application-autoscaling-leela",
+				Outcome:              metrics.OutcomeTagged,
+			},
+		},
+		{
+			name:         "outcome matching the filter",
+			outcomes:     []metrics.Outcome{metrics.OutcomeFailed},
+			result:       failed,
+			wantRequests: 1,
+		},
+		{
+			name:         "server errors are retried",
+			statuses:     []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK},
+			retries:      2,
+			result:       failed,
+			wantRequests: 3,
+			wantSleeps:   []time.Duration{500 * time.Millisecond, time.Second},
+		},
+		{
+			name:         "retries run out",
+			statuses:     []int{http.StatusServiceUnavailable},
+			retries:      2,
+			result:       failed,
+			wantRequests: 3,
+			wantSleeps:   []time.Duration{500 * time.Millisecond, time.Second},
+			wantLogged:   true,
+		},
+		{
+			name:         "client errors are not retried",
+			statuses:     []int{http.StatusNotFound},
+			retries:      2,
+			result:       failed,
+			wantRequests: 1,
+			wantLogged:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newWebhookServer(t, tt.statuses...)
+
+			logger, hook := test.NewNullLogger()
+
+			notifier, err := NewNotifier(logger, []Webhook{{URL: server.URL + "/services/secret", Outcomes: tt.outcomes}},
+				time.Second, tt.retries)
+			require.NoError(t, err)
+
+			var sleeps []time.Duration
+			notifier.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+			notifier.Observe(context.Background(), tt.result)
+
+			assert.Equal(t, tt.wantRequests, server.requests())
+			assert.Equal(t, tt.wantSleeps, sleeps)
+			assert.Equal(t, tt.wantLogged, len(hook.AllEntries()) > 0)
+
+			for _, entry := range hook.AllEntries() {
+				assert.NotContains(t, entry.Message, "secret")
+			}
+
+			if tt.wantRequests > 0 {
+				var got Payload
+				require.NoError(t, json.Unmarshal(server.bodies[0], &got))
+				assert.Equal(t, tt.result, got.Result)
+			}
+		})
+	}
+}
+
+// TestNotifier_Timeout verifies a webhook that does not answer in time is retried and then given up on.
+func TestNotifier_Timeout(t *testing.T) {
+	release := make(chan struct{})
+
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	logger, hook := test.NewNullLogger()
+
+	notifier, err := NewNotifier(logger, []Webhook{{URL: server.URL}}, 50*time.Millisecond, 1)
+	require.NoError(t, err)
+
+	notifier.sleep = func(time.Duration) {}
+
+	notifier.Observe(context.Background(), &metrics.Result{DBInstanceIdentifier: "application-autoscaling-fry", Outcome: metrics.OutcomeFailed})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, 2, requests)
+	require.Len(t, hook.AllEntries(), 1)
+	assert.Contains(t, hook.LastEntry().Message, "giving up after 2 attempts")
+}
+
+// TestNotifier_DeadlineNear verifies a slow webhook is given up on when the invocation deadline comes first,
+// instead of being retried for the full timeout. The Professor needs the ship back before the delivery is late.
+func TestNotifier_DeadlineNear(t *testing.T) {
+	release := make(chan struct{})
+
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	logger, hook := test.NewNullLogger()
+
+	notifier, err := NewNotifier(logger, []Webhook{{URL: server.URL + "/services/secret"}}, 10*time.Second, 2)
+	require.NoError(t, err)
+
+	var sleeps []time.Duration
+	notifier.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	notifier.Observe(ctx, &metrics.Result{DBInstanceIdentifier: "application-autoscaling-fry", Outcome: metrics.OutcomeFailed})
+
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Empty(t, sleeps)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, 1, requests)
+	require.Len(t, hook.AllEntries(), 1)
+	assert.Contains(t, hook.LastEntry().Message, "the invocation deadline is near")
+	assert.NotContains(t, hook.LastEntry().Message, "secret")
+}
+
+// TestNotifier_SeveralWebhooks verifies every webhook gets its own payload.
+func TestNotifier_SeveralWebhooks(t *testing.T) {
+	slack := newWebhookServer(t)
+	inventory := newWebhookServer(t)
+
+	logger, _ := test.NewNullLogger()
+
+	notifier, err := NewNotifier(logger, []Webhook{
+		{URL: slack.URL, Preset: PresetSlack, Outcomes: []metrics.Outcome{metrics.OutcomeFailed}},
+		{URL: inventory.URL, Outcomes: []metrics.Outcome{metrics.OutcomeTagged}},
+	}, time.Second, 0)
+	require.NoError(t, err)
+
+	notifier.Observe(context.Background(), &metrics.Result{DBInstanceIdentifier: "application-autoscaling-leela", Outcome: metrics.OutcomeTagged})
+	notifier.Observe(context.Background(), &metrics.Result{DBInstanceIdentifier: "application-autoscaling-fry", Outcome: metrics.OutcomeFailed})
+
+	require.Equal(t, 1, slack.requests())
+	require.Equal(t, 1, inventory.requests())
+	assert.Contains(t, string(slack.bodies[0]), "application-autoscaling-fry")
+	assert.Contains(t, string(inventory.bodies[0]), `"db_instance_identifier":"application-autoscaling-leela"`)
+}
+
+// TestRedact verifies secrets in webhook paths stay out of the logs.
+func TestRedact(t *testing.T) {
+	assert.Equal(t, "https://hooks.slack.com/...", redact("https://hooks.slack.com/services/T0/B0/nibbler"))
+	assert.Equal(t, "webhook", redact("hooks.slack.com"))
+}
@@ -0,0 +1,150 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"counter/internal/metrics"
+	"counter/internal/version"
+)
+
+// Preset is a built-in payload format.
+type Preset string
+
+const (
+	// PresetJSON posts the result with the version of the function as JSON.
+	PresetJSON Preset = "json"
+	// PresetSlack posts a message for a Slack incoming webhook.
+	PresetSlack Preset = "slack"
+)
+
+// Payload is what templates are executed with and what PresetJSON posts, the result with the version of the
+// function that produced it.
+type Payload struct {
+	*metrics.Result
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+}
+
+// renderer turns a result into the body of a webhook request.
+type renderer func(result *metrics.Result) ([]byte, error)
+
+// newRenderer returns the renderer of the template or preset of webhook.
+func newRenderer(webhook Webhook) (renderer, error) {
+	if webhook.Template != "" {
+		return templateRenderer(webhook.Template)
+	}
+
+	switch webhook.Preset {
+	case "", PresetJSON:
+		return func(result *metrics.Result) ([]byte, error) {
+			return json.Marshal(newPayload(result))
+		}, nil
+	case PresetSlack:
+		return slackMessage, nil
+	default:
+		return nil, fmt.Errorf("unknown preset %q, expected %s or %s", webhook.Preset, PresetJSON, PresetSlack)
+	}
+}
+
+// newPayload adds the version of the function to result.
+func newPayload(result *metrics.Result) Payload {
+	return Payload{Result: result, Version: version.Version, Commit: version.GitCommit}
+}
+
+// templateRenderer parses text, values are written into it as JSON with the json function, for example
+// {"summary": {{json .DBInstanceIdentifier}}}.
+func templateRenderer(text string) (renderer, error) {
+	tmpl, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			raw, err := json.Marshal(v)
+			return string(raw), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	return func(result *metrics.Result) ([]byte, error) {
+		var buf bytes.Buffer
+
+		if err := tmpl.Execute(&buf, newPayload(result)); err != nil {
+			return nil, err
+		}
+
+		if !json.Valid(buf.Bytes()) {
+			return nil, errors.New("template did not render valid JSON")
+		}
+
+		return buf.Bytes(), nil
+	}, nil
+}
+
+// slackMessage renders result as a Slack message, for example
+// ":rotating_light: *failed* `application-autoscaling-1234` in `prod-aurora`" followed by the reason, the error
+// and the tags applied.
+func slackMessage(result *metrics.Result) ([]byte, error) {
+	var lines []string
+
+	subject := "event " + result.EventID
+	if result.DBInstanceIdentifier != "" {
+		subject = fmt.Sprintf("`%s`", slackEscape(result.DBInstanceIdentifier))
+	}
+
+	headline := fmt.Sprintf("%s *%s* %s", slackEmoji(result.Outcome), result.Outcome, subject)
+	if result.ClusterIdentifier != "" {
+		headline += fmt.Sprintf(" in `%s`", slackEscape(result.ClusterIdentifier))
+	}
+
+	lines = append(lines, headline)
+
+	if result.Reason != "" {
+		lines = append(lines, "Reason: "+slackEscape(result.Reason))
+	}
+
+	if result.Error != "" {
+		lines = append(lines, "Error: "+slackEscape(result.Error))
+	}
+
+	if len(result.TagsApplied) > 0 {
+		keys := make([]string, 0, len(result.TagsApplied))
+		for k := range result.TagsApplied {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		tags := make([]string, 0, len(keys))
+		for _, k := range keys {
+			tags = append(tags, fmt.Sprintf("`%s=%s`", slackEscape(k), slackEscape(result.TagsApplied[k])))
+		}
+
+		lines = append(lines, "Tags: "+strings.Join(tags, ", "))
+	}
+
+	lines = append(lines, fmt.Sprintf("_rds-tag-setter %s (%s)_", version.Version, version.GitCommit))
+
+	return json.Marshal(map[string]string{"text": strings.Join(lines, "\n")})
+}
+
+// slackEmoji marks failures and changes apart from everything else.
+func slackEmoji(outcome metrics.Outcome) string {
+	switch outcome {
+	case metrics.OutcomeFailed, metrics.OutcomeRejected:
+		return ":rotating_light:"
+	case metrics.OutcomeTagged, metrics.OutcomeRestored, metrics.OutcomePropagated, metrics.OutcomeReconciled:
+		return ":label:"
+	default:
+		return ":information_source:"
+	}
+}
+
+// slackEscape escapes the characters Slack treats as markup.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"encoding/json"
+	"testing"
+
+	"counter/internal/metrics"
+	"counter/internal/version"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderers checks the payloads of the presets and of templates.
+// The same news reads very differently in the Slurm Times and on Bender's blog.
+func TestRenderers(t *testing.T) {
+	tagged := &metrics.Result{
+		EventID:              "slurm-application-autoscaling-leela",
+		DBInstanceIdentifier: "application-autoscaling-leela",
+		ClusterIdentifier:    "planet-express",
+		Outcome:              metrics.OutcomeTagged,
+		TagsApplied:          map[string]string{"Purpose": "delivery-company", "Owner": "professor-farnsworth"},
+	}
+
+	failed := &metrics.Result{
+		EventID:              "slurm-application-autoscaling-fry",
+		DBInstanceIdentifier: "application-autoscaling-fry",
+		Outcome:              metrics.OutcomeFailed,
+		Reason:               "tags <could not> be verified",
+		Error:                "Owner: got bender & friends",
+	}
+
+	tests := []struct {
+		name    string
+		webhook Webhook
+		result  *metrics.Result
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "json preset",
+			result: tagged,
+			want: `{"event_id":"slurm-application-autoscaling-leela","db_instance_identifier":"application-autoscaling-leela",` +
+				`"cluster_identifier":"planet-express","outcome":"tagged",` +
+				`"tags_applied":{"Owner":"professor-farnsworth","Purpose":"delivery-company"},` +
+				`"version":"` + version.Version + `","commit":"` + version.GitCommit + `"}`,
+		},
+		{
+			name:    "slack preset for a tagged replica",
+			webhook: Webhook{Preset: PresetSlack},
+			result:  tagged,
+			want: `{"text":":label: *tagged* ` + "`application-autoscaling-leela` in `planet-express`" + `\n` +
+				"Tags: `Owner=professor-farnsworth`, `Purpose=delivery-company`" + `\n` +
+				`_rds-tag-setter ` + version.Version + ` (` + version.GitCommit + `)_"}`,
+		},
+		{
+			name:    "slack preset escapes markup",
+			webhook: Webhook{Preset: PresetSlack},
+			result:  failed,
+			want: `{"text":":rotating_light: *failed* ` + "`application-autoscaling-fry`" + `\n` +
+				`Reason: tags &lt;could not&gt; be verified\n` +
+				`Error: Owner: got bender &amp; friends\n` +
+				`_rds-tag-setter ` + version.Version + ` (` + version.GitCommit + `)_"}`,
+		},
+		{
+			name:    "slack preset without an instance",
+			webhook: Webhook{Preset: PresetSlack},
+			result:  &metrics.Result{EventID: "slurm-1", Outcome: metrics.OutcomeRejected},
+			want: `{"text":":rotating_light: *rejected* event slurm-1\n` +
+				`_rds-tag-setter ` + version.Version + ` (` + version.GitCommit + `)_"}`,
+		},
+		{
+			name: "template",
+			webhook: Webhook{Template: `{"routing_key": "hypnotoad", "event_action": "trigger",
+				"payload": {"summary": {{json .Error}}, "source": {{json .DBInstanceIdentifier}}, "severity": "error"}}`},
+			result: failed,
+			want: `{"routing_key":"hypnotoad","event_action":"trigger","payload":{"summary":"Owner: got bender & friends",` +
+				`"source":"application-autoscaling-fry","severity":"error"}}`,
+		},
+		{
+			name:    "template rendering invalid JSON",
+			webhook: Webhook{Template: `{"summary": {{.Error}}}`},
+			result:  failed,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			render, err := newRenderer(tt.webhook)
+			require.NoError(t, err)
+
+			got, err := render(tt.result)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+// TestSlackMessage_IsValidJSON verifies results with every outcome render to a Slack message.
+func TestSlackMessage_IsValidJSON(t *testing.T) {
+	for outcome := range knownOutcomes {
+		body, err := slackMessage(&metrics.Result{DBInstanceIdentifier: "application-autoscaling-bender", Outcome: outcome})
+		require.NoError(t, err)
+
+		var message map[string]string
+		require.NoError(t, json.Unmarshal(body, &message))
+		assert.Contains(t, message["text"], string(outcome))
+	}
+}
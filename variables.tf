@@ -19,3 +19,275 @@ variable "do_not_creat_event_bridge" {
   type        = bool
   default     = false
 }
+
+variable "lambda_timeout" {
+  description = "Timeout of the lambda function in seconds"
+  type        = number
+  default     = 90
+}
+
+variable "metrics_namespace" {
+  description = "CloudWatch namespace for metrics emitted by the lambda, empty string disables metrics"
+  type        = string
+  default     = "RDSTagSetter"
+}
+
+variable "verify_tags_attempts" {
+  description = "How many times to read tags back from the replica to verify them, 0 disables verification"
+  type        = number
+  default     = 0
+}
+
+variable "verify_tags_delay" {
+  description = "Delay between tag verification attempts, as a Go duration string"
+  type        = string
+  default     = "2s"
+}
+
+variable "enable_idempotency" {
+  description = "If set to true, processed event IDs are stored in a DynamoDB table and duplicate deliveries are skipped"
+  type        = bool
+  default     = false
+}
+
+variable "idempotency_ttl" {
+  description = "How long processed event IDs are remembered, as a Go duration string"
+  type        = string
+  default     = "24h"
+}
+
+variable "max_event_age" {
+  description = "Events older than this Go duration string are stale and handled according to stale_event_mode, empty string disables the check"
+  type        = string
+  default     = ""
+}
+
+variable "stale_event_mode" {
+  description = "How stale events are handled: ignore skips them, reconcile adds only the tags missing on the replica"
+  type        = string
+  default     = "ignore"
+
+  validation {
+    condition     = contains(["ignore", "reconcile"], var.stale_event_mode)
+    error_message = "The stale_event_mode must be either ignore or reconcile."
+  }
+}
+
+variable "inherited_tag_keys" {
+  description = "Cluster tag keys whose changes are propagated to the existing autoscaled replicas, requires a CloudTrail trail in the account"
+  type        = list(string)
+  default     = []
+}
+
+variable "custom_endpoints" {
+  description = "Custom endpoints of the cluster that new autoscaled replicas are added to as static members, and removed from when they are deleted"
+  type        = list(string)
+  default     = []
+}
+
+variable "custom_endpoint_tag" {
+  description = "Tag rule of the form key=value, custom endpoints of the cluster carrying the tag are managed like those in custom_endpoints"
+  type        = string
+  default     = ""
+
+  validation {
+    condition     = var.custom_endpoint_tag == "" || can(regex("^[^=]+=", var.custom_endpoint_tag))
+    error_message = "The custom_endpoint_tag must have the form key=value."
+  }
+}
+
+variable "instance_settings" {
+  description = "Settings written to new autoscaled replicas after tagging where they differ, unset attributes are left as copied from the cluster, null disables it"
+  type = object({
+    performance_insights_retention_period = optional(number)
+    monitoring_interval                   = optional(number)
+    monitoring_role_arn                   = optional(string)
+    promotion_tier                        = optional(number)
+    ca_certificate_identifier             = optional(string)
+  })
+  default = null
+}
+
+variable "instance_settings_dry_run" {
+  description = "If set to true, differences to instance_settings and the enforced promotion tier are only logged and reported, replicas are not modified"
+  type        = bool
+  default     = false
+}
+
+variable "enforce_promotion_tier" {
+  description = "If set to true, autoscaled replicas are kept at promotion_tier on creation and during sweeps"
+  type        = bool
+  default     = false
+}
+
+variable "promotion_tier" {
+  description = "Promotion tier enforced on autoscaled replicas, 15 is the lowest failover priority"
+  type        = number
+  default     = 15
+
+  validation {
+    condition     = var.promotion_tier >= 0 && var.promotion_tier <= 15 && floor(var.promotion_tier) == var.promotion_tier
+    error_message = "The promotion_tier must be an integer between 0 and 15."
+  }
+}
+
+variable "alarm_templates" {
+  description = "CloudWatch alarms created for each autoscaled replica on its DBInstanceIdentifier dimension and deleted with it, the name is appended to the instance identifier"
+  type = list(object({
+    name                = string
+    metric_name         = string
+    comparison_operator = string
+    threshold           = number
+    namespace           = optional(string)
+    statistic           = optional(string)
+    period              = optional(number)
+    evaluation_periods  = optional(number)
+    datapoints_to_alarm = optional(number)
+    treat_missing_data  = optional(string)
+    alarm_actions       = optional(list(string))
+    ok_actions          = optional(list(string))
+  }))
+  default = []
+}
+
+variable "tag_log_groups" {
+  description = "If set to true, the /aws/rds/instance/<id>/<log> log export groups of new autoscaled replicas are tagged like the replicas"
+  type        = bool
+  default     = false
+}
+
+variable "log_group_retention_days" {
+  description = "Retention in days set on the log export groups of new autoscaled replicas when tag_log_groups is set, 0 leaves it unchanged"
+  type        = number
+  default     = 0
+
+  validation {
+    condition     = contains([0, 1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1096, 1827, 2192, 2557, 2922, 3288, 3653], var.log_group_retention_days)
+    error_message = "The log_group_retention_days must be 0 or a retention period supported by CloudWatch Logs."
+  }
+}
+
+variable "tag_scalable_target" {
+  description = "If set to true, the Application Auto Scaling scalable target of the cluster is tagged at cold start and during sweeps"
+  type        = bool
+  default     = false
+}
+
+variable "event_bus_name" {
+  description = "Name or ARN of the EventBridge event bus receiving a Replica Tagged event for each tagged replica, empty string disables the events"
+  type        = string
+  default     = ""
+}
+
+variable "webhooks" {
+  description = "Webhook URLs receiving results, optionally only those with the listed outcomes, as the json or slack preset or rendered from a Go template"
+  type = list(object({
+    url      = string
+    outcomes = optional(list(string))
+    preset   = optional(string)
+    template = optional(string)
+  }))
+  default   = []
+  sensitive = true
+}
+
+variable "webhook_timeout" {
+  description = "Timeout of a single webhook delivery attempt as a Go duration"
+  type        = string
+  default     = "5s"
+}
+
+variable "webhook_retries" {
+  description = "Number of times a webhook delivery is retried after a connection error, throttling or server error"
+  type        = number
+  default     = 2
+}
+
+variable "audit_sink" {
+  description = "Where an audit record of every tagging decision is written: stdout for the function logs, s3 for audit_bucket_name, dynamodb for a table created by the module, empty string disables the audit trail"
+  type        = string
+  default     = ""
+
+  validation {
+    condition     = contains(["", "stdout", "s3", "dynamodb"], var.audit_sink)
+    error_message = "The audit_sink must be empty, stdout, s3 or dynamodb."
+  }
+}
+
+variable "audit_bucket_name" {
+  description = "Existing S3 bucket receiving the audit records as JSON Lines objects when audit_sink is s3"
+  type        = string
+  default     = ""
+}
+
+variable "audit_prefix" {
+  description = "Key prefix of the audit objects in audit_bucket_name"
+  type        = string
+  default     = "rds-tag-setter/"
+}
+
+variable "enable_replica_lifetimes" {
+  description = "If set to true, creation times of autoscaled replicas are kept in a DynamoDB table to report their lifetime when they are deleted"
+  type        = bool
+  default     = false
+}
+
+variable "allowed_account_ids" {
+  description = "AWS account IDs whose RDS events are accepted, defaults to the current account"
+  type        = list(string)
+  default     = []
+}
+
+variable "allowed_regions" {
+  description = "AWS regions whose RDS events are accepted, defaults to the current region"
+  type        = list(string)
+  default     = []
+}
+
+variable "sweep_schedule_expression" {
+  description = "EventBridge schedule expression for reconciling tags on all autoscaled replicas, for example rate(1 hour), empty string disables the schedule"
+  type        = string
+  default     = ""
+}
+
+variable "enable_cloudtrail_tagging" {
+  description = "If set to true, replicas are also tagged on the CloudTrail CreateDBInstance call of application autoscaling, before the instance becomes available, requires a CloudTrail trail in the account"
+  type        = bool
+  default     = false
+}
+
+variable "restore_managed_tags" {
+  description = "If set to true, managed tags that are removed from or changed on autoscaled replicas are put back, requires a CloudTrail trail in the account"
+  type        = bool
+  default     = false
+}
+
+variable "catch_up_lookback" {
+  description = "Go duration string, up to 336h, searched for missed creation events at cold start and by the catch-up schedule, empty string disables the cold start catch-up and uses 24h for the schedule"
+  type        = string
+  default     = ""
+}
+
+variable "catch_up_schedule_expression" {
+  description = "EventBridge schedule expression for recovering missed creation events, for example rate(6 hours), empty string disables the schedule"
+  type        = string
+  default     = ""
+}
+
+variable "enable_sqs_queue" {
+  description = "If set to true, RDS events are buffered in an SQS queue with a dead-letter queue instead of invoking the lambda directly"
+  type        = bool
+  default     = false
+}
+
+variable "sqs_max_receive_count" {
+  description = "How many times a failed event is retried from the SQS queue before it is moved to the dead-letter queue"
+  type        = number
+  default     = 5
+}
+
+variable "sns_topic_arns" {
+  description = "ARNs of SNS topics receiving RDS event subscription notifications, the lambda is subscribed to each of them"
+  type        = list(string)
+  default     = []
+}